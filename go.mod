@@ -1,8 +1,14 @@
 module github.com/nilsmagnus/grib
 
-go 1.16
+go 1.21
 
 require (
 	github.com/golang/mock v1.6.0
 	github.com/stretchr/testify v1.8.2
 )
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
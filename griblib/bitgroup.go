@@ -2,8 +2,10 @@ package griblib
 
 import (
 	"fmt"
+	"math/bits"
 
 	"github.com/nilsmagnus/grib/internal/reader"
+	"github.com/nilsmagnus/grib/internal/writer"
 )
 
 type bitGroupParameter struct {
@@ -32,23 +34,49 @@ func (bitGroup *bitGroupParameter) readData(bitReader *reader.BitReader) ([]int6
 }
 
 // Test to see if the group widths and lengths are consistent with number of
-// values, and length of section 7.
-func checkLengths(bitGroups []bitGroupParameter, dataLength int) error {
-	totBit := 0
-	totLen := 0
+// values, and length of section 7. A negative pointsNumber is not checked.
+func checkLengths(bitGroups []bitGroupParameter, dataLength int, pointsNumber int) error {
+	var totBit, totLen uint64
 
-	for _, param := range bitGroups {
-		totBit += int(param.Width) * int(param.Length)
-		totLen += int(param.Length)
+	for index, param := range bitGroups {
+		if param.Width > 64 {
+			return fmt.Errorf("%w: group %d has values of %d bits", ErrCorruptData, index, param.Width)
+		}
+		totBit += param.Width * param.Length
+		totLen += param.Length
 	}
 
-	if totBit/8 > int(dataLength) {
-		return fmt.Errorf("Checksum err %d - %d", dataLength, totBit/8)
+	if pointsNumber >= 0 && totLen != uint64(pointsNumber) {
+		return fmt.Errorf("%w: groups of %d values, expected %d values", ErrCorruptData, totLen, pointsNumber)
+	}
+	if totBit > 8*uint64(dataLength) {
+		return fmt.Errorf("%w: groups of %d octets in %d octets", ErrCorruptData, (totBit+7)/8, dataLength)
 	}
 
 	return nil
 }
 
+// checkGroups tests if the number of groups and the bits of their parameters fit in the dataLength
+// octets of section 7, before they are read. A negative pointsNumber is not checked.
+func (template *Data2) checkGroups(dataLength int, pointsNumber int) error {
+	if template.NG == 0 || (pointsNumber >= 0 && uint64(template.NG) > uint64(pointsNumber)) {
+		return fmt.Errorf("%w: %d groups for %d values", ErrCorruptData, template.NG, pointsNumber)
+	}
+	if template.Bits > 64 || template.GroupWidthsBits > 64 || template.GroupScaledLengthsBits > 64 {
+		return fmt.Errorf("%w: group parameters of %d, %d and %d bits", ErrCorruptData,
+			template.Bits, template.GroupWidthsBits, template.GroupScaledLengthsBits)
+	}
+	// the references, widths and lengths each start on an octet
+	octets := uint64(0)
+	for _, bits := range []uint8{template.Bits, template.GroupWidthsBits, template.GroupScaledLengthsBits} {
+		octets += (uint64(template.NG)*uint64(bits) + 7) / 8
+	}
+	if dataLength < 0 || octets > uint64(dataLength) {
+		return fmt.Errorf("%w: %d groups need %d octets, section 7 has %d", ErrCorruptData, template.NG, octets, dataLength)
+	}
+	return nil
+}
+
 // Extract Each Group's reference value
 func (template *Data2) extractGroupReferences(bitReader *reader.BitReader) ([]uint64, error) {
 	numberOfGroups := int64(template.NG)
@@ -123,3 +151,132 @@ func (template *Data2) extractBitGroupParameters(bitReader *reader.BitReader) ([
 
 	return result, nil
 }
+
+// splitGroupLength is the length of the groups that splitGroups starts with
+const splitGroupLength = 8
+
+// splitGroups splits values into groups of values close to each other. Values are first split into groups of
+// splitGroupLength, then neighbour groups are merged as long as it takes fewer bits than a group of its own,
+// which costs overhead bits for its reference, width and length.
+func splitGroups(values []uint64, overhead int) []bitGroupParameter {
+	groups := []bitGroupParameter{}
+	var minValue, maxValue uint64
+	for start := 0; start < len(values); start += splitGroupLength {
+		end := start + splitGroupLength
+		if end > len(values) {
+			end = len(values)
+		}
+		low, high := values[start], values[start]
+		for _, value := range values[start:end] {
+			if value < low {
+				low = value
+			}
+			if value > high {
+				high = value
+			}
+		}
+
+		if len(groups) > 0 {
+			last := &groups[len(groups)-1]
+			mergedLow, mergedHigh := minValue, maxValue
+			if low < mergedLow {
+				mergedLow = low
+			}
+			if high > mergedHigh {
+				mergedHigh = high
+			}
+			length := int(last.Length) + end - start
+			merged := length * bits.Len64(mergedHigh-mergedLow)
+			separate := int(last.Length)*int(last.Width) + (end-start)*bits.Len64(high-low) + overhead
+			if merged <= separate {
+				minValue, maxValue = mergedLow, mergedHigh
+				*last = bitGroupParameter{Reference: minValue, Width: uint64(bits.Len64(maxValue - minValue)), Length: uint64(length)}
+				continue
+			}
+		}
+		minValue, maxValue = low, high
+		groups = append(groups, bitGroupParameter{Reference: low, Width: uint64(bits.Len64(high - low)), Length: uint64(end - start)})
+	}
+	return groups
+}
+
+// packGroups splits values into groups and writes the group references, widths, lengths and the values of
+// every group, the inverse of extractBitGroupParameters and extractData. The group fields of the template are set.
+func (template *Data2) packGroups(w *writer.BitWriter, values []uint64) error {
+	if len(values) == 0 {
+		return fmt.Errorf("Can not pack an empty field with complex packing")
+	}
+	groups := splitGroups(values, bits.Len64(maxUint(values))+16)
+	last := len(groups) - 1
+
+	var maxReference uint64
+	minWidth, maxWidth := groups[0].Width, groups[0].Width
+	minLength, maxLength := groups[0].Length, groups[0].Length
+	for i, group := range groups {
+		if group.Reference > maxReference {
+			maxReference = group.Reference
+		}
+		if group.Width < minWidth {
+			minWidth = group.Width
+		}
+		if group.Width > maxWidth {
+			maxWidth = group.Width
+		}
+		// the length of the last group is given on its own
+		if i < last || last == 0 {
+			if group.Length < minLength {
+				minLength = group.Length
+			}
+			if group.Length > maxLength {
+				maxLength = group.Length
+			}
+		}
+	}
+
+	template.Bits = uint8(bits.Len64(maxReference))
+	template.GroupMethod = 1
+	template.MissingValue = 0
+	template.NG = uint32(len(groups))
+	template.GroupWidths = uint8(minWidth)
+	template.GroupWidthsBits = uint8(bits.Len64(maxWidth - minWidth))
+	template.GroupLengthsReference = uint32(minLength)
+	template.GroupLengthIncrement = 1
+	template.GroupLastLength = uint32(groups[last].Length)
+	template.GroupScaledLengthsBits = uint8(bits.Len64(maxLength - minLength))
+
+	for _, group := range groups {
+		w.WriteUint(group.Reference, int(template.Bits))
+	}
+	w.Align()
+	for _, group := range groups {
+		w.WriteUint(group.Width-minWidth, int(template.GroupWidthsBits))
+	}
+	w.Align()
+	for i, group := range groups {
+		scaled := uint64(0)
+		if i < last {
+			scaled = group.Length - minLength
+		}
+		w.WriteUint(scaled, int(template.GroupScaledLengthsBits))
+	}
+	w.Align()
+
+	start := 0
+	for _, group := range groups {
+		for _, value := range values[start : start+int(group.Length)] {
+			w.WriteUint(value-group.Reference, int(group.Width))
+		}
+		start += int(group.Length)
+	}
+	return nil
+}
+
+func maxUint(values []uint64) uint64 {
+	var max uint64
+	for _, value := range values {
+		if value > max {
+			max = value
+		}
+	}
+	return max
+}
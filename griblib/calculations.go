@@ -22,8 +22,12 @@ func AverageValueBasic(filter GeoFilter, grid0 *Grid0, data []float64) (float64,
 }
 
 func AverageValue(filter GeoFilter, message *Message) (float64, error) {
+	//the data is decoded first, a quasi-regular grid may be regularized by it
+	if err := message.Decode(); err != nil {
+		return -1, err
+	}
 	grid0, ok := message.Section3.Definition.(*Grid0)
-	data  := message.Section7.Data
+	data  := message.Data()
 	if ok {
 		return AverageValueBasic(filter, grid0, data)
 	}
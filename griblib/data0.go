@@ -1,10 +1,12 @@
 package griblib
 
 import (
+	"fmt"
 	"io"
 	"math"
 
 	"github.com/nilsmagnus/grib/internal/reader"
+	"github.com/nilsmagnus/grib/internal/writer"
 )
 
 const INT_MAX = 9223372036854775807
@@ -25,14 +27,34 @@ const INT_MAX = 9223372036854775807
 //	|              |    - 2-191 : reserved
 //	|              |    - 192-254 : reserved for Local Use
 //	|              |    - 255 : missing
+//
+// The scale factors E and D are signed, GRIB encodes them as sign-magnitude integers: the first bit is the sign.
+// GetDataTemplate decodes them for every template embedding Data0.
 type Data0 struct {
 	Reference    float32 `json:"reference"`
-	BinaryScale  uint16  `json:"binaryScale"`
-	DecimalScale uint16  `json:"decimalScale"`
+	BinaryScale  int16   `json:"binaryScale"`
+	DecimalScale int16   `json:"decimalScale"`
 	Bits         uint8   `json:"bits"`
 	Type         uint8   `json:"type"`
 }
 
+// header returns the header shared by the data templates, it is promoted to the templates embedding Data0
+func (template *Data0) header() *Data0 {
+	return template
+}
+
+// decodeScales converts the scale factors, read as two's complement integers, from sign-magnitude
+func (template *Data0) decodeScales() {
+	template.BinaryScale = int16(reader.SignMagnitude(uint64(uint16(template.BinaryScale)), 16))
+	template.DecimalScale = int16(reader.SignMagnitude(uint64(uint16(template.DecimalScale)), 16))
+}
+
+// encodeScales is the inverse of decodeScales, the scale factors are converted to sign-magnitude to be written
+func (template *Data0) encodeScales() {
+	template.BinaryScale = int16(writer.SignMagnitude(int64(template.BinaryScale), 16))
+	template.DecimalScale = int16(writer.SignMagnitude(int64(template.DecimalScale), 16))
+}
+
 func (template Data0) getRefScale() (float64, float64) {
 	bscale := math.Pow(2.0, float64(template.BinaryScale))
 	dscale := math.Pow(10.0, -float64(template.DecimalScale))
@@ -56,10 +78,15 @@ func ParseData0(dataReader io.Reader, dataLength int, template *Data0) ([]float6
 
 	fld := []float64{}
 
-	if dataLength == 0 {
+	// a constant field has no packed values, see ReadSection7
+	if dataLength == 0 || template.Bits == 0 {
 		return fld, nil
 	}
 
+	if template.Bits > 64 {
+		return fld, fmt.Errorf("%w: values of %d bits", ErrCorruptData, template.Bits)
+	}
+
 	scaleStrategy := template.scaleFunc()
 
 	bitReader, err := reader.New(dataReader, dataLength)
@@ -3,8 +3,10 @@ package griblib
 import (
 	"fmt"
 	"io"
+	"math"
 
 	"github.com/nilsmagnus/grib/internal/reader"
+	"github.com/nilsmagnus/grib/internal/writer"
 )
 
 // Data2 is a Grid point data - complex packing
@@ -63,148 +65,148 @@ type Data2 struct {
 	GroupScaledLengthsBits uint8  `json:"groupScaledLengthsBits"` // 47
 }
 
-func (template *Data2) missingValueSubstitute() (float64, float64) {
-	var missingValueSubstitute1 float64
-	var missingValueSubstitute2 float64
-	if template.MissingValue == 1 {
-		missingValueSubstitute1 = float64(template.MissingSubstitute1)
-	} else if template.MissingValue == 2 {
-		missingValueSubstitute1 = float64(template.MissingSubstitute1)
-		missingValueSubstitute2 = float64(template.MissingSubstitute1)
+// missingValueSubstitute decodes a missing value substitute, an IEEE 32-bit floating-point value or an unsigned
+// integer after the type of the original field values (octet 21)
+func (template *Data2) missingValueSubstitute(substitute uint32) float64 {
+	if template.Type == 1 {
+		return float64(substitute)
 	}
-	return missingValueSubstitute1, missingValueSubstitute2
+	return float64(math.Float32frombits(substitute))
 }
 
-func (template *Data2) scaleValues(section7Data []int64, ifldmiss []int64) []float64 {
+// scaleValues scales the packed values, the missing values (see extractData) are given their substitute
+func (template *Data2) scaleValues(section7Data []int64, missing []uint8) []float64 {
 	fld := make([]float64, len(section7Data))
 
 	scaleStrategy := template.scaleFunc()
-	missingValueSubstitute1, missingValueSubstitute2 := template.missingValueSubstitute()
+	primarySubstitute := template.missingValueSubstitute(template.MissingSubstitute1)
+	secondarySubstitute := template.missingValueSubstitute(template.MissingSubstitute2)
 
-	if template.MissingValue == 0 {
-		// no missing values
-		for n, dataValue := range section7Data {
+	for n, dataValue := range section7Data {
+		switch {
+		case missing == nil || missing[n] == NotMissing:
 			fld[n] = scaleStrategy(dataValue)
-		}
-	}
-	if template.MissingValue == 1 || template.MissingValue == 2 {
-		// missing values included
-		for n, dataValue := range section7Data {
-			switch ifldmiss[n] {
-			case 0:
-				fld[n] = scaleStrategy(dataValue)
-			case 1:
-				fld[n] = missingValueSubstitute1
-			case 2:
-				fld[n] = missingValueSubstitute2
-			}
+		case missing[n] == PrimaryMissing:
+			fld[n] = primarySubstitute
+		default:
+			fld[n] = secondarySubstitute
 		}
 	}
 
 	return fld
 }
 
-func (template *Data2) extractData(bitReader *reader.BitReader, bitGroups []bitGroupParameter) ([]int64, []int64, error) {
+// extractData reads the values of every group. With missing value management (octet 23), the returned mask tells
+// which values are missing: in a group of values of n bits, the values 2^n - 1 and 2^n - 2 are the primary and
+// secondary missing values, in a group of constant values, the reference values 2^Bits - 1 and 2^Bits - 2.
+// The mask is nil without missing value management.
+func (template *Data2) extractData(bitReader *reader.BitReader, bitGroups []bitGroupParameter) ([]int64, []uint8, error) {
 	var totalLength uint64
 	for _, group := range bitGroups {
 		totalLength += group.Length
 	}
 	section7Data := make([]int64, totalLength)
-	ifldmiss := make([]int64, 0, totalLength)
+	var missing []uint8
+	if template.MissingValue == 1 || template.MissingValue == 2 {
+		missing = make([]uint8, totalLength)
+	}
 	s7i := 0
 
 	for _, bitGroup := range bitGroups {
 		tmp, err := bitGroup.readData(bitReader)
 		if err != nil {
-			return section7Data, ifldmiss, fmt.Errorf("bitGroup read: %s", err.Error())
+			return section7Data, missing, fmt.Errorf("bitGroup read: %w", err)
 		}
 
 		missingValueBits := bitGroup.Width
 		if missingValueBits == 0 {
 			missingValueBits = uint64(template.Bits)
 		}
+		// with 64 bits, the shift gives 0 and the primary missing value is the largest uint64
+		primaryMissing := uint64(1)<<missingValueBits - 1
 
-		missingValues := []uint64{1<<missingValueBits - 1, 1<<missingValueBits - 2}
-
-		switch template.MissingValue {
-		case 0:
-			ifldmiss = append(ifldmiss, make([]int64, len(tmp))...)
-			for _, elt := range tmp {
-				section7Data[s7i] = elt + int64(bitGroup.Reference)
-				s7i++
+		for _, elt := range tmp {
+			packed := uint64(elt)
+			if bitGroup.Width == 0 {
+				packed = bitGroup.Reference
 			}
-
-		case 1:
-			for _, elt := range tmp {
-				if bitGroup.Reference == missingValues[0] {
-					section7Data[s7i] = -1
-					s7i++
-					ifldmiss = append(ifldmiss, 1)
-				} else {
-					section7Data[s7i] = elt + int64(bitGroup.Reference)
-					s7i++
-					ifldmiss = append(ifldmiss, 0)
-				}
-			}
-
-		case 2:
-			for _, elt := range tmp {
-				if bitGroup.Reference == missingValues[0] || bitGroup.Reference == missingValues[1] {
-					section7Data[s7i] = -1
-					s7i++
-
-					if bitGroup.Reference == missingValues[0] {
-						ifldmiss = append(ifldmiss, 1)
-					} else {
-						ifldmiss = append(ifldmiss, 2)
-					}
-				} else {
-					section7Data[s7i] = elt + int64(bitGroup.Reference)
-					s7i++
-
-					ifldmiss = append(ifldmiss, 0)
-				}
+			switch {
+			case missing == nil || missingValueBits == 0: // a value of 0 bits has no room for missing values
+				section7Data[s7i] = elt + int64(bitGroup.Reference)
+			case packed == primaryMissing:
+				missing[s7i] = PrimaryMissing
+			case template.MissingValue == 2 && packed == primaryMissing-1:
+				missing[s7i] = SecondaryMissing
+			default:
+				section7Data[s7i] = elt + int64(bitGroup.Reference)
 			}
+			s7i++
 		}
 	}
 
-	return section7Data, ifldmiss, nil
+	return section7Data, missing, nil
 }
 
-// ParseData2 parses data2 struct from the reader into the an array of floating-point values
+// ParseData2 parses data2 struct from the reader into the an array of floating-point values.
+// Missing values are given their substitute.
 func ParseData2(dataReader io.Reader, dataLength int, template *Data2) ([]float64, error) {
+	values, _, err := parseData2(dataReader, dataLength, template, -1)
+	return values, err
+}
+
+// parseData2 is ParseData2 checking that the groups hold pointsNumber (octets 6-9 of section 5) values, unless
+// it is negative. It also returns the missing mask of the values, see extractData.
+func parseData2(dataReader io.Reader, dataLength int, template *Data2, pointsNumber int) ([]float64, []uint8, error) {
 
 	//
 	// Init reader
 	//
 	bitReader, err := reader.New(dataReader, dataLength)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	//
 	// Extract Bit Group Parameters
 	//
+	if err := template.checkGroups(dataLength, pointsNumber); err != nil {
+		return nil, nil, err
+	}
 	bitGroups, err := template.extractBitGroupParameters(bitReader)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	//
 	//  Test to see if the group widths and lengths are consistent with number of
 	//  values, and length of section 7.
 	//
-	if err := checkLengths(bitGroups, dataLength); err != nil {
-		return nil, err
+	if err := checkLengths(bitGroups, dataLength, pointsNumber); err != nil {
+		return nil, nil, err
 	}
 
 	//
 	//  For each group, unpack data values
 	//
-	section7Data, ifldmiss, err := template.extractData(bitReader, bitGroups)
+	section7Data, missing, err := template.extractData(bitReader, bitGroups)
 	if err != nil {
-		return nil, fmt.Errorf("Data extract: %s", err.Error())
+		return nil, nil, fmt.Errorf("Data extract: %w", err)
 	}
 
-	return template.scaleValues(section7Data, ifldmiss), nil
+	return template.scaleValues(section7Data, missing), missing, nil
+}
+
+// PackData2 packs values with complex packing (template 5.2), as specified by options. The values are split in
+// groups of values close to each other, each group is packed with the bits needed for its own range.
+func PackData2(values []float64, options WriteOptions) (Data2, []byte, error) {
+	header, integers, err := quantize(values, options)
+	template := Data2{Data0: header}
+	if err != nil {
+		return template, nil, err
+	}
+	packed := writer.New()
+	if err := template.packGroups(packed, integers); err != nil {
+		return template, nil, err
+	}
+	return template, packed.Bytes(), nil
 }
@@ -3,8 +3,10 @@ package griblib
 import (
 	"fmt"
 	"io"
+	"math/bits"
 
 	"github.com/nilsmagnus/grib/internal/reader"
+	"github.com/nilsmagnus/grib/internal/writer"
 )
 
 // Data3 is a Grid point data - complex packing and spatial differencing
@@ -15,7 +17,7 @@ type Data3 struct {
 	OctetsNumber           uint8 `json:"octetsNumber"`
 }
 
-func (template *Data3) applySpacialDifferencing(section7Data []int64, minsd int64, ival1 int64, ival2 int64) {
+func (template *Data3) applySpacialDifferencing(section7Data []int64, missing []uint8, minsd int64, ival1 int64, ival2 int64) {
 	// Spatial differencing is a pre-processing before group splitting at encoding time.
 	// It is intended to reduce the size of sufficiently smooth fields, when combined with
 	// a splitting scheme as described in Data Representation Template 5.2. At order 1,
@@ -26,64 +28,72 @@ func (template *Data3) applySpacialDifferencing(section7Data []int64, minsd int6
 	// To keep values positive, the overall minimum of the resulting field (either gmin or
 	// hmin) is removed. At decoding time, after bit string unpacking, the original scaled
 	// values are recovered by adding the overall minimum and summing up recursively.
-	switch template.SpatialOrderDifference {
-	case 1:
-		// first order
-		section7Data[0] = ival1
-
-		for n := int(1); n < len(section7Data); n++ {
-			section7Data[n] = section7Data[n] + section7Data[n-1] + minsd
+	// Missing values are left out of the differences.
+	order := int(template.SpatialOrderDifference)
+	count := 0
+	var previous, beforePrevious int64
+	for n := range section7Data {
+		if missing != nil && missing[n] != NotMissing {
+			continue
 		}
-	case 2:
-		// second order
-
-		section7Data[0] = ival1
-		section7Data[1] = ival2
-
-		for n := int(2); n < len(section7Data); n++ {
-			section7Data[n] = section7Data[n] + (2 * section7Data[n-1]) - section7Data[n-2] + minsd
+		switch {
+		case count == 0:
+			section7Data[n] = ival1
+		case count == 1 && order == 2:
+			section7Data[n] = ival2
+		case order == 1:
+			// first order
+			section7Data[n] = section7Data[n] + previous + minsd
+		default:
+			// second order
+			section7Data[n] = section7Data[n] + (2 * previous) - beforePrevious + minsd
 		}
+		beforePrevious, previous = previous, section7Data[n]
+		count++
 	}
 }
 
 func (template *Data3) extractSpacingDifferentialValues(bitReader *reader.BitReader) (int64, int64, int64, error) {
-	var ival1 int64
-	var ival2 int64
-	var minsd int64
-
 	rc := int(template.OctetsNumber) * 8
-	if rc != 0 {
-		var err error
-		ival1, err = bitReader.ReadInt(rc)
-		if err != nil {
-			return minsd, ival1, ival2, fmt.Errorf("Spacial differencing Value 1: %s", err.Error())
-		}
-
-		if template.SpatialOrderDifference == 2 {
-			ival2, err = bitReader.ReadInt(rc)
-			if err != nil {
-				return minsd, ival1, ival2, fmt.Errorf("Spacial differencing Value 2: %s", err.Error())
-			}
-		}
-
-		minsd, err = bitReader.ReadInt(rc)
-		if err != nil {
-			return minsd, ival1, ival2, fmt.Errorf("Spacial differencing Reference: %s", err.Error())
-		}
+	if rc == 0 {
+		return 0, 0, 0, nil
 	}
 
-	return minsd, ival1, ival2, nil
+	// ival1, ival2 at order 2, and the overall minimum minsd, all sign-magnitude integers of rc bits
+	values, err := bitReader.ReadIntsBlock(rc, int64(template.SpatialOrderDifference)+1, false)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("Spacial differencing values: %w", err)
+	}
+	if template.SpatialOrderDifference == 2 {
+		return values[2], values[0], values[1], nil
+	}
+	return values[1], values[0], 0, nil
 }
 
-// ParseData3 parses data3 struct from the reader into the an array of floating-point values
+// ParseData3 parses data3 struct from the reader into the an array of floating-point values.
+// Missing values are given their substitute.
 func ParseData3(dataReader io.Reader, dataLength int, template *Data3) ([]float64, error) {
+	values, _, err := parseData3(dataReader, dataLength, template, -1)
+	return values, err
+}
+
+// parseData3 is ParseData3 checking that the groups hold pointsNumber (octets 6-9 of section 5) values, unless
+// it is negative. It also returns the missing mask of the values, see Data2.extractData.
+func parseData3(dataReader io.Reader, dataLength int, template *Data3, pointsNumber int) ([]float64, []uint8, error) {
+
+	switch {
+	case template.SpatialOrderDifference != 1 && template.SpatialOrderDifference != 2:
+		return nil, nil, fmt.Errorf("%w: spatial differencing of order %d", ErrCorruptData, template.SpatialOrderDifference)
+	case template.OctetsNumber > 8:
+		return nil, nil, fmt.Errorf("%w: spatial differencing values of %d octets", ErrCorruptData, template.OctetsNumber)
+	}
 
 	//
 	// Init reader
 	//
 	bitReader, err := reader.New(dataReader, dataLength)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	//
@@ -91,37 +101,118 @@ func ParseData3(dataReader io.Reader, dataLength int, template *Data3) ([]float6
 	//
 	minsd, ival1, ival2, err := template.extractSpacingDifferentialValues(bitReader)
 	if err != nil {
-		return nil, fmt.Errorf("Spacial differencing Value 1: %s", err.Error())
+		return nil, nil, err
 	}
 
 	//
 	// Extract Bit Group Parameters
 	//
+	extraLength := int(template.OctetsNumber) * (int(template.SpatialOrderDifference) + 1)
+	if err := template.checkGroups(dataLength-extraLength, pointsNumber); err != nil {
+		return nil, nil, fmt.Errorf("Groups: %w", err)
+	}
 	bitGroups, err := template.extractBitGroupParameters(bitReader)
 	if err != nil {
-		return nil, fmt.Errorf("Groups: %s", err.Error())
+		return nil, nil, fmt.Errorf("Groups: %w", err)
 	}
 
 	//
 	//  Test to see if the group widths and lengths are consistent with number of
 	//  values, and length of section 7.
 	//
-	if err := checkLengths(bitGroups, dataLength); err != nil {
-		return nil, fmt.Errorf("Check length: %s", err.Error())
+	if err := checkLengths(bitGroups, dataLength-extraLength, pointsNumber); err != nil {
+		return nil, nil, fmt.Errorf("Check length: %w", err)
 	}
 
 	//
 	//  For each group, unpack data values
 	//
-	section7Data, ifldmiss, err := template.extractData(bitReader, bitGroups)
+	section7Data, missing, err := template.extractData(bitReader, bitGroups)
 	if err != nil {
-		return nil, fmt.Errorf("Data extract: %s", err.Error())
+		return nil, nil, fmt.Errorf("Data extract: %w", err)
+	}
+	if len(section7Data) < int(template.SpatialOrderDifference) {
+		return nil, nil, fmt.Errorf("%w: spatial differencing of order %d for %d values", ErrCorruptData, template.SpatialOrderDifference, len(section7Data))
 	}
 
 	//
 	// Apply spacing differencing
 	//
-	template.applySpacialDifferencing(section7Data, minsd, ival1, ival2)
+	template.applySpacialDifferencing(section7Data, missing, minsd, ival1, ival2)
 
-	return template.scaleValues(section7Data, ifldmiss), nil
+	return template.scaleValues(section7Data, missing), missing, nil
+}
+
+// PackData3 packs values with complex packing and spatial differencing (template 5.3) of the given order, 1 or 2,
+// as specified by options. 0 means order 2. Differencing is applied to the values in the order they are given.
+func PackData3(values []float64, options WriteOptions, order int) (Data3, []byte, error) {
+	if order == 0 {
+		order = 2
+	}
+	if order != 1 && order != 2 {
+		return Data3{}, nil, fmt.Errorf("Spatial differencing of order %d not supported", order)
+	}
+	header, integers, err := quantize(values, options)
+	template := Data3{Data2: Data2{Data0: header}}
+	if err != nil {
+		return template, nil, err
+	}
+	if len(integers) == 0 {
+		return template, nil, fmt.Errorf("Can not pack an empty field with complex packing")
+	}
+	// the second value of a field with a single value does not exist
+	if len(integers) < 2 {
+		order = 1
+	}
+
+	// differences of the given order, the first order values are kept as they are
+	differences := make([]int64, len(integers))
+	for n := range integers {
+		differences[n] = int64(integers[n])
+	}
+	for o := 0; o < order; o++ {
+		for n := len(differences) - 1; n > o; n-- {
+			differences[n] -= differences[n-1]
+		}
+	}
+	var minsd int64
+	if len(differences) > order {
+		minsd = differences[order]
+		for _, difference := range differences[order:] {
+			if difference < minsd {
+				minsd = difference
+			}
+		}
+	}
+	packedDifferences := make([]uint64, len(differences))
+	for n := order; n < len(differences); n++ {
+		packedDifferences[n] = uint64(differences[n] - minsd)
+	}
+
+	// ival1, ival2 and minsd are written with the same number of octets, one bit is the sign
+	extras := []int64{int64(integers[0])}
+	if order == 2 {
+		extras = append(extras, int64(integers[1]))
+	}
+	extras = append(extras, minsd)
+	extraBits := 0
+	for _, extra := range extras {
+		if extra < 0 {
+			extra = -extra
+		}
+		if b := bits.Len64(uint64(extra)); b > extraBits {
+			extraBits = b
+		}
+	}
+	template.SpatialOrderDifference = uint8(order)
+	template.OctetsNumber = uint8(extraBits/8 + 1)
+
+	packed := writer.New()
+	for _, extra := range extras {
+		packed.WriteInt(extra, int(template.OctetsNumber)*8)
+	}
+	if err := template.packGroups(packed, packedDifferences); err != nil {
+		return template, nil, err
+	}
+	return template, packed.Bytes(), nil
 }
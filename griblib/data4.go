@@ -0,0 +1,69 @@
+package griblib
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	// PrecisionFloat32 means that section 7 holds IEEE 32-bit floating-point values (Table 5.7)
+	PrecisionFloat32 = 1
+	// PrecisionFloat64 means that section 7 holds IEEE 64-bit floating-point values (Table 5.7)
+	PrecisionFloat64 = 2
+	// PrecisionFloat128 means that section 7 holds IEEE 128-bit floating-point values (Table 5.7)
+	PrecisionFloat128 = 3
+)
+
+// Data4 is a Grid point data - IEEE Floating Point Data
+// http://www.nco.ncep.noaa.gov/pmb/docs/grib2/grib2_doc/grib2_temp5-4.shtml
+//
+//	| Octet Number | Content
+//	-----------------------------------------------------------------------------------------
+//	| 12           | Precision (See Table 5.7)
+//	|              |    - 1 : IEEE 32-bit (I=4 in Section 7)
+//	|              |    - 2 : IEEE 64-bit (I=8 in Section 7)
+//	|              |    - 3 : IEEE 128-bit (I=16 in Section 7)
+//	|              |    - 4-254 : reserved
+//	|              |    - 255 : missing
+type Data4 struct {
+	Precision uint8 `json:"precision"`
+}
+
+// ParseData4 reads the IEEE floating-point values of section 7, most significant octet first.
+// 128-bit values are not supported.
+func ParseData4(dataReader io.Reader, dataLength int, template *Data4) ([]float64, error) {
+
+	fld := []float64{}
+
+	var size int
+	switch template.Precision {
+	case PrecisionFloat32:
+		size = 4
+	case PrecisionFloat64:
+		size = 8
+	default:
+		return fld, fmt.Errorf("IEEE floating point precision %d not supported", template.Precision)
+	}
+
+	if dataLength%size != 0 {
+		return fld, fmt.Errorf("Data length %d is not a multiple of the value size %d", dataLength, size)
+	}
+
+	rawData := make([]byte, dataLength)
+	if _, err := io.ReadFull(dataReader, rawData); err != nil {
+		return fld, err
+	}
+
+	fld = make([]float64, dataLength/size)
+	for i := range fld {
+		if size == 4 {
+			fld[i] = float64(math.Float32frombits(binary.BigEndian.Uint32(rawData[4*i:])))
+		} else {
+			fld[i] = math.Float64frombits(binary.BigEndian.Uint64(rawData[8*i:]))
+		}
+	}
+
+	return fld, nil
+}
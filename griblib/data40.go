@@ -0,0 +1,70 @@
+package griblib
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/nilsmagnus/grib/internal/jpeg2000"
+)
+
+// Data40 is a Grid point data - JPEG2000 code stream format
+// http://www.nco.ncep.noaa.gov/pmb/docs/grib2/grib2_doc/grib2_temp5-40.shtml
+//
+//	| Octet Number | Content
+//	-----------------------------------------------------------------------------------------
+//	| 12-15	     | Reference value (R) (IEEE 32-bit floating-point value)
+//	| 16-17	     | Binary scale factor (E)
+//	| 18-19	     | Decimal scale factor (D)
+//	| 20	         | Number of bits required to hold the resulting scaled and referenced data values
+//	| 21           | Type of original field values
+//	|              |    - 0 : Floating point
+//	|              |    - 1 : Integer
+//	|              |    - 2-191 : reserved
+//	|              |    - 192-254 : reserved for Local Use
+//	|              |    - 255 : missing
+//	| 22           | Type of Compression used (see Code Table 5.40)
+//	|              |    - 0 : Lossless
+//	|              |    - 1 : Lossy
+//	|              |    - 2-254 : reserved
+//	|              |    - 255 : missing
+//	| 23           | Target compression ratio, M:1 (with respect to the bit-depth specified in octet 20),
+//	|              | when octet 22 indicates Lossy Compression. Otherwise, set to missing
+type Data40 struct {
+	Data0
+	TypeOfCompression      uint8 `json:"typeOfCompression"`      // 22
+	TargetCompressionRatio uint8 `json:"targetCompressionRatio"` // 23
+}
+
+// ParseData40 decodes the JPEG2000 code stream of section 7 into an array of floating-point values
+func ParseData40(dataReader io.Reader, dataLength int, template *Data40) ([]float64, error) {
+
+	fld := []float64{}
+
+	// a constant field has no code stream, see ReadSection7
+	if dataLength == 0 || template.Bits == 0 {
+		return fld, nil
+	}
+
+	codestream := make([]byte, dataLength)
+	if _, err := io.ReadFull(dataReader, codestream); err != nil {
+		return fld, err
+	}
+
+	image, err := jpeg2000.Decode(codestream)
+	if err != nil {
+		return fld, err
+	}
+	if len(image.Components) != 1 {
+		return fld, fmt.Errorf("JPEG2000 code stream has %d components, expected 1", len(image.Components))
+	}
+
+	scaleStrategy := template.scaleFunc()
+
+	samples := image.Components[0].Samples
+	fld = make([]float64, len(samples))
+	for i, value := range samples {
+		fld[i] = scaleStrategy(value)
+	}
+
+	return fld, nil
+}
@@ -0,0 +1,140 @@
+package griblib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+)
+
+// Data41 is a Grid point data - Portable Network Graphics (PNG) format
+// http://www.nco.ncep.noaa.gov/pmb/docs/grib2/grib2_doc/grib2_temp5-41.shtml
+//
+//	| Octet Number | Content
+//	-----------------------------------------------------------------------------------------
+//	| 12-15	     | Reference value (R) (IEEE 32-bit floating-point value)
+//	| 16-17	     | Binary scale factor (E)
+//	| 18-19	     | Decimal scale factor (D)
+//	| 20	         | Number of bits required to hold the resulting scaled and referenced data values
+//	|              | (i.e. The depth of the grayscale image)
+//	| 21           | Type of original field values
+//	|              |    - 0 : Floating point
+//	|              |    - 1 : Integer
+//	|              |    - 2-191 : reserved
+//	|              |    - 192-254 : reserved for Local Use
+//	|              |    - 255 : missing
+type Data41 struct {
+	Data0
+}
+
+// ParseData41 decodes the PNG image of section 7 into an array of floating-point values.
+// Grayscale images of 1, 2, 4, 8 and 16 bits hold one value per pixel, 24 bit values are
+// packed in RGB pixels and 32 bit values in RGBA pixels, most significant octet first.
+func ParseData41(dataReader io.Reader, dataLength int, template *Data41) ([]float64, error) {
+
+	fld := []float64{}
+
+	// a constant field has no image, see ReadSection7
+	if dataLength == 0 || template.Bits == 0 {
+		return fld, nil
+	}
+
+	rawData := make([]byte, dataLength)
+	if _, err := io.ReadFull(dataReader, rawData); err != nil {
+		return fld, err
+	}
+
+	depth, err := pngDepth(rawData)
+	if err != nil {
+		return fld, err
+	}
+
+	img, err := png.Decode(bytes.NewReader(rawData))
+	if err != nil {
+		return fld, err
+	}
+
+	values, err := pngValues(img, depth)
+	if err != nil {
+		return fld, err
+	}
+
+	scaleStrategy := template.scaleFunc()
+
+	fld = make([]float64, len(values))
+	for i, value := range values {
+		fld[i] = scaleStrategy(value)
+	}
+
+	return fld, nil
+}
+
+// pngDepth returns the number of bits per pixel from the IHDR chunk of a PNG image
+func pngDepth(rawData []byte) (int, error) {
+	// 8 octets signature, 4 octets chunk length and "IHDR", width, height, bit depth, colour type
+	if len(rawData) < 26 || string(rawData[12:16]) != "IHDR" {
+		return 0, fmt.Errorf("PNG image without IHDR chunk")
+	}
+	bitDepth, colourType := int(rawData[24]), rawData[25]
+
+	switch {
+	case colourType == 0 && bitDepth <= 16:
+		return bitDepth, nil
+	case colourType == 2 && bitDepth == 8:
+		return 24, nil
+	case colourType == 6 && bitDepth == 8:
+		return 32, nil
+	}
+	return 0, fmt.Errorf("PNG colour type %d with bit depth %d not supported", colourType, bitDepth)
+}
+
+// pngValues returns the integer value of each pixel, in raster order
+func pngValues(img image.Image, depth int) ([]int64, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	values := make([]int64, 0, width*height)
+
+	switch pixels := img.(type) {
+	case *image.Gray:
+		// the decoder scales grayscale of less than 8 bits to the full range of an octet
+		divisor := int64(255 / (1<<uint(depth) - 1))
+		for y := 0; y < height; y++ {
+			for _, gray := range pixels.Pix[y*pixels.Stride : y*pixels.Stride+width] {
+				values = append(values, int64(gray)/divisor)
+			}
+		}
+	case *image.Gray16:
+		for y := 0; y < height; y++ {
+			row := pixels.Pix[y*pixels.Stride : y*pixels.Stride+2*width]
+			for x := 0; x < width; x++ {
+				values = append(values, int64(binary.BigEndian.Uint16(row[2*x:])))
+			}
+		}
+	case *image.RGBA:
+		values = appendRGBValues(values, pixels.Pix, pixels.Stride, width, height, depth)
+	case *image.NRGBA:
+		values = appendRGBValues(values, pixels.Pix, pixels.Stride, width, height, depth)
+	default:
+		return nil, fmt.Errorf("PNG image of type %T not supported", img)
+	}
+
+	return values, nil
+}
+
+// appendRGBValues appends the values packed in 8 bit RGB (depth 24) or RGBA (depth 32) pixels
+func appendRGBValues(values []int64, pix []byte, stride, width, height, depth int) []int64 {
+	for y := 0; y < height; y++ {
+		row := pix[y*stride : y*stride+4*width]
+		for x := 0; x < width; x++ {
+			r, g, b, a := int64(row[4*x]), int64(row[4*x+1]), int64(row[4*x+2]), int64(row[4*x+3])
+			if depth == 24 {
+				values = append(values, r<<16|g<<8|b)
+			} else {
+				values = append(values, r<<24|g<<16|b<<8|a)
+			}
+		}
+	}
+	return values
+}
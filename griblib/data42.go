@@ -0,0 +1,69 @@
+package griblib
+
+import (
+	"io"
+
+	"github.com/nilsmagnus/grib/internal/aec"
+)
+
+// Data42 is a Grid point data - CCSDS recommended lossless compression
+// http://www.nco.ncep.noaa.gov/pmb/docs/grib2/grib2_doc/grib2_temp5-42.shtml
+//
+//	| Octet Number | Content
+//	-----------------------------------------------------------------------------------------
+//	| 12-15	     | Reference value (R) (IEEE 32-bit floating-point value)
+//	| 16-17	     | Binary scale factor (E)
+//	| 18-19	     | Decimal scale factor (D)
+//	| 20	         | Number of bits required to hold the resulting scaled and referenced data values
+//	| 21           | Type of original field values
+//	|              |    - 0 : Floating point
+//	|              |    - 1 : Integer
+//	|              |    - 2-191 : reserved
+//	|              |    - 192-254 : reserved for Local Use
+//	|              |    - 255 : missing
+//	| 22           | CCSDS compression options mask
+//	| 23           | Block size
+//	| 24-25        | Reference sample interval
+type Data42 struct {
+	Data0
+	CompressionOptionsMask  uint8  `json:"compressionOptionsMask"`  // 22
+	BlockSize               uint8  `json:"blockSize"`               // 23
+	ReferenceSampleInterval uint16 `json:"referenceSampleInterval"` // 24-25
+}
+
+// ParseData42 decodes the Adaptive Entropy Coded values of section 7 into an array of
+// floating-point values. The coded stream does not tell how many values it holds, so
+// pointsNumber (octets 6-9 of section 5) values are decoded.
+func ParseData42(dataReader io.Reader, dataLength int, template *Data42, pointsNumber int) ([]float64, error) {
+
+	fld := []float64{}
+
+	// a constant field has no coded values, see ReadSection7
+	if dataLength == 0 || template.Bits == 0 {
+		return fld, nil
+	}
+
+	rawData := make([]byte, dataLength)
+	if _, err := io.ReadFull(dataReader, rawData); err != nil {
+		return fld, err
+	}
+
+	values, err := aec.Decode(rawData, pointsNumber, aec.Params{
+		BitsPerSample: int(template.Bits),
+		BlockSize:     int(template.BlockSize),
+		RSI:           int(template.ReferenceSampleInterval),
+		Flags:         int(template.CompressionOptionsMask),
+	})
+	if err != nil {
+		return fld, err
+	}
+
+	scaleStrategy := template.scaleFunc()
+
+	fld = make([]float64, len(values))
+	for i, value := range values {
+		fld[i] = scaleStrategy(value)
+	}
+
+	return fld, nil
+}
@@ -0,0 +1,91 @@
+package griblib
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The errors returned when reading messages, wrapped with the context they occurred in. Check for them
+// with errors.Is:
+//
+//	if errors.Is(err, griblib.ErrTruncatedMessage) {
+//		// the download was interrupted
+//	}
+var (
+	// ErrTruncatedMessage is returned when a message ends before its length or before its sections,
+	// see TruncatedMessageError for the former
+	ErrTruncatedMessage = errors.New("Truncated message")
+	// ErrBadIndicator is returned when section 0 does not start with 'GRIB' or holds an invalid length
+	ErrBadIndicator = errors.New("Bad indicator section")
+	// ErrUnsupportedEdition is returned for messages of other editions than GRIB2, like GRIB1 messages
+	ErrUnsupportedEdition = errors.New("Unsupported grib edition")
+	// ErrMissingEndSection is returned when a message does not end with '7777'
+	ErrMissingEndSection = errors.New("Missing end section 7777")
+	// ErrCorruptData is returned when a message contradicts itself, like a section shorter than its head
+	// or packed data that does not match the data representation of section 5
+	ErrCorruptData = errors.New("Corrupt data")
+)
+
+// TruncatedMessageError is returned when the file ends in the middle of a message. It matches both
+// ErrTruncatedMessage and io.ErrUnexpectedEOF with errors.Is.
+type TruncatedMessageError struct {
+	Offset int64 // offset of the message in the file
+	Length int64 // octets expected, the length of the message or of section 0 if it is not complete
+	Read   int64 // octets read before the end of the file
+}
+
+func (e *TruncatedMessageError) Error() string {
+	return fmt.Sprintf("Message at offset %d is truncated, read %d of %d octets", e.Offset, e.Read, e.Length)
+}
+
+// Is reports whether target is ErrTruncatedMessage
+func (e *TruncatedMessageError) Is(target error) bool {
+	return target == ErrTruncatedMessage
+}
+
+// Unwrap returns io.ErrUnexpectedEOF
+func (e *TruncatedMessageError) Unwrap() error {
+	return io.ErrUnexpectedEOF
+}
+
+// ErrUnsupportedTemplate is returned for a template that can not be read or written, like a data
+// representation template (section 5) for which there is no decoder. Check for it with errors.As:
+//
+//	var unsupported griblib.ErrUnsupportedTemplate
+//	if errors.As(err, &unsupported) && unsupported.Section == 5 {
+//		// skip the message
+//	}
+type ErrUnsupportedTemplate struct {
+	Section int // 3 for grid definitions, 4 for product definitions and 5 for data representations
+	Number  int // the template number
+}
+
+func (e ErrUnsupportedTemplate) Error() string {
+	switch e.Section {
+	case 3:
+		return fmt.Sprintf("Grid definition template %d not supported", e.Number)
+	case 4:
+		return fmt.Sprintf("Product definition template %d not supported", e.Number)
+	case 5:
+		return fmt.Sprintf("Data representation template %d not supported", e.Number)
+	}
+	return fmt.Sprintf("Template %d of section %d not supported", e.Number, e.Section)
+}
+
+// Warning reports octets of a file that were skipped while reading it with ReadOptions.Tolerant, because
+// they did not hold a message or the message could not be read
+type Warning struct {
+	Offset int64 // offset of the skipped octets in the file
+	Length int64 // number of skipped octets
+	Err    error // why they were skipped
+}
+
+func (w Warning) Error() string {
+	return fmt.Sprintf("Skipped %d octets at offset %d: %s", w.Length, w.Offset, w.Err.Error())
+}
+
+// Unwrap returns the reason the octets were skipped
+func (w Warning) Unwrap() error {
+	return w.Err
+}
@@ -22,42 +22,81 @@ const (
 
 // Export exports messages to the supported formats
 func Export(messages []*Message, options Options) {
+	exporter, ok := newExporter(options)
+	if !ok {
+		return
+	}
+	for _, message := range messages {
+		exporter.export(message)
+	}
+	exporter.close()
+}
+
+// ExportScanner exports the messages of scanner that pass FilterMessage, one message at a time.
+// It returns the error of the scanner, if any. With ReadOptions.Tolerant, the messages whose data can
+// not be decoded are not exported, Scanner.Warnings reports them.
+func ExportScanner(scanner *Scanner, options Options) error {
+	exporter, ok := newExporter(options)
+	if !ok {
+		return nil
+	}
+	exporter.tolerant = scanner.reader.options.Tolerant
+	for scanner.Next() {
+		if message := scanner.Message(); FilterMessage(message, options) {
+			exporter.export(message)
+		}
+	}
+	exporter.close()
+	return scanner.Err()
+}
+
+// exporter exports messages one by one
+type exporter struct {
+	exportType int
+	count      int
+	tolerant   bool // skip the messages that can not be decoded
+}
+
+func newExporter(options Options) (*exporter, bool) {
 	switch options.ExportType {
-	case ExportNone:
-	case PrintMessageDisciplines:
-		printDisciplines(messages)
-	case PrintMessageCategories:
-		printCategories(messages)
+	case ExportNone, PrintMessageDisciplines, PrintMessageCategories, ExportToPNG:
 	case ExportJSONToConsole:
-		exportJSONConsole(messages)
-	case ExportToPNG:
-		ExportMessagesAsPngs(messages)
+		log.Println("[")
 	default:
 		log.Printf("Error: Export type %d not supported. \n", options.ExportType)
+		return nil, false
 	}
+	return &exporter{exportType: options.ExportType}, true
 }
 
-func printDisciplines(messages []*Message) {
-	for _, message := range messages {
-		log.Println(DisciplineDescription(message.Section0.Discipline))
+func (e *exporter) export(message *Message) {
+	needsData := e.exportType == ExportJSONToConsole || e.exportType == ExportToPNG
+	if e.tolerant && needsData && message.Decode() != nil {
+		return
 	}
-}
-
-func printCategories(messages []*Message) {
-	for _, m := range messages {
-		category := m.Section4.ProductDefinitionTemplate.ParameterCategory
-		discipline := m.Section0.Discipline
+	switch e.exportType {
+	case PrintMessageDisciplines:
+		log.Println(DisciplineDescription(message.Section0.Discipline))
+	case PrintMessageCategories:
+		category := message.Section4.ProductDefinitionTemplate.ParameterCategory
+		discipline := message.Section0.Discipline
 		log.Println(ReadProductDisciplineParameters(discipline, category))
+	case ExportJSONToConsole:
+		if err := message.Decode(); err != nil {
+			loggerOrDiscard(message.logger).Error("Error decoding data", "error", err)
+		}
+		export(message)
+		log.Println(",")
+	case ExportToPNG:
+		exportMessageAsPng(e.count, message)
 	}
+	e.count++
 }
 
-func exportJSONConsole(messages []*Message) {
-	log.Println("[")
-	for _, message := range messages {
-		export(message)
-		log.Println(",")
+func (e *exporter) close() {
+	if e.exportType == ExportJSONToConsole {
+		log.Println("]")
 	}
-	log.Println("]")
 }
 
 func export(m *Message) {
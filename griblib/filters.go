@@ -2,7 +2,6 @@ package griblib
 
 import (
 	"fmt"
-	"log"
 	"math"
 	"reflect"
 )
@@ -40,27 +39,7 @@ func Filter(messages []*Message, options Options) []*Message {
 	filtered := make([]*Message, 0)
 
 	for _, message := range messages {
-		discipline := satisfiesDiscipline(options.Discipline, message)
-		category := satisfiesCategory(options.Category, message)
-		surface := satisfiesSurface(options.Surface, message)
-		if !surface || !discipline || !category {
-			continue
-		}
-		if !isEmpty(options.GeoFilter) {
-			log.Printf("Using GeoFilter %v\n", options.GeoFilter)
-			if data, err := FilterValuesFromGeoFilter(message, options.GeoFilter); err == nil {
-				message.Section7.Data = *data
-				if grid0, ok := message.Section3.Definition.(*Grid0); ok {
-					updatedGrid := filteredGrid(grid0, options.GeoFilter)
-					message.Section3.Definition = updatedGrid
-					message.Section3.DataPointCount = uint32(len(*data))
-				}
-
-			} else {
-				log.Println(err.Error())
-			}
-		}
-		if discipline && category {
+		if FilterMessage(message, options) {
 			filtered = append(filtered, message)
 		}
 	}
@@ -68,6 +47,56 @@ func Filter(messages []*Message, options Options) []*Message {
 	return filtered
 
 }
+
+// FilterMessage tells if message satisfies the discipline, category, parameters, surface and forecast times of options.
+// The GeoFilter of options is applied to the data and grid of a satisfying message. A GeoFilter that can not be
+// applied is logged to the ReadOptions.Logger the message was read with.
+func FilterMessage(message *Message, options Options) bool {
+	if !satisfiesHeaders(message, options) {
+		return false
+	}
+	if !isEmpty(options.GeoFilter) {
+		logger := loggerOrDiscard(message.logger)
+		logger.Debug("Using GeoFilter", "geoFilter", options.GeoFilter)
+		if data, err := FilterValuesFromGeoFilter(message, options.GeoFilter); err == nil {
+			message.Section7.Data = *data
+			message.Section7.Missing = filterMissing(message, options.GeoFilter)
+			if grid0, ok := message.Section3.Definition.(*Grid0); ok {
+				updatedGrid := filteredGrid(grid0, options.GeoFilter)
+				message.Section3.Definition = updatedGrid
+				message.Section3.DataPointCount = uint32(len(*data))
+			}
+
+		} else {
+			logger.Warn("GeoFilter not applied", "error", err)
+		}
+	}
+	return true
+}
+
+// satisfiesHeaders tells if the header sections of message satisfy options, the data is not used
+func satisfiesHeaders(message *Message, options Options) bool {
+	product := message.Section4.ProductDefinitionTemplate
+	return satisfiesDiscipline(options.Discipline, message) &&
+		satisfiesCategory(options.Category, message) &&
+		satisfiesAny(options.Parameters, int(product.ParameterNumber)) &&
+		satisfiesSurface(options.Surface, message) &&
+		satisfiesAny(options.ForecastTimes, int(product.ForecastTime))
+}
+
+// satisfiesAny tells if value is one of values, an empty list is satisfied by all values
+func satisfiesAny(values []int, value int) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 func satisfiesSurface(s Surface, message *Message) bool {
 	return s == Surface{} || s.Type == 255 ||
 		(message.Section4.ProductDefinitionTemplate.FirstSurface.Type == s.Type &&
@@ -96,6 +125,11 @@ func isEmpty(geoFilter GeoFilter) bool {
 
 // FilterValuesFromGeoFilter ...
 func FilterValuesFromGeoFilter(message *Message, filter GeoFilter) (*[]float64, error) {
+	// the data is decoded first, a quasi-regular grid may be regularized by it
+	if err := message.Decode(); err != nil {
+		return &message.Section7.Data, err
+	}
+	values := message.Section7.Data
 	grid0, ok := message.Section3.Definition.(*Grid0)
 	if ok {
 		startNi, stopNi, startNj, stopNj := StartStopIndexes(filter, *grid0)
@@ -105,7 +139,7 @@ func FilterValuesFromGeoFilter(message *Message, filter GeoFilter) (*[]float64,
 		filteredIndex := 0
 		for j := startNj; j < stopNj; j++ {
 			for i := startNi; i < stopNi; i++ {
-				data[filteredIndex] = message.Section7.Data[j*grid0.Nj+i]
+				data[filteredIndex] = values[j*grid0.Ni+i]
 				filteredIndex++
 			}
 		}
@@ -114,6 +148,24 @@ func FilterValuesFromGeoFilter(message *Message, filter GeoFilter) (*[]float64,
 	return &message.Section7.Data, fmt.Errorf("grid not of wanted type (wanted Grid0), was %v", reflect.TypeOf(message.Section3.Definition))
 }
 
+// filterMissing cuts the missing mask of section 7 like FilterValuesFromGeoFilter cuts the values
+func filterMissing(message *Message, filter GeoFilter) []uint8 {
+	grid0, ok := message.Section3.Definition.(*Grid0)
+	missing := message.Section7.Missing
+	if !ok || missing == nil {
+		return missing
+	}
+	startNi, stopNi, startNj, stopNj := StartStopIndexes(filter, *grid0)
+
+	filtered := make([]uint8, 0, (stopNi-startNi)*(stopNj-startNj))
+	for j := startNj; j < stopNj; j++ {
+		for i := startNi; i < stopNi; i++ {
+			filtered = append(filtered, missing[j*grid0.Ni+i])
+		}
+	}
+	return filtered
+}
+
 // StartStopIndexes ...
 func StartStopIndexes(filter GeoFilter, grid Grid0) (uint32, uint32, uint32, uint32) {
 
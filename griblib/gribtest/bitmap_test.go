@@ -0,0 +1,161 @@
+package gribtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/nilsmagnus/grib/griblib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_expand_bitmap(t *testing.T) {
+	section6 := griblib.Section6{BitmapIndicator: griblib.BitmapApplies, Bitmap: []byte{0xA0}}
+
+	expanded, err := section6.Expand([]float64{1, 2}, 4, -1)
+
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1, -1, 2, -1}, expanded)
+}
+
+func Test_expand_without_bitmap(t *testing.T) {
+	section6 := griblib.Section6{BitmapIndicator: griblib.BitmapNone}
+
+	expanded, err := section6.Expand([]float64{1, 2}, 4, -1)
+
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1, 2}, expanded)
+}
+
+func Test_expand_bitmap_value_count_mismatch(t *testing.T) {
+	section6 := griblib.Section6{BitmapIndicator: griblib.BitmapApplies, Bitmap: []byte{0xA0}}
+
+	_, err := section6.Expand([]float64{1, 2, 3}, 4, -1)
+
+	assert.Error(t, err)
+}
+
+func Test_bitmap_fills_full_grid(t *testing.T) {
+	messages := openGrib(t, "../integrationtestdata/gfs.t00z.pgrb2.2p50.f000")
+
+	bitmapped := 0
+	for _, m := range messages {
+		require.Len(t, m.Data(), int(m.Section3.DataPointCount))
+
+		if m.Section6.BitmapIndicator == griblib.BitmapApplies {
+			bitmapped++
+			assert.Equal(t, int(m.Section3.DataPointCount-m.Section5.PointsNumber), countNaN(m.Data()))
+		}
+	}
+	assert.NotZero(t, bitmapped, "testfile should contain messages with a bitmap")
+}
+
+func Test_bitmap_fill_value(t *testing.T) {
+	testFile, err := os.Open("../integrationtestdata/gfs.t00z.pgrb2.2p50.f000")
+	require.NoError(t, err)
+	defer testFile.Close()
+
+	options := griblib.DefaultReadOptions()
+	options.BitmapFill = 9999
+	messages, err := griblib.ReadMessagesWithOptions(testFile, options)
+	require.NoError(t, err)
+
+	for _, m := range messages {
+		assert.Zero(t, countNaN(m.Data()))
+	}
+}
+
+func Test_previously_defined_bitmap(t *testing.T) {
+	raw, err := os.ReadFile("../integrationtestdata/gfs.t00z.pgrb2.2p50.f000")
+	require.NoError(t, err)
+
+	// find two consecutive messages using the same bitmap
+	chunks := splitMessages(t, raw)
+	first := -1
+	for i := 0; i+1 < len(chunks); i++ {
+		b1, ok1 := bitmapSection(chunks[i])
+		b2, ok2 := bitmapSection(chunks[i+1])
+		if ok1 && ok2 && bytes.Equal(b1, b2) {
+			first = i
+			break
+		}
+	}
+	require.NotEqual(t, -1, first, "testfile should contain two messages with the same bitmap")
+
+	expected, err := griblib.ReadMessages(bytes.NewReader(append(append([]byte{}, chunks[first]...), chunks[first+1]...)))
+	require.NoError(t, err)
+
+	second := replaceBitmap(chunks[first+1], griblib.BitmapPreviouslyDefined)
+	messages, err := griblib.ReadMessages(bytes.NewReader(append(append([]byte{}, chunks[first]...), second...)))
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+
+	assert.Equal(t, uint8(griblib.BitmapPreviouslyDefined), messages[1].Section6.BitmapIndicator)
+	assert.Equal(t, countNaN(expected[1].Data()), countNaN(messages[1].Data()))
+	assert.Len(t, messages[1].Data(), len(expected[1].Data()))
+
+	_, err = griblib.ReadMessage(bytes.NewReader(second))
+	assert.Error(t, err, "a single message can not refer to a previously defined bitmap")
+}
+
+func countNaN(values []float64) int {
+	count := 0
+	for _, v := range values {
+		if math.IsNaN(v) {
+			count++
+		}
+	}
+	return count
+}
+
+// splitMessages splits a grib file into the raw bytes of each message
+func splitMessages(t *testing.T, raw []byte) [][]byte {
+	t.Helper()
+	var chunks [][]byte
+	for len(raw) >= 16 {
+		length := binary.BigEndian.Uint64(raw[8:16])
+		require.LessOrEqual(t, length, uint64(len(raw)))
+		chunks = append(chunks, raw[:length])
+		raw = raw[length:]
+	}
+	return chunks
+}
+
+// sections returns the offset of each section (1-7) in a raw message
+func sections(message []byte) map[uint8]int {
+	offsets := map[uint8]int{}
+	for offset := 16; offset+5 <= len(message); {
+		length := int(binary.BigEndian.Uint32(message[offset:]))
+		if string(message[offset:offset+4]) == "7777" {
+			break
+		}
+		offsets[message[offset+4]] = offset
+		offset += length
+	}
+	return offsets
+}
+
+// bitmapSection returns the bitmap of a raw message, if the message defines one
+func bitmapSection(message []byte) ([]byte, bool) {
+	offset := sections(message)[6]
+	length := int(binary.BigEndian.Uint32(message[offset:]))
+	if message[offset+5] != griblib.BitmapApplies {
+		return nil, false
+	}
+	return message[offset+6 : offset+length], true
+}
+
+// replaceBitmap replaces the bitmap section of a raw message with an empty section with the given indicator
+func replaceBitmap(message []byte, indicator uint8) []byte {
+	offset := sections(message)[6]
+	length := int(binary.BigEndian.Uint32(message[offset:]))
+
+	replaced := append([]byte{}, message[:offset]...)
+	replaced = append(replaced, 0, 0, 0, 6, 6, indicator)
+	replaced = append(replaced, message[offset+length:]...)
+	binary.BigEndian.PutUint64(replaced[8:16], uint64(len(replaced)))
+	return replaced
+}
@@ -0,0 +1,143 @@
+package gribtest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/nilsmagnus/grib/griblib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// smoothField returns a field like a temperature field, smooth with a few spikes
+func smoothField(count int) []float64 {
+	random := rand.New(rand.NewSource(1))
+	values := make([]float64, count)
+	for i := range values {
+		values[i] = 273.15 + 20*math.Sin(float64(i)/50) + random.Float64()
+		if i%997 == 0 {
+			values[i] += 300
+		}
+	}
+	return values
+}
+
+func Test_pack_data2_round_trip(t *testing.T) {
+	values := smoothField(10000)
+	options := griblib.WriteOptions{DecimalScale: 2}
+
+	template, packed, err := griblib.PackData2(values, options)
+	require.NoError(t, err)
+	assert.Greater(t, template.NG, uint32(1))
+
+	unpacked, err := griblib.ParseData2(bytes.NewReader(packed), len(packed), &template)
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, values, unpacked, 0.005001)
+
+	// the spikes do not widen every group
+	_, simple, err := griblib.PackData0(values, options)
+	require.NoError(t, err)
+	assert.Less(t, len(packed), len(simple))
+}
+
+func Test_pack_data3_round_trip(t *testing.T) {
+	values := smoothField(10000)
+	options := griblib.WriteOptions{DecimalScale: 2}
+	_, complexPacked, err := griblib.PackData2(values, options)
+	require.NoError(t, err)
+
+	for _, order := range []int{1, 2} {
+		template, packed, err := griblib.PackData3(values, options, order)
+		require.NoError(t, err)
+		assert.Equal(t, uint8(order), template.SpatialOrderDifference)
+
+		unpacked, err := griblib.ParseData3(bytes.NewReader(packed), len(packed), &template)
+		require.NoError(t, err, "order %d", order)
+		assert.InDeltaSlice(t, values, unpacked, 0.005001, "order %d", order)
+		assert.Less(t, len(packed), len(complexPacked), "order %d", order)
+	}
+}
+
+func Test_pack_data3_short_fields(t *testing.T) {
+	for _, values := range [][]float64{{1.5}, {1.5, -2}, {1.5, -2, 7}, {3, 3, 3, 3}} {
+		for _, order := range []int{1, 2} {
+			template, packed, err := griblib.PackData3(values, griblib.WriteOptions{DecimalScale: 1}, order)
+			require.NoError(t, err)
+
+			unpacked, err := griblib.ParseData3(bytes.NewReader(packed), len(packed), &template)
+			require.NoError(t, err, "%v order %d", values, order)
+			assert.InDeltaSlice(t, values, unpacked, 1e-9, "%v order %d", values, order)
+		}
+	}
+}
+
+func Test_pack_complex_errors(t *testing.T) {
+	_, _, err := griblib.PackData2(nil, griblib.WriteOptions{})
+	assert.Error(t, err, "an empty field can not be split in groups")
+	_, _, err = griblib.PackData3([]float64{1, 2}, griblib.WriteOptions{}, 3)
+	assert.Error(t, err, "order 3 does not exist")
+	_, _, err = griblib.PackData3([]float64{1, math.NaN()}, griblib.WriteOptions{}, 1)
+	assert.Error(t, err)
+}
+
+func Test_write_message_complex_packing(t *testing.T) {
+	message := openGrib(t, "../integrationtestdata/template5_0.grib2")[0]
+	var simple bytes.Buffer
+	require.NoError(t, griblib.WriteMessage(&simple, message))
+
+	for _, dataTemplate := range []int{2, 3} {
+		options := griblib.DefaultWriteOptions(message)
+		options.DataTemplate = dataTemplate
+		var written bytes.Buffer
+		require.NoError(t, griblib.WriteMessageWithOptions(&written, message, options))
+		read, err := griblib.ReadMessages(bytes.NewReader(written.Bytes()))
+		require.NoError(t, err)
+
+		assert.Equal(t, uint16(dataTemplate), read[0].Section5.DataTemplateNumber)
+		precision := 0.5 * math.Pow10(-options.DecimalScale)
+		assert.InDeltaSlice(t, message.Data(), read[0].Data(), precision*1.001, "template %d", dataTemplate)
+		assert.Less(t, written.Len(), simple.Len(), "template %d", dataTemplate)
+	}
+
+	options := griblib.DefaultWriteOptions(message)
+	options.DataTemplate = 1
+	assert.Error(t, griblib.WriteMessageWithOptions(&bytes.Buffer{}, message, options))
+}
+
+func Test_parse_corrupt_complex_packing(t *testing.T) {
+	values := smoothField(1000)
+	template, packed, err := griblib.PackData3(values, griblib.WriteOptions{DecimalScale: 2}, 2)
+	require.NoError(t, err)
+
+	corruptions := map[string]func(template *griblib.Data3, points *int){
+		"no groups":               func(template *griblib.Data3, points *int) { template.NG = 0 },
+		"more groups than values": func(template *griblib.Data3, points *int) { template.NG = 1 << 31 },
+		"groups beyond the data":  func(template *griblib.Data3, points *int) { template.NG = uint32(*points) },
+		"wide group parameters":   func(template *griblib.Data3, points *int) { template.GroupWidthsBits = 200 },
+		"wide groups":             func(template *griblib.Data3, points *int) { template.GroupWidths = 100 },
+		"long last group":         func(template *griblib.Data3, points *int) { template.GroupLastLength += 1000 },
+		"more values":             func(template *griblib.Data3, points *int) { *points++ },
+		"wide values":             func(template *griblib.Data3, points *int) { template.Bits = 65 },
+		"order 3":                 func(template *griblib.Data3, points *int) { template.SpatialOrderDifference = 3 },
+		"order 2 of one value":    func(template *griblib.Data3, points *int) { *points = 1 },
+		"wide extra values":       func(template *griblib.Data3, points *int) { template.OctetsNumber = 9 },
+	}
+	for name, corrupt := range corruptions {
+		t.Run(name, func(t *testing.T) {
+			corrupted, points := template, len(values)
+			corrupt(&corrupted, &points)
+			_, err := griblib.ReadSection7(bytes.NewReader(packed), len(packed), dataSection5(t, 3, corrupted, points))
+			assert.True(t, errors.Is(err, griblib.ErrCorruptData), err)
+		})
+	}
+
+	t.Run("short data", func(t *testing.T) {
+		corrupted := template
+		_, err := griblib.ParseData3(bytes.NewReader(packed[:len(packed)/2]), len(packed), &corrupted)
+		assert.True(t, errors.Is(err, io.ErrUnexpectedEOF), err)
+	})
+}
@@ -0,0 +1,84 @@
+package gribtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/nilsmagnus/grib/griblib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_read40_integrationtest_file_hour0(t *testing.T) {
+	messages := openGrib(t, "../integrationtestdata/template5_40.grib2")
+
+	assert.Len(t, messages, 2, "should have exactly 2 messages in testfile")
+
+	assert.Equal(t, uint16(40), messages[0].Section5.DataTemplateNumber, "Data template number should be 40")
+
+	for i, csv := range []string{"template_ugrd.csv", "template_vgrd.csv"} {
+		fixtures := openCsv(t, "../integrationtestdata/"+csv)
+
+		assert.Len(t, messages[i].Data(), len(fixtures))
+
+		assert.InEpsilonSlice(t, fixtures, messages[i].Data(), 1e-5)
+	}
+}
+
+func Test_read40_constant_field(t *testing.T) {
+	raw, err := os.ReadFile("../integrationtestdata/template5_40.grib2")
+	require.NoError(t, err)
+	message := splitMessages(t, raw)[0]
+
+	// zero bits per value and an empty section 7 make a constant field
+	offsets := sections(message)
+	constant := append([]byte{}, message[:offsets[7]]...)
+	constant[offsets[5]+19] = 0
+	constant = append(constant, 0, 0, 0, 5, 7)
+	constant = append(constant, "7777"...)
+	binary.BigEndian.PutUint64(constant[8:16], uint64(len(constant)))
+
+	messages, err := griblib.ReadMessages(bytes.NewReader(constant))
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+
+	template, err := messages[0].Section5.GetDataTemplate()
+	require.NoError(t, err)
+	data40 := template.(griblib.Data40)
+	reference := float64(data40.Reference) * math.Pow(10, -float64(data40.DecimalScale))
+
+	require.Len(t, messages[0].Data(), int(messages[0].Section3.DataPointCount))
+	for _, value := range messages[0].Data() {
+		assert.Equal(t, reference, value)
+	}
+}
+
+// openExternalFixture reads name.grib2, packed by an external tool, and the values of all its messages as decoded by
+// that tool from name.csv. The test is skipped if the files, described in REDME.md, are not in integrationtestdata.
+func openExternalFixture(t *testing.T, name string) ([]*griblib.Message, []float64) {
+	t.Helper()
+	path := "../integrationtestdata/" + name
+	if _, err := os.Stat(path + ".grib2"); errors.Is(err, fs.ErrNotExist) {
+		t.Skipf("%s.grib2 is not in integrationtestdata, see REDME.md", name)
+	}
+	return openGrib(t, path+".grib2"), openCsv(t, path+".csv")
+}
+
+func Test_read40_wgrib2_file(t *testing.T) {
+	// the code streams of template5_40.grib2 come from our own test encoder, this file is packed by wgrib2
+	messages, fixtures := openExternalFixture(t, "template5_40_wgrib2")
+
+	var data []float64
+	for _, message := range messages {
+		assert.Equal(t, uint16(40), message.Section5.DataTemplateNumber)
+		data = append(data, message.Data()...)
+	}
+	// wgrib2 writes the values with 6 significant digits
+	require.Len(t, data, len(fixtures))
+	assert.InDeltaSlice(t, fixtures, data, 1e-4)
+}
@@ -0,0 +1,155 @@
+package gribtest
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/nilsmagnus/grib/griblib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parse41_bit_depths(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for _, depth := range []int{1, 2, 4, 8, 16, 24, 32} {
+		values := make([]uint64, 7*5)
+		expected := make([]float64, len(values))
+		for i := range values {
+			values[i] = random.Uint64() & (1<<uint(depth) - 1)
+			expected[i] = float64(values[i])
+		}
+		image := encodePNG(t, 7, 5, depth, values)
+
+		template := griblib.Data41{Data0: griblib.Data0{Bits: uint8(depth)}}
+		fld, err := griblib.ParseData41(bytes.NewReader(image), len(image), &template)
+
+		require.NoError(t, err, "depth %d", depth)
+		assert.Equal(t, expected, fld, "depth %d", depth)
+	}
+}
+
+func Test_parse41_scaling(t *testing.T) {
+	image := encodePNG(t, 3, 1, 8, []uint64{0, 1, 200})
+
+	// R = 10, E = 1, D = 1: values are (10 + X * 2) / 10
+	template := griblib.Data41{Data0: griblib.Data0{Reference: 10, BinaryScale: 1, DecimalScale: 1, Bits: 8}}
+	fld, err := griblib.ParseData41(bytes.NewReader(image), len(image), &template)
+
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, []float64{1, 1.2, 41}, fld, 1e-9)
+}
+
+func Test_parse41_corrupt_image(t *testing.T) {
+	image := encodePNG(t, 3, 1, 8, []uint64{0, 1, 200})
+	image[len(image)/2] ^= 0xFF
+
+	template := griblib.Data41{Data0: griblib.Data0{Bits: 8}}
+	_, err := griblib.ParseData41(bytes.NewReader(image), len(image), &template)
+
+	assert.Error(t, err)
+}
+
+func Test_read41_message(t *testing.T) {
+	raw, err := os.ReadFile("../integrationtestdata/template5_0.grib2")
+	require.NoError(t, err)
+	message := splitMessages(t, raw)[0]
+
+	expected, err := griblib.ReadMessages(bytes.NewReader(message))
+	require.NoError(t, err)
+
+	messages, err := griblib.ReadMessages(bytes.NewReader(simpleToPNG(t, message)))
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+
+	assert.Equal(t, uint16(41), messages[0].Section5.DataTemplateNumber)
+	assert.Equal(t, expected[0].Data(), messages[0].Data())
+}
+
+// simpleToPNG converts a raw message packed with template 5.0 to template 5.41, as a 16 bit grayscale image
+func simpleToPNG(t *testing.T, message []byte) []byte {
+	t.Helper()
+	offsets := sections(message)
+	section5, section7 := offsets[5], offsets[7]
+	width := int(binary.BigEndian.Uint32(message[offsets[3]+30:]))
+	height := int(binary.BigEndian.Uint32(message[offsets[3]+34:]))
+	bits := int(message[section5+19])
+	require.LessOrEqual(t, bits, 16)
+
+	packed := message[section7+5 : section7+int(binary.BigEndian.Uint32(message[section7:]))]
+	values := make([]uint64, width*height)
+	for i := range values {
+		for b := i * bits; b < (i+1)*bits; b++ {
+			values[i] = values[i]<<1 | uint64(packed[b/8]>>(7-uint(b%8))&1)
+		}
+	}
+
+	converted := append([]byte{}, message[:section7]...)
+	binary.BigEndian.PutUint16(converted[section5+9:], 41)
+	converted[section5+19] = 16
+	image := encodePNG(t, width, height, 16, values)
+	converted = binary.BigEndian.AppendUint32(converted, uint32(5+len(image)))
+	converted = append(converted, 7)
+	converted = append(converted, image...)
+	converted = append(converted, "7777"...)
+	binary.BigEndian.PutUint64(converted[8:16], uint64(len(converted)))
+	return converted
+}
+
+// encodePNG writes values as a PNG image the way GRIB encoders do: grayscale up to 16 bits,
+// 8 bit RGB for 24 bits and 8 bit RGBA for 32 bits
+func encodePNG(t *testing.T, width, height, depth int, values []uint64) []byte {
+	t.Helper()
+	bitDepth, colourType := depth, byte(0)
+	switch depth {
+	case 24:
+		bitDepth, colourType = 8, 2
+	case 32:
+		bitDepth, colourType = 8, 6
+	}
+
+	var scanlines bytes.Buffer
+	for y := 0; y < height; y++ {
+		var row []byte
+		var buffer uint64
+		count := 0
+		for _, value := range values[y*width : (y+1)*width] {
+			buffer = buffer<<uint(depth) | value
+			count += depth
+			for count >= 8 {
+				row = append(row, byte(buffer>>uint(count-8)))
+				count -= 8
+			}
+		}
+		if count > 0 {
+			row = append(row, byte(buffer<<uint(8-count)))
+		}
+		scanlines.WriteByte(0) // filter type none
+		scanlines.Write(row)
+	}
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	_, err := writer.Write(scanlines.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	image := []byte("\x89PNG\r\n\x1a\n")
+	chunk := func(chunkType string, data []byte) {
+		image = binary.BigEndian.AppendUint32(image, uint32(len(data)))
+		start := len(image)
+		image = append(image, chunkType...)
+		image = append(image, data...)
+		image = binary.BigEndian.AppendUint32(image, crc32.ChecksumIEEE(image[start:]))
+	}
+	header := binary.BigEndian.AppendUint32(nil, uint32(width))
+	header = binary.BigEndian.AppendUint32(header, uint32(height))
+	header = append(header, byte(bitDepth), colourType, 0, 0, 0)
+	chunk("IHDR", header)
+	chunk("IDAT", compressed.Bytes())
+	chunk("IEND", nil)
+	return image
+}
@@ -0,0 +1,61 @@
+package gribtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/nilsmagnus/grib/griblib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_read42_integrationtest_file_hour0(t *testing.T) {
+	messages := openGrib(t, "../integrationtestdata/template5_42.grib2")
+
+	assert.Len(t, messages, 2, "should have exactly 2 messages in testfile")
+
+	template, err := messages[0].Section5.GetDataTemplate()
+	require.NoError(t, err)
+	data42 := template.(griblib.Data42)
+	assert.Equal(t, uint8(32), data42.BlockSize)
+	assert.Equal(t, uint16(128), data42.ReferenceSampleInterval)
+
+	for i, csv := range []string{"template_ugrd.csv", "template_vgrd.csv"} {
+		fixtures := openCsv(t, "../integrationtestdata/"+csv)
+
+		assert.Len(t, messages[i].Data(), len(fixtures))
+
+		assert.InEpsilonSlice(t, fixtures, messages[i].Data(), 1e-5)
+	}
+}
+
+func Test_read42_truncated_data(t *testing.T) {
+	raw, err := os.ReadFile("../integrationtestdata/template5_42.grib2")
+	require.NoError(t, err)
+	message := splitMessages(t, raw)[0]
+
+	offsets := sections(message)
+	template := griblib.Data42{}
+	reader := bytes.NewReader(message[offsets[5]+11:])
+	require.NoError(t, binary.Read(reader, binary.BigEndian, &template))
+
+	section7 := message[offsets[7]+5 : len(message)-4]
+	_, err = griblib.ParseData42(bytes.NewReader(section7[:len(section7)/2]), len(section7)/2, &template, 360*181)
+	assert.Error(t, err)
+}
+
+func Test_read42_wgrib2_file(t *testing.T) {
+	// the streams of template5_42.grib2 come from our own test encoder, this file is packed by wgrib2 with libaec
+	messages, fixtures := openExternalFixture(t, "template5_42_wgrib2")
+
+	var data []float64
+	for _, message := range messages {
+		assert.Equal(t, uint16(42), message.Section5.DataTemplateNumber)
+		data = append(data, message.Data()...)
+	}
+	// wgrib2 writes the values with 6 significant digits
+	require.Len(t, data, len(fixtures))
+	assert.InDeltaSlice(t, fixtures, data, 1e-4)
+}
@@ -0,0 +1,91 @@
+package gribtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/nilsmagnus/grib/griblib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parse4_precisions(t *testing.T) {
+	values := []float64{0, -1.5, 273.15, math.MaxFloat32, math.SmallestNonzeroFloat64}
+
+	var raw32, raw64 []byte
+	for _, value := range values {
+		raw32 = binary.BigEndian.AppendUint32(raw32, math.Float32bits(float32(value)))
+		raw64 = binary.BigEndian.AppendUint64(raw64, math.Float64bits(value))
+	}
+
+	fld, err := griblib.ParseData4(bytes.NewReader(raw32), len(raw32), &griblib.Data4{Precision: griblib.PrecisionFloat32})
+	require.NoError(t, err)
+	for i, value := range values {
+		assert.Equal(t, float64(float32(value)), fld[i])
+	}
+
+	fld, err = griblib.ParseData4(bytes.NewReader(raw64), len(raw64), &griblib.Data4{Precision: griblib.PrecisionFloat64})
+	require.NoError(t, err)
+	assert.Equal(t, values, fld)
+}
+
+func Test_parse4_invalid(t *testing.T) {
+	raw := make([]byte, 32)
+
+	_, err := griblib.ParseData4(bytes.NewReader(raw), len(raw), &griblib.Data4{Precision: griblib.PrecisionFloat128})
+	assert.Error(t, err, "128-bit values are not supported")
+
+	_, err = griblib.ParseData4(bytes.NewReader(raw), 6, &griblib.Data4{Precision: griblib.PrecisionFloat32})
+	assert.Error(t, err, "length is not a multiple of 4")
+
+	_, err = griblib.ParseData4(bytes.NewReader(raw[:4]), 8, &griblib.Data4{Precision: griblib.PrecisionFloat64})
+	assert.Error(t, err, "data is truncated")
+}
+
+func Test_read4_message(t *testing.T) {
+	raw, err := os.ReadFile("../integrationtestdata/template5_0.grib2")
+	require.NoError(t, err)
+	message := splitMessages(t, raw)[0]
+
+	expected, err := griblib.ReadMessages(bytes.NewReader(message))
+	require.NoError(t, err)
+
+	for _, precision := range []uint8{griblib.PrecisionFloat32, griblib.PrecisionFloat64} {
+		messages, err := griblib.ReadMessages(bytes.NewReader(simpleToFloat(message, expected[0].Data(), precision)))
+		require.NoError(t, err)
+		require.Len(t, messages, 1)
+
+		assert.Equal(t, uint16(4), messages[0].Section5.DataTemplateNumber)
+		assert.InDeltaSlice(t, expected[0].Data(), messages[0].Data(), 1e-5)
+	}
+}
+
+// simpleToFloat replaces section 5 and 7 of a raw message packed with template 5.0 by template 5.4 holding values
+func simpleToFloat(message []byte, values []float64, precision uint8) []byte {
+	offsets := sections(message)
+	section5, section6, section7 := offsets[5], offsets[6], offsets[7]
+
+	converted := append([]byte{}, message[:section5]...)
+	converted = append(converted, 0, 0, 0, 12, 5)
+	converted = append(converted, message[section5+5:section5+9]...)
+	converted = append(converted, 0, 4, precision)
+	converted = append(converted, message[section6:section7]...)
+
+	var data []byte
+	for _, value := range values {
+		if precision == griblib.PrecisionFloat32 {
+			data = binary.BigEndian.AppendUint32(data, math.Float32bits(float32(value)))
+		} else {
+			data = binary.BigEndian.AppendUint64(data, math.Float64bits(value))
+		}
+	}
+	converted = binary.BigEndian.AppendUint32(converted, uint32(5+len(data)))
+	converted = append(converted, 7)
+	converted = append(converted, data...)
+	converted = append(converted, "7777"...)
+	binary.BigEndian.PutUint64(converted[8:16], uint64(len(converted)))
+	return converted
+}
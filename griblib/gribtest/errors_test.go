@@ -0,0 +1,163 @@
+package gribtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/nilsmagnus/grib/griblib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readTemplate5_0(t *testing.T) [][]byte {
+	raw, err := os.ReadFile("../integrationtestdata/template5_0.grib2")
+	require.NoError(t, err)
+	return splitMessages(t, raw)
+}
+
+func Test_errors_bad_indicator(t *testing.T) {
+	message := readTemplate5_0(t)[0]
+
+	_, err := griblib.ReadMessages(bytes.NewReader(append([]byte("JUNK"), message...)))
+	assert.True(t, errors.Is(err, griblib.ErrBadIndicator), err)
+
+	grib1 := append([]byte{}, message...)
+	grib1[7] = 1
+	_, err = griblib.ReadMessages(bytes.NewReader(grib1))
+	assert.True(t, errors.Is(err, griblib.ErrUnsupportedEdition), err)
+	assert.EqualError(t, err, "Unsupported grib edition 1")
+
+	short := append([]byte{}, message...)
+	binary.BigEndian.PutUint64(short[8:], 12)
+	_, err = griblib.ReadMessages(bytes.NewReader(short))
+	assert.True(t, errors.Is(err, griblib.ErrBadIndicator), err)
+}
+
+func Test_errors_truncated_message(t *testing.T) {
+	message := readTemplate5_0(t)[0]
+
+	for _, length := range []int{10, 100, len(message) - 1} {
+		_, err := griblib.ReadMessage(bytes.NewReader(message[:length]))
+		assert.True(t, errors.Is(err, griblib.ErrTruncatedMessage), "length %d: %v", length, err)
+		assert.True(t, errors.Is(err, io.ErrUnexpectedEOF), "length %d: %v", length, err)
+		var truncated *griblib.TruncatedMessageError
+		require.True(t, errors.As(err, &truncated), "length %d: %v", length, err)
+		assert.Equal(t, int64(length), truncated.Read)
+	}
+
+	// section 7 claims more octets than the message holds
+	overrun := append([]byte{}, message...)
+	section7 := sections(overrun)[7]
+	binary.BigEndian.PutUint32(overrun[section7:], binary.BigEndian.Uint32(overrun[section7:])+100)
+	_, err := griblib.ReadMessage(bytes.NewReader(overrun))
+	assert.True(t, errors.Is(err, griblib.ErrTruncatedMessage), err)
+	assert.NotEqual(t, io.EOF, err)
+
+	// the scanner reports it rather than stopping as if the file ended
+	scanner := griblib.NewScanner(bytes.NewReader(overrun))
+	assert.False(t, scanner.Next())
+	assert.True(t, errors.Is(scanner.Err(), griblib.ErrTruncatedMessage), scanner.Err())
+}
+
+func Test_errors_huge_message_length(t *testing.T) {
+	message := readTemplate5_0(t)[0]
+
+	for _, length := range []uint64{1 << 40, 1 << 62} {
+		for _, raw := range [][]byte{message[:16], message} {
+			huge := append([]byte{}, raw...)
+			binary.BigEndian.PutUint64(huge[8:], length)
+			_, err := griblib.ReadMessage(bytes.NewReader(huge))
+			var truncated *griblib.TruncatedMessageError
+			require.True(t, errors.As(err, &truncated), "length %d: %v", length, err)
+			assert.Equal(t, griblib.TruncatedMessageError{Length: int64(length), Read: int64(len(raw))}, *truncated)
+		}
+	}
+
+	huge := append([]byte{}, message...)
+	binary.BigEndian.PutUint64(huge[8:], 1<<63)
+	_, err := griblib.ReadMessage(bytes.NewReader(huge))
+	assert.True(t, errors.Is(err, griblib.ErrBadIndicator), err)
+}
+
+func Test_errors_unsupported_template(t *testing.T) {
+	chunks := readTemplate5_0(t)
+
+	corrupt := append([]byte{}, chunks[0]...)
+	binary.BigEndian.PutUint16(corrupt[sections(corrupt)[5]+9:], 99)
+	messages, err := griblib.ReadMessages(bytes.NewReader(append(corrupt, chunks[1]...)))
+	assert.Empty(t, messages)
+	var unsupported griblib.ErrUnsupportedTemplate
+	require.True(t, errors.As(err, &unsupported), err)
+	assert.Equal(t, griblib.ErrUnsupportedTemplate{Section: 5, Number: 99}, unsupported)
+	assert.EqualError(t, unsupported, "Data representation template 99 not supported")
+
+	corrupt = append([]byte{}, chunks[0]...)
+	binary.BigEndian.PutUint16(corrupt[sections(corrupt)[3]+12:], 999)
+	_, err = griblib.ReadMessage(bytes.NewReader(corrupt))
+	require.True(t, errors.As(err, &unsupported), err)
+	assert.Equal(t, griblib.ErrUnsupportedTemplate{Section: 3, Number: 999}, unsupported)
+
+	message := openGrib(t, "../integrationtestdata/template5_0.grib2")[0]
+	options := griblib.DefaultWriteOptions(message)
+	options.DataTemplate = 1
+	err = griblib.WriteMessageWithOptions(&bytes.Buffer{}, message, options)
+	assert.Equal(t, griblib.ErrUnsupportedTemplate{Section: 5, Number: 1}, err)
+}
+
+func Test_errors_corrupt_data(t *testing.T) {
+	raw, err := os.ReadFile("../integrationtestdata/template5_3.grib2")
+	require.NoError(t, err)
+	message := splitMessages(t, raw)[0]
+
+	// NG, the number of groups, at octets 32-35 of section 5
+	corrupt := append([]byte{}, message...)
+	binary.BigEndian.PutUint32(corrupt[sections(corrupt)[5]+31:], 1<<31)
+	read, err := griblib.ReadMessage(bytes.NewReader(corrupt))
+	assert.True(t, errors.Is(err, griblib.ErrCorruptData), err)
+	assert.Empty(t, read.Section7.Data)
+
+	// the header is read, the data fails when decoded
+	options := griblib.DefaultReadOptions()
+	options.HeadersOnly = true
+	scanner := griblib.NewScannerWithOptions(bytes.NewReader(corrupt), options)
+	require.True(t, scanner.Next())
+	assert.True(t, errors.Is(scanner.Message().Decode(), griblib.ErrCorruptData))
+
+	// a section shorter than its head
+	corrupt = append([]byte{}, message...)
+	binary.BigEndian.PutUint32(corrupt[sections(corrupt)[4]:], 3)
+	_, err = griblib.ReadMessage(bytes.NewReader(corrupt))
+	assert.True(t, errors.Is(err, griblib.ErrCorruptData), err)
+}
+
+func Test_errors_corrupt_points_number(t *testing.T) {
+	// messages of simple packing, complex packing and CCSDS packing, and a message with a bitmap
+	var messages [][]byte
+	for _, file := range []string{"template5_0.grib2", "template5_3.grib2", "template5_42.grib2"} {
+		raw, err := os.ReadFile("../integrationtestdata/" + file)
+		require.NoError(t, err)
+		messages = append(messages, splitMessages(t, raw)[0])
+	}
+	for _, chunk := range splitMessages(t, readGfs(t)) {
+		if _, ok := bitmapSection(chunk); ok {
+			messages = append(messages, chunk)
+			break
+		}
+	}
+	require.Len(t, messages, 4)
+
+	for i, message := range messages {
+		for _, points := range []uint32{1 << 31, math.MaxUint32, 1} {
+			// the number of values at octets 6-9 of section 5
+			corrupt := append([]byte{}, message...)
+			binary.BigEndian.PutUint32(corrupt[sections(corrupt)[5]+5:], points)
+			_, err := griblib.ReadMessage(bytes.NewReader(corrupt))
+			assert.True(t, errors.Is(err, griblib.ErrCorruptData), "message %d, %d values: %v", i, points, err)
+		}
+	}
+}
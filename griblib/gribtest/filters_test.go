@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	"github.com/nilsmagnus/grib/griblib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_calculcate_startStopIndexes(t *testing.T) {
@@ -55,6 +57,31 @@ func Test_filter_values_on_geofilter(t *testing.T) {
 
 }
 
+func Test_filter_message_non_square_grid(t *testing.T) {
+	// 8 points west-east in a row and 4 rows north-south
+	grid := griblib.Grid0{Di: 1_000_000, Dj: 1_000_000, Lo1: 0, Lo2: 7_000_000, La1: 3_000_000, La2: 0, Ni: 8, Nj: 4}
+	data := make([]float64, grid.Ni*grid.Nj)
+	missing := make([]uint8, len(data))
+	for k := range data {
+		data[k] = float64(k)
+		if k%3 == 0 {
+			missing[k] = griblib.BitmapMissing
+		}
+	}
+	message := griblib.Message{
+		Section3: griblib.Section3{Definition: &grid, DataPointCount: uint32(len(data))},
+		Section7: griblib.Section7{Data: data, Missing: missing},
+	}
+
+	// the points 2 to 4 of the rows 1 and 2
+	filter := griblib.GeoFilter{MinLong: 2_000_000, MaxLong: 5_000_000, MinLat: 2_000_000, MaxLat: 0}
+	require.True(t, griblib.FilterMessage(&message, griblib.Options{Discipline: -1, Category: -1, GeoFilter: filter}))
+
+	assert.Equal(t, []float64{10, 11, 12, 18, 19, 20}, message.Section7.Data)
+	var m, n uint8 = griblib.BitmapMissing, griblib.NotMissing
+	assert.Equal(t, []uint8{n, n, m, m, n, n}, message.Section7.Missing)
+}
+
 func Test_filter_on_discipline(t *testing.T) {
 
 	messages := []*griblib.Message{
@@ -127,3 +154,23 @@ func Test_temperature_layers(t *testing.T) {
 	}
 
 }
+
+func Test_filter_on_parameters_and_forecast_times(t *testing.T) {
+	product := func(parameter uint8, forecastTime uint32) *griblib.Message {
+		return &griblib.Message{Section4: griblib.Section4{
+			ProductDefinitionTemplate: griblib.Product0{ParameterNumber: parameter, ForecastTime: forecastTime},
+		}}
+	}
+	messages := []*griblib.Message{product(0, 0), product(2, 0), product(3, 6), product(2, 6)}
+
+	all := griblib.Options{Discipline: -1, Category: -1}
+	assert.Len(t, griblib.Filter(messages, all), 4, "empty lists should not filter")
+
+	winds := all
+	winds.Parameters = []int{2, 3}
+	assert.Equal(t, messages[1:], griblib.Filter(messages, winds))
+
+	windsAt6 := winds
+	windsAt6.ForecastTimes = []int{6}
+	assert.Equal(t, messages[2:], griblib.Filter(messages, windsAt6))
+}
@@ -0,0 +1,173 @@
+package gribtest
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nilsmagnus/grib/griblib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gfsIndex(t *testing.T) griblib.Index {
+	file, err := os.Open("../integrationtestdata/gfs.t00z.pgrb2.2p50.f000")
+	require.NoError(t, err)
+	defer file.Close()
+	index, err := griblib.BuildIndex(file)
+	require.NoError(t, err)
+	return index
+}
+
+func Test_write_idx(t *testing.T) {
+	var idx bytes.Buffer
+	require.NoError(t, griblib.WriteIdx(&idx, gfsIndex(t)))
+
+	lines := strings.Split(idx.String(), "\n")
+	assert.Equal(t, "1:0:d=2017032200:UGRD:planetary boundary layer:anl:", lines[0])
+	for _, line := range []string{
+		"6:47850:d=2017032200:TMP:1 mb:anl:",
+		"250:2779597:d=2017032200:TSOIL:0-0.1 m below ground:anl:",
+		"260:2831656:d=2017032200:TMP:2 m above ground:anl:",
+		"274:2967808:d=2017032200:PWAT:entire atmosphere (considered as a single layer):anl:",
+		"278:3002149:d=2017032200:HLCY:3000-0 m above ground:anl:",
+		"315:3499787:d=2017032200:TMP:30-0 mb above ground:anl:",
+	} {
+		assert.Contains(t, lines, line)
+	}
+	assert.Equal(t, "", lines[len(lines)-1], "the file ends with a new line")
+}
+
+func Test_read_idx_round_trip(t *testing.T) {
+	index := gfsIndex(t)
+	var idx bytes.Buffer
+	require.NoError(t, griblib.WriteIdx(&idx, index))
+
+	read, err := griblib.ReadIdx(&idx)
+	require.NoError(t, err)
+	require.Len(t, read, len(index))
+	for i, entry := range index {
+		assert.Equal(t, entry.Number, read[i].Number)
+		assert.Equal(t, entry.Offset, read[i].Offset)
+		assert.Equal(t, entry.ReferenceTime, read[i].ReferenceTime)
+		assert.Equal(t, entry.Variable, read[i].Variable)
+		assert.Equal(t, entry.Level, read[i].Level)
+		assert.Equal(t, entry.Forecast, read[i].Forecast)
+		assert.Equal(t, entry.Extras, read[i].Extras)
+		if i < len(index)-1 {
+			assert.Equal(t, entry.Length, read[i].Length)
+		}
+	}
+	assert.Equal(t, int64(0), read[len(read)-1].Length, "the length of the last message is not known")
+}
+
+func Test_read_idx_noaa(t *testing.T) {
+	idx := "1:0:d=2024010100:HGT:10 mb:anl:ENS=low-res ctl\r\n" +
+		"2:50000:d=2024010100:UGRD:10 m above ground:3 hour fcst:ENS=+1\r\n" +
+		"3.1:70000:d=2024010100:UGRD:10 m above ground:0-3 hour ave fcst:\r\n" +
+		"3.2:70000:d=2024010100:VGRD:10 m above ground:0-3 hour ave fcst:\r\n" +
+		"4:90000:d=202401010030:APCP:surface:0-6 hour acc fcst:\r\n" +
+		"\r\n"
+
+	index, err := griblib.ReadIdx(strings.NewReader(idx))
+	require.NoError(t, err)
+	require.Len(t, index, 5)
+
+	assert.Equal(t, griblib.IndexEntry{
+		Number: 2, Offset: 50000, Length: 20000,
+		ReferenceTime: griblib.Time{Year: 2024, Month: 1, Day: 1},
+		Variable:      "UGRD", Level: "10 m above ground", Forecast: "3 hour fcst", Extras: "ENS=+1",
+	}, index[1])
+	assert.Equal(t, "ENS=low-res ctl", index[0].Extras)
+	assert.Equal(t, 3, index[3].Number)
+	assert.Equal(t, int64(20000), index[2].Length, "the fields of a message have the length of the message")
+	assert.Equal(t, int64(20000), index[3].Length)
+	assert.Equal(t, uint8(30), index[4].ReferenceTime.Minute)
+
+	winds := index.Select(func(entry griblib.IndexEntry) bool { return entry.Variable == "UGRD" })
+	assert.Len(t, winds, 2)
+}
+
+func Test_read_idx_errors(t *testing.T) {
+	for _, line := range []string{
+		"1:0:d=2024010100:TMP:2 m above ground",
+		"x:0:d=2024010100:TMP:2 m above ground:anl:",
+		"1:-5:d=2024010100:TMP:2 m above ground:anl:",
+		"1:0:2024010100:TMP:2 m above ground:anl:",
+		"1:0:d=20240101:TMP:2 m above ground:anl:",
+		"1:0:d=2024010a00:TMP:2 m above ground:anl:",
+	} {
+		_, err := griblib.ReadIdx(strings.NewReader(line))
+		assert.Error(t, err, line)
+	}
+}
+
+func Test_idx_products(t *testing.T) {
+	message := openGrib(t, "../integrationtestdata/template5_0.grib2")[0]
+	header := message.Section4.ProductDefinitionTemplate
+	header.TimeUnitIndicator = 1
+	header.ForecastTime = 6
+	header.FirstSurface = griblib.Surface{Type: 1}
+	header.SecondSurface = griblib.Surface{Type: 255}
+	timeRange := griblib.TimeRangeSpecification{StatisticalFieldCalculationProcess: 1, IncrementBetweenSuccessiveFieldsRangeTimeUnitIndicator: 1, StatististicalProcessTimeLength: 6}
+
+	for _, test := range []struct {
+		templateNumber uint16
+		product        griblib.Product
+		forecast       string
+		extras         string
+	}{
+		{0, header, "6 hour fcst", ""},
+		{1, griblib.Product1{Product0: header, EnsembleForecastType: 3, PertubationNumber: 4}, "6 hour fcst", "ENS=+4"},
+		{8, griblib.Product8{Product0: header, NumberOfIntervalTimeRanges: 1, TimeRangeSpecification1: timeRange}, "6-12 hour acc fcst", ""},
+		{12, griblib.Product12{Product2: griblib.Product2{Product0: header}, NumberOfIntervalTimeRanges: 1, TimeRangeSpecification1: timeRange}, "6-12 hour acc fcst", "ens mean"},
+	} {
+		message.Section4.ProductDefinitionTemplateNumber = test.templateNumber
+		message.Section4.Product = test.product
+		var written bytes.Buffer
+		require.NoError(t, griblib.WriteMessage(&written, message))
+
+		index, err := griblib.BuildIndex(&written)
+		require.NoError(t, err)
+		assert.Equal(t, "surface", index[0].Level)
+		assert.Equal(t, test.forecast, index[0].Forecast, "template %d", test.templateNumber)
+		assert.Equal(t, test.extras, index[0].Extras, "template %d", test.templateNumber)
+	}
+}
+
+func Test_idx_statistical_time_units(t *testing.T) {
+	message := openGrib(t, "../integrationtestdata/template5_0.grib2")[0]
+	header := message.Section4.ProductDefinitionTemplate
+	header.FirstSurface = griblib.Surface{Type: 1}
+	header.SecondSurface = griblib.Surface{Type: 255}
+	message.Section4.ProductDefinitionTemplateNumber = 8
+
+	// the start is given in the unit of the product, the length of the range in its own unit (code table 4.4)
+	for _, test := range []struct {
+		unit, rangeUnit uint8
+		start, length   uint32
+		forecast        string
+	}{
+		{1, 1, 6, 6, "6-12 hour acc fcst"},
+		{10, 1, 2, 6, "6-12 hour acc fcst"},
+		{1, 11, 6, 1, "6-12 hour acc fcst"},
+		{0, 1, 30, 1, "30-90 min acc fcst"},
+		{1, 0, 6, 30, "360-390 min acc fcst"},
+		{1, 2, 24, 1, "1-2 day acc fcst"},
+		{1, 3, 0, 1, "0-1 month acc fcst"},
+		{3, 4, 6, 1, "6-18 month acc fcst"},
+		{1, 3, 6, 1, "6 hour+1 month acc fcst"},
+	} {
+		header.TimeUnitIndicator = test.unit
+		header.ForecastTime = test.start
+		timeRange := griblib.TimeRangeSpecification{StatisticalFieldCalculationProcess: 1, IncrementBetweenSuccessiveFieldsRangeTimeUnitIndicator: test.rangeUnit, StatististicalProcessTimeLength: test.length}
+		message.Section4.Product = griblib.Product8{Product0: header, NumberOfIntervalTimeRanges: 1, TimeRangeSpecification1: timeRange}
+		var written bytes.Buffer
+		require.NoError(t, griblib.WriteMessage(&written, message))
+
+		index, err := griblib.BuildIndex(&written)
+		require.NoError(t, err)
+		assert.Equal(t, test.forecast, index[0].Forecast, "units %d and %d", test.unit, test.rangeUnit)
+	}
+}
@@ -0,0 +1,94 @@
+package gribtest
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/nilsmagnus/grib/griblib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// onlyReader hides the Seek method of a reader
+type onlyReader struct {
+	io.Reader
+}
+
+func Test_build_index(t *testing.T) {
+	raw, err := os.ReadFile("../integrationtestdata/gfs.t00z.pgrb2.2p50.f000")
+	require.NoError(t, err)
+	messages, err := griblib.ReadMessages(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	for _, reader := range []io.Reader{bytes.NewReader(raw), onlyReader{bytes.NewReader(raw)}} {
+		index, err := griblib.BuildIndex(reader)
+		require.NoError(t, err)
+		require.Len(t, index, len(messages))
+
+		offset := int64(0)
+		for i, entry := range index {
+			message := messages[i]
+			product := message.Section4.ProductDefinitionTemplate
+			assert.Equal(t, i+1, entry.Number)
+			assert.Equal(t, offset, entry.Offset)
+			assert.Equal(t, int64(message.Section0.MessageLength), entry.Length)
+			assert.Equal(t, message.Section0.Discipline, entry.Discipline)
+			assert.Equal(t, product.ParameterCategory, entry.Category)
+			assert.Equal(t, product.ParameterNumber, entry.ParameterNumber)
+			assert.Equal(t, product.FirstSurface, entry.FirstSurface)
+			assert.Equal(t, product.ForecastTime, entry.ForecastTime)
+			assert.Equal(t, message.Section1.ReferenceTime, entry.ReferenceTime)
+			assert.Equal(t, message.Section4.Product, entry.Product)
+			offset += entry.Length
+		}
+		assert.Equal(t, int64(len(raw)), offset)
+	}
+}
+
+func Test_read_message_at(t *testing.T) {
+	raw, err := os.ReadFile("../integrationtestdata/gfs.t00z.pgrb2.2p50.f000")
+	require.NoError(t, err)
+	messages, err := griblib.ReadMessages(bytes.NewReader(raw))
+	require.NoError(t, err)
+	index, err := griblib.BuildIndex(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	temperatures := index.Select(func(entry griblib.IndexEntry) bool {
+		return entry.Discipline == 0 && entry.Category == 0 && entry.ParameterNumber == 0
+	})
+	require.NotEmpty(t, temperatures)
+
+	for _, entry := range temperatures {
+		message, err := griblib.ReadMessageAt(bytes.NewReader(raw), entry)
+		require.NoError(t, err)
+		expected := messages[entry.Number-1]
+		assert.Equal(t, expected.Section4, message.Section4)
+		if expected.Section6.BitmapIndicator == griblib.BitmapPreviouslyDefined {
+			continue
+		}
+		require.Len(t, message.Data(), len(expected.Data()))
+		for i, value := range expected.Data() {
+			if math.IsNaN(value) {
+				assert.True(t, math.IsNaN(message.Data()[i]), "point %d should be missing", i)
+			} else {
+				assert.Equal(t, value, message.Data()[i])
+			}
+		}
+	}
+}
+
+func Test_build_index_truncated_file(t *testing.T) {
+	raw, err := os.ReadFile("../integrationtestdata/template5_0.grib2")
+	require.NoError(t, err)
+
+	for _, length := range []int{10, 40, len(raw) - 2} {
+		_, err := griblib.BuildIndex(bytes.NewReader(raw[:length]))
+		assert.Error(t, err, "file cut at %d", length)
+	}
+	index, err := griblib.BuildIndex(bytes.NewReader(nil))
+	assert.NoError(t, err)
+	assert.Empty(t, index)
+}
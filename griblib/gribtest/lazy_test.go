@@ -0,0 +1,151 @@
+package gribtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nilsmagnus/grib/griblib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func headersOnly() griblib.ReadOptions {
+	options := griblib.DefaultReadOptions()
+	options.HeadersOnly = true
+	return options
+}
+
+func Test_headers_only_decodes_on_demand(t *testing.T) {
+	raw, err := os.ReadFile("../integrationtestdata/gfs.t00z.pgrb2.2p50.f000")
+	require.NoError(t, err)
+	expected, err := griblib.ReadMessages(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	messages, err := griblib.ReadMessagesWithOptions(bytes.NewReader(raw), headersOnly())
+	require.NoError(t, err)
+	require.Len(t, messages, len(expected))
+
+	for i, message := range messages {
+		assert.Equal(t, expected[i].Section4, message.Section4)
+		assert.Nil(t, message.Section7.Data, "section 7 should not be decoded before Data is called")
+	}
+	for i, message := range messages {
+		require.NoError(t, message.Decode())
+		assert.Len(t, message.Section7.Data, len(expected[i].Data()))
+		assert.Equal(t, countNaN(expected[i].Data()), countNaN(message.Data()))
+	}
+}
+
+func Test_headers_only_data(t *testing.T) {
+	messages := openGrib(t, "../integrationtestdata/template5_3.grib2")
+	testFile, err := os.Open("../integrationtestdata/template5_3.grib2")
+	require.NoError(t, err)
+	defer testFile.Close()
+
+	scanner := griblib.NewScannerWithOptions(testFile, headersOnly())
+	for i := 0; scanner.Next(); i++ {
+		assert.Equal(t, messages[i].Data(), scanner.Message().Data())
+		assert.NoError(t, scanner.Message().Decode(), "decoding twice should do nothing")
+	}
+	require.NoError(t, scanner.Err())
+}
+
+func Test_headers_only_copies_share_data(t *testing.T) {
+	expected := openGrib(t, "../integrationtestdata/template5_3.grib2")
+	raw, err := os.ReadFile("../integrationtestdata/template5_3.grib2")
+	require.NoError(t, err)
+	read, err := griblib.ReadMessagesWithOptions(bytes.NewReader(raw), headersOnly())
+	require.NoError(t, err)
+
+	// Data is called on values, like the elements of a []Message or through an interface
+	var messages []griblib.Message
+	for _, message := range read {
+		messages = append(messages, *message)
+	}
+	var dataOf interface{ Data() []float64 } = messages[0]
+	assert.Equal(t, expected[0].Data(), dataOf.Data())
+	assert.Nil(t, messages[0].Section7.Data, "Data leaves section 7 as it is")
+
+	// the copies share the decoded data
+	first := messages[1].Data()
+	assert.Equal(t, expected[1].Data(), first)
+	assert.Same(t, &first[0], &read[1].Data()[0])
+	require.NoError(t, read[1].Decode())
+	assert.Same(t, &first[0], &read[1].Section7.Data[0])
+}
+
+func Test_headers_only_corrupt_data(t *testing.T) {
+	raw, err := os.ReadFile("../integrationtestdata/template5_40.grib2")
+	require.NoError(t, err)
+	message := append([]byte{}, splitMessages(t, raw)[0]...)
+	section7 := sections(message)[7]
+	for i := section7 + 5; i < len(message)-4; i++ {
+		message[i] = 0
+	}
+
+	messages, err := griblib.ReadMessagesWithOptions(bytes.NewReader(message), headersOnly())
+	require.NoError(t, err, "section 7 is not decoded when reading headers only")
+	require.Len(t, messages, 1)
+
+	assert.Error(t, messages[0].Decode())
+	assert.Error(t, messages[0].Decode(), "the error should be returned again")
+	assert.Empty(t, messages[0].Data())
+}
+
+func Test_headers_only_tolerant_warns_on_decode(t *testing.T) {
+	raw, err := os.ReadFile("../integrationtestdata/template5_3.grib2")
+	require.NoError(t, err)
+	chunks := splitMessages(t, raw)
+	require.True(t, len(chunks) >= 2)
+
+	// NG, the number of groups, at octets 32-35 of section 5, makes the data of the second message corrupt
+	corrupt := append([]byte{}, chunks[1]...)
+	binary.BigEndian.PutUint32(corrupt[sections(corrupt)[5]+31:], 1<<31)
+	file := append(append(append([]byte{}, chunks[0]...), corrupt...), chunks[0]...)
+	expected := griblib.Warning{Offset: int64(len(chunks[0])), Length: int64(len(corrupt))}
+
+	options := headersOnly()
+	options.Tolerant = true
+	scanner := griblib.NewScannerWithOptions(bytes.NewReader(file), options)
+	var messages []*griblib.Message
+	for scanner.Next() {
+		messages = append(messages, scanner.Message())
+	}
+	require.NoError(t, scanner.Err())
+	require.Len(t, messages, 3)
+	assert.Empty(t, scanner.Warnings(), "the headers are read")
+
+	assert.NoError(t, messages[0].Decode())
+	assert.True(t, errors.Is(messages[1].Decode(), griblib.ErrCorruptData))
+	assert.Empty(t, messages[1].Data())
+	warnings := scanner.Warnings()
+	require.Len(t, warnings, 1, "the message is reported once")
+	assert.True(t, errors.Is(warnings[0], griblib.ErrCorruptData))
+	expected.Err = warnings[0].Err
+	assert.Equal(t, expected, warnings[0])
+
+	// the export skips the message and reports it, the messages are written to the standard output
+	stdout, err := os.Create(t.TempDir() + "/stdout.json")
+	require.NoError(t, err)
+	defer func(original *os.File) { os.Stdout = original }(os.Stdout)
+	os.Stdout = stdout
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	defer log.SetOutput(os.Stderr)
+
+	scanner = griblib.NewScannerWithOptions(bytes.NewReader(file), options)
+	exportOptions := griblib.Options{Discipline: -1, Category: -1, ExportType: griblib.ExportJSONToConsole}
+	require.NoError(t, griblib.ExportScanner(scanner, exportOptions))
+	require.Len(t, scanner.Warnings(), 1)
+	assert.Equal(t, expected.Offset, scanner.Warnings()[0].Offset)
+	assert.NotContains(t, output.String(), "Error decoding data")
+
+	exported, err := os.ReadFile(stdout.Name())
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(exported), `"Section0"`))
+}
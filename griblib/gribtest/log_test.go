@@ -0,0 +1,75 @@
+package gribtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/nilsmagnus/grib/griblib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// corruptFile returns two messages, the second one with an unsupported data template and junk before it
+func corruptFile(t *testing.T) []byte {
+	chunks := readTemplate5_0(t)
+	corrupt := append([]byte{}, chunks[1]...)
+	binary.BigEndian.PutUint16(corrupt[sections(corrupt)[5]+9:], 99)
+	raw := append([]byte{}, chunks[0]...)
+	raw = append(raw, "junk"...)
+	return append(raw, corrupt...)
+}
+
+// readAll reads raw with the logger, in the ways that may log something
+func readAll(t *testing.T, raw []byte, logger *slog.Logger) {
+	options := griblib.DefaultReadOptions()
+	options.Tolerant = true
+	options.HeadersOnly = true
+	options.Logger = logger
+	messages, err := griblib.ReadMessagesWithOptions(bytes.NewReader(raw), options)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+
+	// the data of the message can not be decoded any more
+	messages[0].Section5.DataTemplateNumber = 99
+	assert.Empty(t, messages[0].Data())
+
+	// the filters log to the logger of the message, a message without a grid can not be filtered
+	messages[0].Section3.Definition = nil
+	filter := griblib.Options{Discipline: -1, Category: -1, GeoFilter: griblib.GeoFilter{MinLat: 1, MaxLat: 2}}
+	assert.True(t, griblib.FilterMessage(messages[0], filter))
+	// and the exports to the logger of the message as well
+	griblib.Export(messages, griblib.Options{ExportType: griblib.ExportToPNG})
+
+	options.Tolerant = false
+	_, err = griblib.ReadMessagesWithOptions(bytes.NewReader(raw), options)
+	assert.Error(t, err)
+}
+
+func Test_library_is_silent_by_default(t *testing.T) {
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	defer log.SetOutput(os.Stderr)
+
+	readAll(t, corruptFile(t), nil)
+	assert.Empty(t, output.String())
+}
+
+func Test_library_logs_to_logger(t *testing.T) {
+	var output bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&output, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	raw := corruptFile(t)
+
+	readAll(t, raw, logger)
+	logged := output.String()
+	assert.Contains(t, logged, "level=WARN msg=\"Skipped octets\" offset=106064 length=4")
+	assert.Contains(t, logged, "level=WARN msg=\"Skipped octets\" offset=106068")
+	assert.Contains(t, logged, "level=ERROR msg=\"Error decoding data\"")
+	assert.Contains(t, logged, "level=ERROR msg=\"Error when parsing a message\"")
+	assert.Contains(t, logged, "level=DEBUG msg=\"Using GeoFilter\"")
+	assert.Contains(t, logged, "level=WARN msg=\"GeoFilter not applied\"")
+	assert.Contains(t, logged, "level=ERROR msg=\"Message could not be converted to image\"")
+}
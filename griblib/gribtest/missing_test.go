@@ -0,0 +1,227 @@
+package gribtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/nilsmagnus/grib/griblib"
+	"github.com/nilsmagnus/grib/internal/writer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dataSection5 returns section 5 for pointsNumber values packed with template
+func dataSection5(t *testing.T, number uint16, template interface{}, pointsNumber int) griblib.Section5 {
+	t.Helper()
+	var data bytes.Buffer
+	require.NoError(t, binary.Write(&data, binary.BigEndian, template))
+	return griblib.Section5{PointsNumber: uint32(pointsNumber), DataTemplateNumber: number, Data: data.Bytes()}
+}
+
+// writeGroups writes the references, widths and lengths of groups of complex packing, the widths and lengths
+// on 2 bits
+func writeGroups(w *writer.BitWriter, references []uint64, referenceBits int, widths []uint64, scaledLengths []uint64) {
+	for _, reference := range references {
+		w.WriteUint(reference, referenceBits)
+	}
+	w.Align()
+	for _, values := range [][]uint64{widths, scaledLengths} {
+		w.WriteUintsBlock(values, 2)
+		w.Align()
+	}
+}
+
+func Test_read_missing_values(t *testing.T) {
+	// a group of 4 values of 3 bits, the primary (7) and secondary (6) missing values of 3 bits in the middle,
+	// groups of constant values: 2 primary missing (31), 1 secondary missing (30) and 2 zeros
+	packed := writer.New()
+	writeGroups(packed, []uint64{10, 31, 30, 0}, 5, []uint64{3, 0, 0, 0}, []uint64{3, 1, 0, 0})
+	for _, value := range []uint64{0, 7, 6, 2} {
+		packed.WriteUint(value, 3)
+	}
+	data := packed.Bytes()
+
+	tests := []struct {
+		name            string
+		missingValue    uint8
+		valueType       uint8
+		substitutes     [2]uint32
+		expectedData    []float64
+		expectedMissing []uint8
+	}{
+		{
+			name:            "primary and secondary floating-point substitutes",
+			missingValue:    2,
+			substitutes:     [2]uint32{math.Float32bits(9999), math.Float32bits(-1.5)},
+			expectedData:    []float64{10, 9999, -1.5, 12, 9999, 9999, -1.5, 0, 0},
+			expectedMissing: []uint8{0, 1, 2, 0, 1, 1, 2, 0, 0},
+		},
+		// the integer substitutes are unsigned, the first bit is not a sign
+		{
+			name:            "primary and secondary integer substitutes",
+			missingValue:    2,
+			valueType:       1,
+			substitutes:     [2]uint32{0x80000001, 9999},
+			expectedData:    []float64{10, 2147483649, 9999, 12, 2147483649, 2147483649, 9999, 0, 0},
+			expectedMissing: []uint8{0, 1, 2, 0, 1, 1, 2, 0, 0},
+		},
+		{
+			name:            "primary substitute only",
+			missingValue:    1,
+			substitutes:     [2]uint32{math.Float32bits(9999), math.Float32bits(-1.5)},
+			expectedData:    []float64{10, 9999, 16, 12, 9999, 9999, 30, 0, 0},
+			expectedMissing: []uint8{0, 1, 0, 0, 1, 1, 0, 0, 0},
+		},
+		{
+			name:         "no missing value management",
+			substitutes:  [2]uint32{math.Float32bits(9999), math.Float32bits(-1.5)},
+			expectedData: []float64{10, 17, 16, 12, 31, 31, 30, 0, 0},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := griblib.Data2{
+				Data0:                  griblib.Data0{Bits: 5, Type: test.valueType},
+				GroupMethod:            1,
+				MissingValue:           test.missingValue,
+				MissingSubstitute1:     test.substitutes[0],
+				MissingSubstitute2:     test.substitutes[1],
+				NG:                     4,
+				GroupWidthsBits:        2,
+				GroupLengthsReference:  1,
+				GroupLengthIncrement:   1,
+				GroupLastLength:        2,
+				GroupScaledLengthsBits: 2,
+			}
+			section5 := dataSection5(t, 2, template, 9)
+
+			section7, err := griblib.ReadSection7(bytes.NewReader(data), len(data), section5)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedData, section7.Data)
+			if test.expectedMissing == nil {
+				assert.Nil(t, section7.Missing)
+			} else {
+				assert.Equal(t, test.expectedMissing, section7.Missing)
+			}
+
+			// ParseData2 gives the same values, without the mask
+			values, err := griblib.ParseData2(bytes.NewReader(data), len(data), &template)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedData, values)
+		})
+	}
+}
+
+func Test_read_missing_values_spatial_differencing(t *testing.T) {
+	// first order differences 5, missing, 6, 5 are packed as ival1 = 5, minsd = -1 and the group of values
+	// (unused), primary missing (7), 2 and 0 of 3 bits. The missing value is left out of the differences.
+	packed := writer.New()
+	packed.WriteInt(5, 8)
+	packed.WriteInt(-1, 8)
+	packed.WriteUint(0, 3)
+	packed.Align()
+	for _, value := range []uint64{0, 7, 2, 0} {
+		packed.WriteUint(value, 3)
+	}
+	data := packed.Bytes()
+
+	template := griblib.Data3{
+		Data2: griblib.Data2{
+			Data0:              griblib.Data0{Bits: 3},
+			GroupMethod:        1,
+			MissingValue:       1,
+			MissingSubstitute1: math.Float32bits(9999),
+			NG:                 1,
+			GroupWidths:        3,
+			GroupLastLength:    4,
+		},
+		SpatialOrderDifference: 1,
+		OctetsNumber:           1,
+	}
+	section7, err := griblib.ReadSection7(bytes.NewReader(data), len(data), dataSection5(t, 3, template, 4))
+	require.NoError(t, err)
+	assert.Equal(t, []float64{5, 9999, 6, 5}, section7.Data)
+	assert.Equal(t, []uint8{griblib.NotMissing, griblib.PrimaryMissing, griblib.NotMissing, griblib.NotMissing}, section7.Missing)
+}
+
+// withPrimaryMissing returns the first message of a file packed with complex packing, changed to manage primary
+// missing values with the substitute 9999: the largest value of the width of each group becomes missing
+func withPrimaryMissing(t *testing.T, raw []byte) []byte {
+	t.Helper()
+	message := append([]byte{}, splitMessages(t, raw)[0]...)
+	section5 := sections(message)[5]
+	// octet 23 is the missing value management, octets 24-27 the primary missing value substitute
+	message[section5+22] = 1
+	binary.BigEndian.PutUint32(message[section5+23:], math.Float32bits(9999))
+	return message
+}
+
+func Test_read_missing_values_message(t *testing.T) {
+	raw, err := os.ReadFile("../integrationtestdata/template5_2.grib2")
+	require.NoError(t, err)
+	messages, err := griblib.ReadMessages(bytes.NewReader(withPrimaryMissing(t, raw)))
+	require.NoError(t, err)
+	message := messages[0]
+
+	fixtures := openCsv(t, "../integrationtestdata/template_ugrd.csv")
+	require.Len(t, message.Section7.Missing, len(fixtures))
+	missingCount := 0
+	for i, value := range message.Data() {
+		if message.Section7.Missing[i] == griblib.PrimaryMissing {
+			assert.Equal(t, 9999.0, value)
+			missingCount++
+			continue
+		}
+		assert.Equal(t, uint8(griblib.NotMissing), message.Section7.Missing[i])
+		assert.InEpsilon(t, fixtures[i], value, 1e-5)
+	}
+	assert.Greater(t, missingCount, 0)
+	assert.Less(t, missingCount, len(fixtures))
+
+	// the missing values are left out with a bitmap when the message is written
+	var written bytes.Buffer
+	require.NoError(t, griblib.WriteMessage(&written, message))
+	read, err := griblib.ReadMessages(bytes.NewReader(written.Bytes()))
+	require.NoError(t, err)
+	assert.Nil(t, read[0].Section7.Missing)
+	for i, value := range read[0].Data() {
+		assert.Equal(t, message.Section7.Missing[i] != griblib.NotMissing, math.IsNaN(value))
+	}
+
+	// with a bitmap, the mask covers every grid point, the values are those of the written message
+	messages, err = griblib.ReadMessages(bytes.NewReader(withPrimaryMissing(t, written.Bytes())))
+	require.NoError(t, err)
+	withBitmap := messages[0]
+	require.Len(t, withBitmap.Section7.Missing, len(fixtures))
+	for i, value := range withBitmap.Data() {
+		switch withBitmap.Section7.Missing[i] {
+		case griblib.BitmapMissing:
+			assert.True(t, math.IsNaN(value))
+			assert.Equal(t, uint8(griblib.PrimaryMissing), message.Section7.Missing[i])
+		case griblib.PrimaryMissing:
+			assert.Equal(t, 9999.0, value)
+		default:
+			assert.Equal(t, read[0].Data()[i], value)
+		}
+	}
+}
+
+func Test_filter_missing_values(t *testing.T) {
+	raw, err := os.ReadFile("../integrationtestdata/template5_2.grib2")
+	require.NoError(t, err)
+	messages, err := griblib.ReadMessages(bytes.NewReader(withPrimaryMissing(t, raw)))
+	require.NoError(t, err)
+	message := messages[0]
+
+	filter := griblib.GeoFilter{MinLong: 10_000_000, MinLat: 70_000_000, MaxLat: 60_000_000, MaxLong: 20_000_000}
+	require.True(t, griblib.FilterMessage(message, griblib.Options{Discipline: -1, Category: -1, GeoFilter: filter}))
+
+	require.Len(t, message.Section7.Missing, len(message.Data()))
+	for i, value := range message.Data() {
+		assert.Equal(t, message.Section7.Missing[i] == griblib.PrimaryMissing, value == 9999, "value %d", i)
+	}
+}
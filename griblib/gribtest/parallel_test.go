@@ -0,0 +1,89 @@
+package gribtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/nilsmagnus/grib/griblib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// assertSameMessages asserts that actual holds the messages of expected, with the same headers and data
+func assertSameMessages(t *testing.T, expected, actual []*griblib.Message) {
+	t.Helper()
+	require.Len(t, actual, len(expected))
+	for i := range expected {
+		assert.Equal(t, expected[i].Section0, actual[i].Section0, "message %d", i)
+		assert.Equal(t, expected[i].Section4, actual[i].Section4, "message %d", i)
+		assert.Equal(t, expected[i].Section5, actual[i].Section5, "message %d", i)
+		expectedData, actualData := expected[i].Section7.Data, actual[i].Section7.Data
+		require.Len(t, actualData, len(expectedData), "message %d", i)
+		for j, value := range expectedData {
+			if value != actualData[j] && !(math.IsNaN(value) && math.IsNaN(actualData[j])) {
+				assert.Fail(t, "different data", "message %d, point %d: %g and %g", i, j, value, actualData[j])
+				break
+			}
+		}
+	}
+}
+
+func Test_read_messages_parallel(t *testing.T) {
+	for _, file := range []string{
+		"../integrationtestdata/gfs.t00z.pgrb2.2p50.f000",
+		"../integrationtestdata/template5_0.grib2",
+		"../integrationtestdata/template5_3.grib2",
+		"../integrationtestdata/template5_42.grib2",
+	} {
+		raw, err := os.ReadFile(file)
+		require.NoError(t, err)
+		expected, err := griblib.ReadMessages(bytes.NewReader(raw))
+		require.NoError(t, err)
+
+		for _, workers := range []int{0, 1, 4} {
+			messages, err := griblib.ReadMessagesParallel(context.Background(), bytes.NewReader(raw), griblib.DefaultReadOptions(), workers)
+			require.NoError(t, err, "%s with %d workers", file, workers)
+			assertSameMessages(t, expected, messages)
+		}
+	}
+}
+
+func Test_read_messages_parallel_errors(t *testing.T) {
+	raw, err := os.ReadFile("../integrationtestdata/template5_3.grib2")
+	require.NoError(t, err)
+	chunks := splitMessages(t, raw)
+	require.Len(t, chunks, 2)
+	expected, err := griblib.ReadMessages(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	// a number of groups that does not match the data of the second message
+	corrupt := append([]byte{}, chunks[1]...)
+	binary.BigEndian.PutUint32(corrupt[sections(corrupt)[5]+31:], 1<<31)
+	file := append(append(append([]byte{}, chunks[0]...), corrupt...), chunks[0]...)
+
+	messages, err := griblib.ReadMessagesParallel(context.Background(), bytes.NewReader(file), griblib.DefaultReadOptions(), 4)
+	assert.True(t, errors.Is(err, griblib.ErrCorruptData), err)
+	assertSameMessages(t, expected[:1], messages)
+
+	options := griblib.DefaultReadOptions()
+	options.Tolerant = true
+	messages, err = griblib.ReadMessagesParallel(context.Background(), bytes.NewReader(file), options, 4)
+	require.NoError(t, err)
+	assertSameMessages(t, []*griblib.Message{expected[0], expected[0]}, messages)
+
+	// the end of the file is cut
+	messages, err = griblib.ReadMessagesParallel(context.Background(), bytes.NewReader(raw[:len(raw)-1]), griblib.DefaultReadOptions(), 4)
+	assert.True(t, errors.Is(err, griblib.ErrTruncatedMessage), err)
+	assertSameMessages(t, expected[:1], messages)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	messages, err = griblib.ReadMessagesParallel(ctx, bytes.NewReader(raw), griblib.DefaultReadOptions(), 4)
+	assert.Equal(t, context.Canceled, err)
+	assert.Empty(t, messages)
+}
@@ -1,6 +1,8 @@
 package gribtest
 
 import (
+	"bytes"
+	"context"
 	"os"
 	"testing"
 
@@ -16,3 +18,40 @@ func BenchmarkReadMessages(b *testing.B) {
 		griblib.ReadMessages(f)
 	}
 }
+
+func BenchmarkReadMessagesParallel(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		f, err := os.Open("../integrationtestdata/template5_3.grib2")
+		if err != nil {
+			b.Fatalf("Could not open test-file %v", err)
+		}
+		griblib.ReadMessagesParallel(context.Background(), f, griblib.DefaultReadOptions(), 0)
+	}
+}
+
+// benchmarkReadFile reads the messages of file from memory, to measure the unpacking rather than the disk
+func benchmarkReadFile(b *testing.B, file string) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		b.Fatalf("Could not open test-file %v", err)
+	}
+	b.SetBytes(int64(len(raw)))
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := griblib.ReadMessages(bytes.NewReader(raw)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadMessagesTemplate5_0(b *testing.B) {
+	benchmarkReadFile(b, "../integrationtestdata/template5_0.grib2")
+}
+
+func BenchmarkReadMessagesTemplate5_2(b *testing.B) {
+	benchmarkReadFile(b, "../integrationtestdata/template5_2.grib2")
+}
+
+func BenchmarkReadMessagesTemplate5_3(b *testing.B) {
+	benchmarkReadFile(b, "../integrationtestdata/template5_3.grib2")
+}
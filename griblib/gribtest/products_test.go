@@ -0,0 +1,190 @@
+package gribtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/nilsmagnus/grib/griblib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testProductHeader = griblib.Product0{
+	ParameterCategory: 1,
+	ParameterNumber:   8,
+	ProcessType:       2,
+	ForecastTime:      6,
+	FirstSurface:      griblib.Surface{Type: 1},
+	SecondSurface:     griblib.Surface{Type: 255},
+}
+
+var testTimeRange = griblib.TimeRangeSpecification{
+	StatisticalFieldCalculationProcess:                     1, // accumulation
+	IncrementBetweenSuccessiveFieldsType:                   2,
+	IncrementBetweenSuccessiveFieldsRangeTimeUnitIndicator: 1,
+	StatististicalProcessTimeLength:                        6,
+	IncrementBetweenSuccessiveFieldsTimeUnitIndicator:      255,
+}
+
+func Test_read_section4_products(t *testing.T) {
+	testCases := []struct {
+		templateNumber uint16
+		product        griblib.Product
+	}{
+		{0, testProductHeader},
+		{1, griblib.Product1{Product0: testProductHeader, EnsembleForecastType: 3, PertubationNumber: 7, ForecastInEnsembleCount: 30}},
+		{2, griblib.Product2{Product0: testProductHeader, DerivedForecast: 2, ForecastInEnsembleCount: 30}},
+		{5, griblib.Product5{Product0: testProductHeader, ProbabilityType: 1, ScaleFactorLowerLimit: 3, ScaleValueLowerLimit: 254}},
+		{6, griblib.Product6{Product0: testProductHeader, PercentileValue: 90}},
+		{7, griblib.Product7{Product0: testProductHeader}},
+	}
+
+	for _, testCase := range testCases {
+		var raw bytes.Buffer
+		require.NoError(t, binary.Write(&raw, binary.BigEndian, testCase.product))
+
+		section4, err := griblib.ReadSection4(section4Reader(testCase.templateNumber, raw.Bytes()), 0)
+
+		require.NoError(t, err, "template %d", testCase.templateNumber)
+		assert.Equal(t, testCase.product, section4.Product, "template %d", testCase.templateNumber)
+		assert.Equal(t, testProductHeader, section4.ProductDefinitionTemplate, "template %d", testCase.templateNumber)
+
+		var written bytes.Buffer
+		require.NoError(t, griblib.WriteProduct(&written, section4.Product))
+		assert.Equal(t, raw.Bytes(), written.Bytes(), "template %d should be written as read", testCase.templateNumber)
+	}
+}
+
+func Test_read_section4_statistical_products(t *testing.T) {
+	end := griblib.Time{Year: 2019, Month: 1, Day: 6, Hour: 18}
+	for _, count := range []uint8{1, 2, 4} {
+		product8 := griblib.Product8{Product0: testProductHeader, Time: end, NumberOfIntervalTimeRanges: count, TotalMissingDataValuesCount: 3}
+		product11 := griblib.Product11{
+			Product1: griblib.Product1{Product0: testProductHeader, EnsembleForecastType: 3, PertubationNumber: 7, ForecastInEnsembleCount: 30},
+			Time:     end, NumberOfIntervalTimeRanges: count,
+		}
+		product12 := griblib.Product12{
+			Product2: griblib.Product2{Product0: testProductHeader, DerivedForecast: 2, ForecastInEnsembleCount: 30},
+			Time:     end, NumberOfIntervalTimeRanges: count,
+		}
+		ranges := make([]griblib.TimeRangeSpecification, count)
+		for i := range ranges {
+			ranges[i] = testTimeRange
+			ranges[i].StatististicalProcessTimeLength = uint32(i + 1)
+		}
+		product8.TimeRangeSpecification1, product11.TimeRangeSpecification1, product12.TimeRangeSpecification1 = ranges[0], ranges[0], ranges[0]
+		if count > 1 {
+			product8.TimeRangeSpecification2, product11.TimeRangeSpecification2, product12.TimeRangeSpecification2 = ranges[1], ranges[1], ranges[1]
+		}
+		if count > 2 {
+			product8.AdditionalTimeRangeSpecifications = ranges[2:]
+			product11.AdditionalTimeRangeSpecifications = ranges[2:]
+			product12.AdditionalTimeRangeSpecifications = ranges[2:]
+		}
+
+		for _, testCase := range []struct {
+			templateNumber uint16
+			fixed          interface{}
+			product        griblib.Product
+		}{
+			{8, product8.Product0, product8},
+			{11, product11.Product1, product11},
+			{12, product12.Product2, product12},
+		} {
+			var raw bytes.Buffer
+			require.NoError(t, binary.Write(&raw, binary.BigEndian, testCase.fixed))
+			require.NoError(t, binary.Write(&raw, binary.BigEndian, end))
+			require.NoError(t, binary.Write(&raw, binary.BigEndian, count))
+			missing := uint32(0)
+			if testCase.templateNumber == 8 {
+				missing = 3
+			}
+			require.NoError(t, binary.Write(&raw, binary.BigEndian, missing))
+			require.NoError(t, binary.Write(&raw, binary.BigEndian, ranges))
+
+			section4, err := griblib.ReadSection4(section4Reader(testCase.templateNumber, raw.Bytes()), 0)
+
+			require.NoError(t, err, "template %d with %d time ranges", testCase.templateNumber, count)
+			assert.Equal(t, testCase.product, section4.Product, "template %d with %d time ranges", testCase.templateNumber, count)
+			assert.Equal(t, testProductHeader, section4.Product.Header())
+
+			var written bytes.Buffer
+			require.NoError(t, griblib.WriteProduct(&written, section4.Product))
+			assert.Equal(t, raw.Bytes(), written.Bytes(), "template %d should be written as read", testCase.templateNumber)
+		}
+	}
+}
+
+func Test_read_section4_unsupported_product(t *testing.T) {
+	section4, err := griblib.ReadSection4(section4Reader(20, make([]byte, 30)), 0)
+
+	assert.NoError(t, err)
+	assert.Nil(t, section4.Product)
+	assert.Equal(t, griblib.Product0{}, section4.ProductDefinitionTemplate)
+}
+
+func Test_read_section4_truncated_product(t *testing.T) {
+	var raw bytes.Buffer
+	require.NoError(t, binary.Write(&raw, binary.BigEndian, testProductHeader))
+
+	_, err := griblib.ReadSection4(section4Reader(8, raw.Bytes()), 0)
+
+	assert.Error(t, err)
+}
+
+// section4Reader returns the content of section 4 without coordinates, for the given template
+func section4Reader(templateNumber uint16, template []byte) *bytes.Reader {
+	raw := binary.BigEndian.AppendUint16(nil, 0)
+	raw = binary.BigEndian.AppendUint16(raw, templateNumber)
+	return bytes.NewReader(append(raw, template...))
+}
+
+func Test_write_product_inconsistent_time_ranges(t *testing.T) {
+	product := griblib.Product8{Product0: testProductHeader, NumberOfIntervalTimeRanges: 3}
+
+	assert.Error(t, griblib.WriteProduct(&bytes.Buffer{}, product))
+}
+
+func Test_section4_json(t *testing.T) {
+	end := griblib.Time{Year: 2019, Month: 1, Day: 6, Hour: 18}
+	products := map[uint16]griblib.Product{
+		0:  testProductHeader,
+		1:  griblib.Product1{Product0: testProductHeader, EnsembleForecastType: 3, PertubationNumber: 7, ForecastInEnsembleCount: 30},
+		6:  griblib.Product6{Product0: testProductHeader, PercentileValue: 90},
+		8:  griblib.Product8{Product0: testProductHeader, Time: end, NumberOfIntervalTimeRanges: 1, TimeRangeSpecification1: testTimeRange},
+		12: griblib.Product12{Product2: griblib.Product2{Product0: testProductHeader, DerivedForecast: 2}, Time: end},
+	}
+	for templateNumber, product := range products {
+		section4 := griblib.Section4{
+			ProductDefinitionTemplateNumber: templateNumber,
+			ProductDefinitionTemplate:       product.Header(),
+			Product:                         product,
+			Coordinates:                     []byte{},
+		}
+		js, err := json.Marshal(section4)
+		require.NoError(t, err)
+		assert.Equal(t, 1, strings.Count(string(js), `"parameterCategory"`), "the product is written once: %s", js)
+
+		var read griblib.Section4
+		require.NoError(t, json.Unmarshal(js, &read), "template %d", templateNumber)
+		assert.Equal(t, section4, read, "template %d", templateNumber)
+	}
+
+	// an unsupported template only has its header
+	section4 := griblib.Section4{ProductDefinitionTemplateNumber: 20, ProductDefinitionTemplate: testProductHeader}
+	js, err := json.Marshal(section4)
+	require.NoError(t, err)
+	var read griblib.Section4
+	require.NoError(t, json.Unmarshal(js, &read))
+	assert.Equal(t, section4, read)
+
+	// the messages of a file survive a round trip through json
+	message := openGrib(t, "../integrationtestdata/template5_0.grib2")[0]
+	js, err = json.Marshal(message.Section4)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(js, &read))
+	assert.Equal(t, message.Section4, read)
+}
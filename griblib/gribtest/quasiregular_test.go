@@ -0,0 +1,196 @@
+package gribtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/nilsmagnus/grib/griblib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reducedRows are the values of the rows of a quasi-regular grid of 4, 2 and 1 points
+var reducedRows = [][]float64{{0, 1, 2, 3}, {10, 20}, {7}}
+
+// reducedMessage returns the raw bytes of the first message of template5_0.grib2 moved to a quasi-regular grid
+// of template 3.0 or 3.40 with reducedRows, the rows spanning the longitudes from 0 to lo2
+func reducedMessage(t *testing.T, templateNumber uint16, interpretation uint8, lo2 int32) []byte {
+	t.Helper()
+	message := openGrib(t, "../integrationtestdata/template5_0.grib2")[0]
+
+	section := griblib.Section3{PointCountOctets: 2, PointCountInterpretation: interpretation, TemplateNumber: templateNumber}
+	var data []float64
+	for _, row := range reducedRows {
+		section.PointCounts = append(section.PointCounts, uint32(len(row)))
+		data = append(data, row...)
+	}
+	section.DataPointCount = uint32(len(data))
+	message.Section7.Data = data
+
+	// the number of points along a parallel and the increment are missing in a quasi-regular grid
+	switch templateNumber {
+	case 0:
+		section.Definition = &griblib.Grid0{Ni: math.MaxUint32, Nj: 3, La1: 60_000_000, Lo2: lo2, Di: -1, Dj: 30_000_000}
+	case 40:
+		section.Definition = &griblib.Grid40{Ni: math.MaxUint32, Nj: 3, La1: 60_000_000, Lo2: lo2, Di: -1, N: 2}
+	}
+	message.Section3 = section
+
+	var written bytes.Buffer
+	require.NoError(t, griblib.WriteMessage(&written, message))
+	return written.Bytes()
+}
+
+func Test_read_quasi_regular_grid(t *testing.T) {
+	for _, templateNumber := range []uint16{0, 40} {
+		messages, err := griblib.ReadMessages(bytes.NewReader(reducedMessage(t, templateNumber, 1, 90_000_000)))
+		require.NoError(t, err)
+		message := messages[0]
+
+		assert.Equal(t, []uint32{4, 2, 1}, message.Section3.PointCounts)
+		assert.Equal(t, uint8(1), message.Section3.PointCountInterpretation)
+		assert.Equal(t, uint32(7), message.Section3.DataPointCount)
+		assert.InDeltaSlice(t, []float64{0, 1, 2, 3, 10, 20, 7}, message.Data(), 1e-6)
+	}
+}
+
+func Test_regularize(t *testing.T) {
+	tests := []struct {
+		name           string
+		interpretation uint8
+		lo2            int32
+		expectedLo2    int32
+		expectedDi     int32
+		expectedData   []float64
+	}{
+		{
+			name:           "rows spanning a full circle",
+			interpretation: 2,
+			lo2:            -1,
+			expectedLo2:    270_000_000,
+			expectedDi:     90_000_000,
+			expectedData:   []float64{0, 1, 2, 3, 10, 15, 20, 15, 7, 7, 7, 7},
+		},
+		{
+			name:           "rows from Lo1 to Lo2 around the globe",
+			interpretation: 1,
+			lo2:            270_000_000,
+			expectedLo2:    270_000_000,
+			expectedDi:     90_000_000,
+			expectedData:   []float64{0, 1, 2, 3, 10, 15, 20, 15, 7, 7, 7, 7},
+		},
+		{
+			name:           "rows from Lo1 to Lo2",
+			interpretation: 1,
+			lo2:            90_000_000,
+			expectedLo2:    90_000_000,
+			expectedDi:     30_000_000,
+			expectedData:   []float64{0, 1, 2, 3, 10, 10 + 10.0/3, 20 - 10.0/3, 20, 7, 7, 7, 7},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, templateNumber := range []uint16{0, 40} {
+				messages, err := griblib.ReadMessages(bytes.NewReader(reducedMessage(t, templateNumber, test.interpretation, test.lo2)))
+				require.NoError(t, err)
+				message := messages[0]
+
+				require.NoError(t, message.Regularize())
+				assert.InDeltaSlice(t, test.expectedData, message.Data(), 1e-6)
+				assert.Equal(t, uint32(12), message.Section3.DataPointCount)
+				assert.Nil(t, message.Section3.PointCounts)
+				assert.Zero(t, message.Section3.PointCountOctets)
+
+				switch grid := message.Section3.Definition.(type) {
+				case *griblib.Grid0:
+					assert.Equal(t, uint32(4), grid.Ni)
+					assert.Equal(t, test.expectedLo2, grid.Lo2)
+					assert.Equal(t, test.expectedDi, grid.Di)
+				case *griblib.Grid40:
+					assert.Equal(t, uint32(4), grid.Ni)
+					assert.Equal(t, test.expectedLo2, grid.Lo2)
+					assert.Equal(t, test.expectedDi, grid.Di)
+				default:
+					t.Fatalf("Unexpected grid %T", grid)
+				}
+
+				// a regular grid is left as it is
+				require.NoError(t, message.Regularize())
+				assert.Len(t, message.Data(), 12)
+			}
+		})
+	}
+}
+
+func Test_read_regularized(t *testing.T) {
+	raw := reducedMessage(t, 0, 2, -1)
+	expected := []float64{0, 1, 2, 3, 10, 15, 20, 15, 7, 7, 7, 7}
+
+	options := griblib.DefaultReadOptions()
+	options.Regularize = true
+	messages, err := griblib.ReadMessagesWithOptions(bytes.NewReader(raw), options)
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, expected, messages[0].Data(), 1e-6)
+	assert.Nil(t, messages[0].Section3.PointCounts)
+
+	// with the headers only, the grid is regularized when the data is decoded into the message
+	options = headersOnly()
+	options.Regularize = true
+	messages, err = griblib.ReadMessagesWithOptions(bytes.NewReader(raw), options)
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{4, 2, 1}, messages[0].Section3.PointCounts)
+	assert.InDeltaSlice(t, expected, messages[0].Data(), 1e-6)
+	assert.Equal(t, []uint32{4, 2, 1}, messages[0].Section3.PointCounts)
+	require.NoError(t, messages[0].Decode())
+	assert.Nil(t, messages[0].Section3.PointCounts)
+	assert.Equal(t, uint32(4), messages[0].Section3.Definition.(*griblib.Grid0).Ni)
+
+	// the regularized message is written as a regular grid
+	var written bytes.Buffer
+	require.NoError(t, griblib.WriteMessage(&written, messages[0]))
+	read, err := griblib.ReadMessages(&written)
+	require.NoError(t, err)
+	assert.Equal(t, messages[0].Section3, read[0].Section3)
+	assert.InDeltaSlice(t, expected, read[0].Data(), 1e-6)
+}
+
+func Test_read_quasi_regular_grid_corrupt_point_counts(t *testing.T) {
+	raw := reducedMessage(t, 0, 1, 90_000_000)
+	section3 := sections(raw)[3]
+	length := int(binary.BigEndian.Uint32(raw[section3:]))
+	// the last number of points, of the third row, becomes 2
+	binary.BigEndian.PutUint16(raw[section3+length-2:], 2)
+
+	_, err := griblib.ReadMessages(bytes.NewReader(raw))
+	assert.True(t, errors.Is(err, griblib.ErrCorruptData), "got %v", err)
+}
+
+func Test_regularize_corrupt_point_counts(t *testing.T) {
+	// the numbers of points of a message built by the caller are not checked when it is read
+	quasiRegular := func(counts []uint32, points int) *griblib.Message {
+		return &griblib.Message{
+			Section3: griblib.Section3{
+				DataPointCount: uint32(points),
+				PointCounts:    counts,
+				Definition:     &griblib.Grid0{Ni: math.MaxUint32, Nj: uint32(len(counts)), Di: -1},
+			},
+			Section7: griblib.Section7{Data: make([]float64, points)},
+		}
+	}
+
+	// more points in the rows than values
+	err := quasiRegular([]uint32{4, 2, 5}, 7).Regularize()
+	assert.True(t, errors.Is(err, griblib.ErrCorruptData), "got %v", err)
+
+	// a row holding nearly all points makes the regular grid far larger than the message
+	skewed := make([]uint32, 100_000)
+	skewed[0] = 100_000
+	message := quasiRegular(skewed, 100_000)
+	err = message.Regularize()
+	assert.True(t, errors.Is(err, griblib.ErrCorruptData), "got %v", err)
+	assert.Len(t, message.Data(), 100_000)
+}
@@ -1 +1,185 @@
 package gribtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/nilsmagnus/grib/griblib"
+	"github.com/nilsmagnus/grib/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_reduce_selects_messages(t *testing.T) {
+	raw := readGfs(t)
+	messages, err := griblib.ReadMessages(bytes.NewReader(raw))
+	require.NoError(t, err)
+	chunks := splitMessages(t, raw)
+
+	options := griblib.Options{
+		Discipline: 0,
+		Category:   2,
+		Parameters: []int{2, 3},
+		Surface:    griblib.Surface{Type: 100, Value: 50000},
+	}
+	var reduced bytes.Buffer
+	require.NoError(t, griblib.Reduce(bytes.NewReader(raw), &reduced, options))
+
+	// the selected messages are copied as they are
+	var expected []byte
+	for i, message := range messages {
+		if griblib.FilterMessage(message, options) {
+			expected = append(expected, chunks[i]...)
+		}
+	}
+	assert.Equal(t, expected, reduced.Bytes())
+
+	read, err := griblib.ReadMessages(&reduced)
+	require.NoError(t, err)
+	require.Len(t, read, 2, "the u and v winds at 500 mb")
+	for _, message := range read {
+		assert.Contains(t, []uint8{2, 3}, message.Section4.ProductDefinitionTemplate.ParameterNumber)
+	}
+}
+
+func Test_reduce_without_filters(t *testing.T) {
+	raw := readGfs(t)
+	var reduced bytes.Buffer
+	require.NoError(t, griblib.Reduce(bytes.NewReader(raw), &reduced, griblib.Options{Discipline: -1, Category: -1}))
+	assert.Equal(t, raw, reduced.Bytes())
+}
+
+func Test_reduce_on_forecast_time(t *testing.T) {
+	raw := readGfs(t)
+	var reduced bytes.Buffer
+	require.NoError(t, griblib.Reduce(bytes.NewReader(raw), &reduced, griblib.Options{Discipline: -1, Category: -1, ForecastTimes: []int{6}}))
+	assert.Empty(t, reduced.Bytes(), "the file only holds analyses")
+}
+
+func Test_reduce_undecodable_templates(t *testing.T) {
+	chunks := splitMessages(t, readGfs(t))
+	// the first message gets the data template 5.50 (spectral data), the second the grid template 3.1
+	// (rotated latitude/longitude), neither of which can be decoded
+	spectral := append([]byte{}, chunks[0]...)
+	binary.BigEndian.PutUint16(spectral[sections(spectral)[5]+9:], 50)
+	rotated := append([]byte{}, chunks[1]...)
+	binary.BigEndian.PutUint16(rotated[sections(rotated)[3]+12:], 1)
+	raw := append(append(append([]byte{}, spectral...), rotated...), chunks[2]...)
+
+	_, err := griblib.ReadMessages(bytes.NewReader(raw))
+	require.Error(t, err, "the templates can not be decoded")
+
+	var reduced bytes.Buffer
+	require.NoError(t, griblib.Reduce(bytes.NewReader(raw), &reduced, griblib.Options{Discipline: -1, Category: -1}))
+	assert.Equal(t, raw, reduced.Bytes())
+
+	messages, err := griblib.ReadMessages(bytes.NewReader(chunks[0]))
+	require.NoError(t, err)
+	reduced.Reset()
+	options := griblib.Options{
+		Discipline: -1,
+		Category:   int(messages[0].Section4.ProductDefinitionTemplate.ParameterCategory),
+		Parameters: []int{int(messages[0].Section4.ProductDefinitionTemplate.ParameterNumber)},
+	}
+	require.NoError(t, griblib.Reduce(bytes.NewReader(raw), &reduced, options))
+	assert.Equal(t, spectral, reduced.Bytes())
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func Test_reduce_errors(t *testing.T) {
+	raw := readGfs(t)
+	options := griblib.Options{Discipline: -1, Category: -1}
+
+	err := griblib.Reduce(bytes.NewReader(raw[:len(raw)-10]), &bytes.Buffer{}, options)
+	var truncated *griblib.TruncatedMessageError
+	require.True(t, errors.As(err, &truncated), "the last message is truncated")
+	chunks := splitMessages(t, raw)
+	last := chunks[len(chunks)-1]
+	assert.Equal(t, int64(len(raw)-len(last)), truncated.Offset)
+	assert.Equal(t, int64(len(last)), truncated.Length)
+	assert.Equal(t, int64(len(last)-10), truncated.Read)
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+
+	err = griblib.Reduce(bytes.NewReader(raw[:len(chunks[0])+5]), &bytes.Buffer{}, options)
+	require.True(t, errors.As(err, &truncated), "section 0 of the second message is truncated")
+	assert.Equal(t, griblib.TruncatedMessageError{Offset: int64(len(chunks[0])), Length: 16, Read: 5}, *truncated)
+
+	err = griblib.Reduce(bytes.NewReader(append([]byte("JUNK"), raw...)), &bytes.Buffer{}, options)
+	assert.Error(t, err, "the file does not start with a message")
+
+	err = griblib.Reduce(bytes.NewReader(raw), failingWriter{}, options)
+	assert.EqualError(t, err, "disk full")
+
+	assert.NoError(t, griblib.Reduce(bytes.NewReader(nil), &bytes.Buffer{}, options))
+}
+
+// oneByteReader returns a reader delivering data one octet per call to Read
+func oneByteReader(t *testing.T, data []byte) io.Reader {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	rd := mocks.NewMockReader(ctrl)
+	rd.EXPECT().Read(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) {
+		if len(data) == 0 {
+			return 0, io.EOF
+		}
+		if len(p) == 0 {
+			return 0, nil
+		}
+		p[0] = data[0]
+		data = data[1:]
+		return 1, nil
+	})
+	return rd
+}
+
+// firstMessages returns the octets of the first n messages of the gfs file
+func firstMessages(t *testing.T, n int) []byte {
+	raw := []byte{}
+	for _, chunk := range splitMessages(t, readGfs(t))[:n] {
+		raw = append(raw, chunk...)
+	}
+	return raw
+}
+
+func Test_reduce_short_reads(t *testing.T) {
+	raw := firstMessages(t, 3)
+	options := griblib.Options{Discipline: -1, Category: -1}
+
+	var reduced bytes.Buffer
+	require.NoError(t, griblib.Reduce(oneByteReader(t, raw), &reduced, options))
+	assert.Equal(t, raw, reduced.Bytes())
+
+	err := griblib.Reduce(oneByteReader(t, raw[:len(raw)-1]), &bytes.Buffer{}, options)
+	var truncated *griblib.TruncatedMessageError
+	assert.True(t, errors.As(err, &truncated))
+}
+
+func Test_read_messages_short_reads(t *testing.T) {
+	raw := firstMessages(t, 3)
+	expected, err := griblib.ReadMessages(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	messages, err := griblib.ReadMessages(oneByteReader(t, raw))
+	require.NoError(t, err)
+	require.Len(t, messages, len(expected))
+	for i, message := range messages {
+		assert.Equal(t, expected[i].Section4, message.Section4)
+		assert.Equal(t, len(expected[i].Data()), len(message.Data()))
+	}
+
+	scanner := griblib.NewScanner(oneByteReader(t, raw[:len(raw)-1]))
+	for scanner.Next() {
+	}
+	var truncated *griblib.TruncatedMessageError
+	assert.True(t, errors.As(scanner.Err(), &truncated), "the scanner reports the truncated message")
+}
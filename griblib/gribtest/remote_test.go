@@ -0,0 +1,187 @@
+package gribtest
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nilsmagnus/grib/griblib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gribServer serves a grib file with range requests, its .idx file and counts the octets served
+type gribServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	requests int
+	served   int64
+}
+
+func newGribServer(t *testing.T, raw []byte, ranges bool) *gribServer {
+	var idx bytes.Buffer
+	index, err := griblib.BuildIndex(bytes.NewReader(raw))
+	require.NoError(t, err)
+	require.NoError(t, griblib.WriteIdx(&idx, index))
+
+	server := &gribServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gfs.grib2.idx":
+			w.Write(idx.Bytes())
+		case "/gfs.grib2":
+			// the request and its octets are counted before they are written, the client can not see them first
+			server.mutex.Lock()
+			server.requests++
+			server.mutex.Unlock()
+			counter := &countingWriter{ResponseWriter: w, server: server}
+			if ranges {
+				http.ServeContent(counter, r, "gfs.grib2", time.Time{}, bytes.NewReader(raw))
+			} else {
+				counter.Write(raw)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// counts returns the number of requests of the file and the octets served
+func (server *gribServer) counts() (int, int64) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.requests, server.served
+}
+
+// countingWriter counts the octets of the file in a response to server
+type countingWriter struct {
+	http.ResponseWriter
+	server *gribServer
+	status int
+}
+
+func (w *countingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	if w.status < http.StatusBadRequest {
+		w.server.mutex.Lock()
+		w.server.served += int64(len(p))
+		w.server.mutex.Unlock()
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func readGfs(t *testing.T) []byte {
+	raw, err := os.ReadFile("../integrationtestdata/gfs.t00z.pgrb2.2p50.f000")
+	require.NoError(t, err)
+	return raw
+}
+
+func Test_remote_read_messages(t *testing.T) {
+	raw := readGfs(t)
+	server := newGribServer(t, raw, true)
+	remote := griblib.NewRemote(server.URL+"/gfs.grib2", nil)
+
+	index, err := remote.ReadIdx(server.URL + "/gfs.grib2.idx")
+	require.NoError(t, err)
+	selected := index.Select(func(entry griblib.IndexEntry) bool {
+		return entry.Variable == "TMP" && strings.HasSuffix(entry.Level, " mb")
+	})
+	require.NotEmpty(t, selected)
+
+	messages, err := remote.ReadMessages(selected)
+	require.NoError(t, err)
+	require.Len(t, messages, len(selected))
+	for i, message := range messages {
+		expected, err := griblib.ReadMessageAt(bytes.NewReader(raw), selected[i])
+		require.NoError(t, err)
+		assert.Equal(t, expected.Section4, message.Section4)
+		assert.Equal(t, expected.Data(), message.Data())
+	}
+
+	var size int64
+	for _, entry := range selected {
+		size += entry.Length
+	}
+	requests, served := server.counts()
+	assert.Equal(t, size, served, "only the selected messages are downloaded")
+	assert.Equal(t, len(selected), requests)
+}
+
+func Test_remote_consecutive_and_last_messages(t *testing.T) {
+	raw := readGfs(t)
+	server := newGribServer(t, raw, true)
+	remote := griblib.NewRemote(server.URL+"/gfs.grib2", nil)
+	index, err := remote.ReadIdx(server.URL + "/gfs.grib2.idx")
+	require.NoError(t, err)
+
+	// the length of the last message is not in the .idx file
+	selected := index[len(index)-3:]
+	messages, err := remote.ReadMessages(selected)
+	require.NoError(t, err)
+	assert.Len(t, messages, 3)
+	requests, served := server.counts()
+	assert.Equal(t, 1, requests, "consecutive messages are downloaded at once")
+	assert.Equal(t, int64(len(raw))-selected[0].Offset, served)
+}
+
+func Test_remote_probe_index(t *testing.T) {
+	raw := readGfs(t)
+	server := newGribServer(t, raw, true)
+	remote := griblib.NewRemote(server.URL+"/gfs.grib2", nil)
+
+	probed, err := remote.ProbeIndex()
+	require.NoError(t, err)
+	index, err := griblib.BuildIndex(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	require.Len(t, probed, len(index))
+	for i, entry := range index {
+		assert.Equal(t, entry.Offset, probed[i].Offset)
+		assert.Equal(t, entry.Length, probed[i].Length)
+		assert.Equal(t, entry.Discipline, probed[i].Discipline)
+	}
+	requests, served := server.counts()
+	assert.Equal(t, int64(16*len(index)), served)
+	assert.Equal(t, len(index)+1, requests, "the end of the file is found by the last request")
+
+	message, err := griblib.ReadMessageAt(remote, probed[5])
+	require.NoError(t, err)
+	expected, err := griblib.ReadMessageAt(bytes.NewReader(raw), index[5])
+	require.NoError(t, err)
+	assert.Equal(t, expected.Section4, message.Section4)
+}
+
+func Test_remote_without_range_requests(t *testing.T) {
+	server := newGribServer(t, readGfs(t), false)
+	remote := griblib.NewRemote(server.URL+"/gfs.grib2", nil)
+
+	_, err := remote.ProbeIndex()
+	assert.Error(t, err)
+	_, err = remote.ReadMessages(griblib.Index{{Offset: 0, Length: 100}})
+	assert.Error(t, err)
+	_, err = remote.ReadIdx(server.URL + "/missing.idx")
+	assert.Error(t, err)
+}
+
+func Test_index_byte_ranges(t *testing.T) {
+	index := griblib.Index{
+		{Offset: 0, Length: 10},
+		{Offset: 10, Length: 5},
+		{Offset: 10, Length: 5},
+		{Offset: 30, Length: 10},
+		{Offset: 40, Length: 0},
+	}
+	assert.Equal(t, []griblib.ByteRange{{Offset: 0, Length: 15}, {Offset: 30, Length: 0}}, index.ByteRanges())
+	assert.Empty(t, griblib.Index{}.ByteRanges())
+}
@@ -0,0 +1,100 @@
+package gribtest
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/nilsmagnus/grib/griblib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dataHeader returns the header of the data template in section 5 of message
+func dataHeader(t *testing.T, message *griblib.Message) griblib.Data0 {
+	t.Helper()
+	template, err := message.Section5.GetDataTemplate()
+	require.NoError(t, err)
+	switch x := template.(type) {
+	case griblib.Data0:
+		return x
+	case griblib.Data2:
+		return x.Data0
+	case griblib.Data3:
+		return x.Data0
+	}
+	t.Fatalf("Data template %T has no header", template)
+	return griblib.Data0{}
+}
+
+func Test_read_negative_scales(t *testing.T) {
+	messages := openGrib(t, "../integrationtestdata/negative_scales.grib2")
+	require.Len(t, messages, 3)
+
+	ugrd := openCsv(t, "../integrationtestdata/template_ugrd.csv")
+	vgrd := openCsv(t, "../integrationtestdata/template_vgrd.csv")
+
+	for i, fixtures := range [][]float64{ugrd, vgrd, ugrd} {
+		assert.Equal(t, []uint16{0, 2, 3}[i], messages[i].Section5.DataTemplateNumber)
+
+		header := dataHeader(t, messages[i])
+		assert.Equal(t, int16(-10), header.BinaryScale)
+		assert.Equal(t, int16(-1), header.DecimalScale)
+
+		// the values are packed with a precision of 2^-10 * 10^1
+		require.Len(t, messages[i].Data(), len(fixtures))
+		assert.InDeltaSlice(t, fixtures, messages[i].Data(), 0.5*math.Ldexp(10, -10)+1e-5)
+	}
+}
+
+func Test_read_negative_decimal_scale(t *testing.T) {
+	// the ventilation rate of the gfs file is sent in thousands of m2 s-1
+	message := openGrib(t, "../integrationtestdata/gfs.t00z.pgrb2.2p50.f000")[2]
+	require.Equal(t, uint8(224), message.Section4.ProductDefinitionTemplate.ParameterNumber)
+
+	assert.Equal(t, int16(-3), dataHeader(t, message).DecimalScale)
+
+	maxValue := 0.0
+	for _, value := range message.Data() {
+		assert.Equal(t, 0.0, math.Mod(value, 1000), "values are thousands")
+		maxValue = math.Max(maxValue, value)
+	}
+	assert.Equal(t, 86000.0, maxValue)
+}
+
+func Test_write_negative_scales(t *testing.T) {
+	message := openGrib(t, "../integrationtestdata/negative_scales.grib2")[2]
+
+	options := griblib.DefaultWriteOptions(message)
+	assert.Equal(t, griblib.WriteOptions{DecimalScale: -1, BinaryScale: -10, DataTemplate: 3, SpatialDifferencingOrder: 2}, options)
+
+	var written bytes.Buffer
+	require.NoError(t, griblib.WriteMessageWithOptions(&written, message, griblib.WriteOptions{DecimalScale: 4, DataTemplate: 3}))
+	read, err := griblib.ReadMessages(&written)
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, message.Data(), read[0].Data(), 0.5e-4+1e-9)
+}
+
+func Test_write_negative_scales_round_trip(t *testing.T) {
+	messages := openGrib(t, "../integrationtestdata/negative_scales.grib2")
+
+	var written bytes.Buffer
+	for _, message := range messages {
+		require.NoError(t, griblib.WriteMessage(&written, message))
+	}
+	read, err := griblib.ReadMessages(&written)
+	require.NoError(t, err)
+	require.Len(t, read, len(messages))
+
+	for i, message := range messages {
+		source := dataHeader(t, message)
+		header := dataHeader(t, read[i])
+		assert.Equal(t, source.BinaryScale, header.BinaryScale)
+		assert.Equal(t, source.DecimalScale, header.DecimalScale)
+
+		// unchanged values are written back within half of the packing step of the source, 2^-10 * 10^1
+		step := math.Ldexp(math.Pow10(-int(source.DecimalScale)), int(source.BinaryScale))
+		assert.InDeltaSlice(t, message.Data(), read[i].Data(), 0.5*step, "message %d", i)
+	}
+	assert.Equal(t, dataHeader(t, messages[0]).Bits, dataHeader(t, read[0]).Bits, "simple packing keeps its bits")
+}
@@ -0,0 +1,240 @@
+package gribtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/nilsmagnus/grib/griblib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_scanner_reads_all_messages(t *testing.T) {
+	raw, err := os.ReadFile("../integrationtestdata/gfs.t00z.pgrb2.2p50.f000")
+	require.NoError(t, err)
+	expected, err := griblib.ReadMessages(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	scanner := griblib.NewScanner(bytes.NewReader(raw))
+	count := 0
+	for scanner.Next() {
+		require.Less(t, count, len(expected))
+		assert.Equal(t, expected[count].Section4, scanner.Message().Section4)
+		assert.Equal(t, len(expected[count].Data()), len(scanner.Message().Data()))
+		count++
+	}
+
+	assert.NoError(t, scanner.Err())
+	assert.Equal(t, len(expected), count)
+	assert.False(t, scanner.Next(), "the scanner should stay at the end of the file")
+	assert.Nil(t, scanner.Message())
+}
+
+func Test_scanner_empty_file(t *testing.T) {
+	scanner := griblib.NewScanner(bytes.NewReader(nil))
+
+	assert.False(t, scanner.Next())
+	assert.NoError(t, scanner.Err())
+}
+
+func Test_scanner_stops_at_corrupt_message(t *testing.T) {
+	raw, err := os.ReadFile("../integrationtestdata/template5_0.grib2")
+	require.NoError(t, err)
+	chunks := splitMessages(t, raw)
+
+	corrupt := append([]byte{}, chunks[1]...)
+	binary.BigEndian.PutUint16(corrupt[sections(corrupt)[5]+9:], 99)
+
+	scanner := griblib.NewScanner(bytes.NewReader(append(append([]byte{}, chunks[0]...), corrupt...)))
+
+	assert.True(t, scanner.Next())
+	assert.NotNil(t, scanner.Message())
+	assert.False(t, scanner.Next())
+	assert.Error(t, scanner.Err())
+	assert.False(t, scanner.Next())
+}
+
+func Test_export_scanner(t *testing.T) {
+	raw, err := os.ReadFile("../integrationtestdata/gfs.t00z.pgrb2.2p50.f000")
+	require.NoError(t, err)
+	messages, err := griblib.ReadMessages(bytes.NewReader(raw))
+	require.NoError(t, err)
+	options := griblib.Options{Discipline: 0, Category: 2, ExportType: griblib.PrintMessageCategories}
+	expected := len(griblib.Filter(messages, options))
+	require.NotZero(t, expected)
+
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	defer log.SetOutput(os.Stderr)
+	err = griblib.ExportScanner(griblib.NewScanner(bytes.NewReader(raw)), options)
+
+	require.NoError(t, err)
+	assert.Equal(t, expected, strings.Count(output.String(), "\n"))
+}
+
+func Test_tolerant_scanner_skips_junk(t *testing.T) {
+	chunks := splitMessages(t, firstMessages(t, 3))
+	header := []byte("TTAA00 KWBC 220000\r\r\n")
+	// a false marker, which is not a grib 2 message, and the start of one at the end
+	junk := []byte("GRIB\x00\x00\x00\x01 padding GRI")
+
+	var raw []byte
+	raw = append(raw, header...)
+	raw = append(raw, chunks[0]...)
+	raw = append(raw, junk...)
+	raw = append(raw, chunks[1]...)
+	raw = append(raw, chunks[2]...)
+	raw = append(raw, "\x00\x00\x00\x00"...)
+
+	for name, reader := range map[string]func() io.Reader{
+		"all at once":   func() io.Reader { return bytes.NewReader(raw) },
+		"byte per byte": func() io.Reader { return oneByteReader(t, raw) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			options := griblib.DefaultReadOptions()
+			options.Tolerant = true
+			scanner := griblib.NewScannerWithOptions(reader(), options)
+			count := 0
+			for scanner.Next() {
+				count++
+			}
+			require.NoError(t, scanner.Err())
+			assert.Equal(t, 3, count)
+
+			warnings := scanner.Warnings()
+			require.Len(t, warnings, 3)
+			assert.Equal(t, int64(0), warnings[0].Offset)
+			assert.Equal(t, int64(len(header)), warnings[0].Length)
+			assert.Equal(t, int64(len(header)+len(chunks[0])), warnings[1].Offset)
+			assert.Equal(t, int64(len(junk)), warnings[1].Length)
+			assert.Equal(t, int64(len(raw)-4), warnings[2].Offset)
+			assert.Equal(t, int64(4), warnings[2].Length)
+			assert.Contains(t, warnings[0].Error(), "Skipped 21 octets at offset 0")
+		})
+	}
+
+	// without the option, the scanner stops at the header
+	scanner := griblib.NewScanner(bytes.NewReader(raw))
+	assert.False(t, scanner.Next())
+	assert.Error(t, scanner.Err())
+	assert.Empty(t, scanner.Warnings())
+}
+
+func Test_tolerant_scanner_skips_corrupt_messages(t *testing.T) {
+	raw, err := os.ReadFile("../integrationtestdata/template5_0.grib2")
+	require.NoError(t, err)
+	chunks := splitMessages(t, raw)
+	require.True(t, len(chunks) >= 2)
+
+	// an unsupported data template, a message cut short and a message without its end section
+	unsupported := append([]byte{}, chunks[1]...)
+	binary.BigEndian.PutUint16(unsupported[sections(unsupported)[5]+9:], 99)
+	cut := chunks[1][:len(chunks[1])/2]
+	unterminated := append([]byte{}, chunks[1]...)
+	copy(unterminated[len(unterminated)-4:], "0000")
+
+	var corrupt []byte
+	for _, chunk := range [][]byte{chunks[0], unsupported, cut, unterminated, chunks[0]} {
+		corrupt = append(corrupt, chunk...)
+	}
+
+	options := griblib.DefaultReadOptions()
+	options.Tolerant = true
+	scanner := griblib.NewScannerWithOptions(bytes.NewReader(corrupt), options)
+	count := 0
+	for scanner.Next() {
+		count++
+	}
+	require.NoError(t, scanner.Err())
+	assert.Equal(t, 2, count, "the first message is read twice")
+
+	warnings := scanner.Warnings()
+	require.Len(t, warnings, 3)
+	offset := int64(len(chunks[0]))
+	assert.Equal(t, griblib.Warning{Offset: offset, Length: int64(len(unsupported)), Err: warnings[0].Err}, warnings[0])
+	assert.Equal(t, griblib.ErrUnsupportedTemplate{Section: 5, Number: 99}, warnings[0].Err)
+	offset += int64(len(unsupported))
+	// the cut message claims the octets of the next one, the scanner finds its way back to the next 'GRIB'
+	assert.Equal(t, offset, warnings[1].Offset)
+	assert.Equal(t, int64(len(cut)), warnings[1].Length)
+	offset += int64(len(cut))
+	assert.Equal(t, offset, warnings[2].Offset)
+	assert.Equal(t, int64(len(unterminated)), warnings[2].Length)
+	assert.True(t, errors.Is(warnings[2], griblib.ErrMissingEndSection))
+
+	// without the option, the scanner stops at the unterminated message
+	scanner = griblib.NewScanner(bytes.NewReader(append(append([]byte{}, chunks[0]...), unterminated...)))
+	assert.True(t, scanner.Next())
+	assert.False(t, scanner.Next())
+	assert.EqualError(t, scanner.Err(), fmt.Sprintf("Message at offset %d: Missing end section 7777", len(chunks[0])))
+	assert.True(t, errors.Is(scanner.Err(), griblib.ErrMissingEndSection))
+}
+
+func Test_tolerant_scanner_skips_corrupt_message_length(t *testing.T) {
+	raw, err := os.ReadFile("../integrationtestdata/template5_0.grib2")
+	require.NoError(t, err)
+	chunks := splitMessages(t, raw)
+
+	// the length of the first message is flipped to a huge value claiming the rest of the file and more
+	corrupt := append([]byte{}, raw...)
+	binary.BigEndian.PutUint64(corrupt[8:], 1<<62)
+
+	options := griblib.DefaultReadOptions()
+	options.Tolerant = true
+	scanner := griblib.NewScannerWithOptions(bytes.NewReader(corrupt), options)
+	count := 0
+	for scanner.Next() {
+		count++
+	}
+	require.NoError(t, scanner.Err())
+	assert.Equal(t, len(chunks)-1, count)
+
+	warnings := scanner.Warnings()
+	require.Len(t, warnings, 1)
+	assert.Equal(t, int64(0), warnings[0].Offset)
+	assert.Equal(t, int64(len(chunks[0])), warnings[0].Length)
+	var truncated *griblib.TruncatedMessageError
+	require.True(t, errors.As(warnings[0], &truncated), warnings[0])
+	assert.Equal(t, int64(1<<62), truncated.Length)
+}
+
+func Test_tolerant_scanner_skips_corrupt_section_length(t *testing.T) {
+	raw, err := os.ReadFile("../integrationtestdata/template5_0.grib2")
+	require.NoError(t, err)
+	chunks := splitMessages(t, raw)
+
+	// the first octet of the length of section 6 is flipped, the section claims about 2 GB
+	corrupt := append([]byte{}, raw...)
+	corrupt[sections(corrupt)[6]] ^= 0x77
+
+	// the section is rejected before it is allocated
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err = griblib.ReadMessages(bytes.NewReader(corrupt))
+	runtime.ReadMemStats(&after)
+	assert.True(t, errors.Is(err, griblib.ErrTruncatedMessage), err)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(len(raw)*10))
+
+	options := griblib.DefaultReadOptions()
+	options.Tolerant = true
+	scanner := griblib.NewScannerWithOptions(bytes.NewReader(corrupt), options)
+	count := 0
+	for scanner.Next() {
+		count++
+	}
+	require.NoError(t, scanner.Err())
+	assert.Equal(t, len(chunks)-1, count)
+
+	warnings := scanner.Warnings()
+	require.Len(t, warnings, 1)
+	assert.Equal(t, griblib.Warning{Offset: 0, Length: int64(len(chunks[0])), Err: warnings[0].Err}, warnings[0])
+	assert.True(t, errors.Is(warnings[0], griblib.ErrTruncatedMessage), warnings[0])
+}
@@ -0,0 +1,136 @@
+package gribtest
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/nilsmagnus/grib/griblib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_write_message_round_trip(t *testing.T) {
+	for _, file := range []string{"template5_0.grib2", "template5_2.grib2", "template5_3.grib2", "template5_40.grib2"} {
+		messages := openGrib(t, "../integrationtestdata/"+file)
+
+		var written bytes.Buffer
+		for _, message := range messages {
+			require.NoError(t, griblib.WriteMessage(&written, message), file)
+		}
+		read, err := griblib.ReadMessages(bytes.NewReader(written.Bytes()))
+		require.NoError(t, err, file)
+		require.Len(t, read, len(messages), file)
+
+		for i, message := range messages {
+			assert.Equal(t, message.Section0.Discipline, read[i].Section0.Discipline)
+			assert.Equal(t, message.Section1, read[i].Section1)
+			assert.Equal(t, message.Section3, read[i].Section3)
+			assert.Equal(t, message.Section4.Product, read[i].Section4.Product)
+			// complex packing is kept, other templates are written with simple packing
+			assert.Equal(t, uint16(griblib.DefaultWriteOptions(message).DataTemplate), read[i].Section5.DataTemplateNumber)
+
+			// the values keep the precision of the original template
+			options := griblib.DefaultWriteOptions(message)
+			precision := 0.5 * math.Ldexp(math.Pow10(-options.DecimalScale), options.BinaryScale)
+			assert.InDeltaSlice(t, message.Data(), read[i].Data(), precision*1.001, file)
+		}
+	}
+}
+
+func Test_write_message_with_bitmap(t *testing.T) {
+	raw, err := os.ReadFile("../integrationtestdata/gfs.t00z.pgrb2.2p50.f000")
+	require.NoError(t, err)
+	var message *griblib.Message
+	for _, chunk := range splitMessages(t, raw) {
+		if _, ok := bitmapSection(chunk); ok {
+			messages, err := griblib.ReadMessages(bytes.NewReader(chunk))
+			require.NoError(t, err)
+			message = messages[0]
+			break
+		}
+	}
+	require.NotNil(t, message, "testfile should contain a message with a bitmap")
+
+	var written bytes.Buffer
+	require.NoError(t, griblib.WriteMessage(&written, message))
+	read, err := griblib.ReadMessages(bytes.NewReader(written.Bytes()))
+	require.NoError(t, err)
+
+	require.Len(t, read[0].Data(), len(message.Data()))
+	assert.Equal(t, uint8(griblib.BitmapApplies), read[0].Section6.BitmapIndicator)
+	for i, value := range message.Data() {
+		if math.IsNaN(value) {
+			assert.True(t, math.IsNaN(read[0].Data()[i]), "point %d should be missing", i)
+		} else {
+			assert.InDelta(t, value, read[0].Data()[i], 0.5)
+		}
+	}
+}
+
+func Test_write_message_bits(t *testing.T) {
+	message := openGrib(t, "../integrationtestdata/template5_0.grib2")[0]
+	minValue, maxValue := message.Data()[0], message.Data()[0]
+	for _, value := range message.Data() {
+		minValue, maxValue = math.Min(minValue, value), math.Max(maxValue, value)
+	}
+
+	for _, bits := range []int{1, 4, 8, 12, 24} {
+		var written bytes.Buffer
+		require.NoError(t, griblib.WriteMessageWithOptions(&written, message, griblib.WriteOptions{Bits: bits}))
+		read, err := griblib.ReadMessages(bytes.NewReader(written.Bytes()))
+		require.NoError(t, err)
+
+		template, err := read[0].Section5.GetDataTemplate()
+		require.NoError(t, err)
+		assert.Equal(t, uint8(bits), template.(griblib.Data0).Bits)
+		// the values are rounded to decimals, which can be up to 10 times the smallest step
+		step := (maxValue - minValue) / (math.Ldexp(1, bits) - 1)
+		assert.InDeltaSlice(t, message.Data(), read[0].Data(), 5*step, "%d bits", bits)
+	}
+}
+
+func Test_write_message_constant_field(t *testing.T) {
+	message := openGrib(t, "../integrationtestdata/template5_0.grib2")[0]
+	for i := range message.Section7.Data {
+		message.Section7.Data[i] = 273.15
+	}
+
+	var written bytes.Buffer
+	require.NoError(t, griblib.WriteMessageWithOptions(&written, message, griblib.WriteOptions{DecimalScale: 2}))
+	read, err := griblib.ReadMessages(bytes.NewReader(written.Bytes()))
+	require.NoError(t, err)
+
+	template, err := read[0].Section5.GetDataTemplate()
+	require.NoError(t, err)
+	assert.Equal(t, uint8(0), template.(griblib.Data0).Bits)
+	assert.InDeltaSlice(t, message.Data(), read[0].Data(), 1e-9)
+}
+
+func Test_write_filtered_message(t *testing.T) {
+	message := openGrib(t, "../integrationtestdata/template5_0.grib2")[0]
+	filter := griblib.GeoFilter{MinLong: 10_000_000, MinLat: 70_000_000, MaxLat: 60_000_000, MaxLong: 20_000_000}
+	require.True(t, griblib.FilterMessage(message, griblib.Options{Discipline: -1, Category: -1, GeoFilter: filter}))
+
+	var written bytes.Buffer
+	require.NoError(t, griblib.WriteMessage(&written, message))
+	read, err := griblib.ReadMessages(bytes.NewReader(written.Bytes()))
+	require.NoError(t, err)
+
+	assert.Equal(t, message.Section3, read[0].Section3)
+	assert.Len(t, read[0].Data(), len(message.Data()))
+}
+
+func Test_write_message_errors(t *testing.T) {
+	message := openGrib(t, "../integrationtestdata/template5_0.grib2")[0]
+
+	message.Section7.Data = message.Section7.Data[1:]
+	assert.Error(t, griblib.WriteMessage(&bytes.Buffer{}, message), "data does not match the grid")
+
+	message.Section7.Data = append(message.Section7.Data, math.Inf(1))
+	assert.Error(t, griblib.WriteMessage(&bytes.Buffer{}, message), "infinite values can not be packed")
+
+	message.Section7.Data[0] = 1
+	assert.Error(t, griblib.WriteMessageWithOptions(&bytes.Buffer{}, message, griblib.WriteOptions{DecimalScale: math.MinInt16}))
+}
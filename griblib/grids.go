@@ -2,14 +2,21 @@ package griblib
 
 import (
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"io"
+
+	"github.com/nilsmagnus/grib/internal/reader"
 )
 
+//fixNegLatLon converts num, read as a two's complement integer, from sign-magnitude
 func fixNegLatLon(num int32) int32 {
+	return int32(reader.SignMagnitude(uint64(uint32(num)), 32))
+}
+
+// signMagnitudeLatLon is the inverse of fixNegLatLon
+func signMagnitudeLatLon(num int32) int32 {
 	if num < 0 {
-		return -int32(uint32(num) &^ uint32(0x80000000))
+		return int32(uint32(-num) | 0x80000000)
 	}
 	return num
 }
@@ -77,11 +84,51 @@ func ReadGrid(f io.Reader, templateNumber uint16) (Grid, error) {
 		return &grid, binary.Read(f, binary.BigEndian, &grid)
 	default:
 		var grid Grid90
-		return &grid, errors.New(fmt.Sprint("Unsupported grid definition ", templateNumber))
+		return &grid, ErrUnsupportedTemplate{Section: 3, Number: int(templateNumber)}
 	}
 	return g, err
 }
 
+//WriteGrid writes grid in binary form, it is the inverse of ReadGrid
+func WriteGrid(w io.Writer, grid Grid) error {
+	switch g := grid.(type) {
+	case *Grid0:
+		written := *g
+		written.La1 = signMagnitudeLatLon(g.La1)
+		written.Lo1 = signMagnitudeLatLon(g.Lo1)
+		written.La2 = signMagnitudeLatLon(g.La2)
+		written.Lo2 = signMagnitudeLatLon(g.Lo2)
+		return binary.Write(w, binary.BigEndian, &written)
+	case *Grid10:
+		written := *g
+		written.La1 = signMagnitudeLatLon(g.La1)
+		written.Lo1 = signMagnitudeLatLon(g.Lo1)
+		written.La2 = signMagnitudeLatLon(g.La2)
+		written.Lo2 = signMagnitudeLatLon(g.Lo2)
+		return binary.Write(w, binary.BigEndian, &written)
+	case *Grid20:
+		written := *g
+		written.La1 = signMagnitudeLatLon(g.La1)
+		written.Lo1 = signMagnitudeLatLon(g.Lo1)
+		return binary.Write(w, binary.BigEndian, &written)
+	case *Grid30:
+		written := *g
+		written.La1 = signMagnitudeLatLon(g.La1)
+		written.Lo1 = signMagnitudeLatLon(g.Lo1)
+		return binary.Write(w, binary.BigEndian, &written)
+	case *Grid40:
+		written := *g
+		written.La1 = signMagnitudeLatLon(g.La1)
+		written.Lo1 = signMagnitudeLatLon(g.Lo1)
+		written.La2 = signMagnitudeLatLon(g.La2)
+		written.Lo2 = signMagnitudeLatLon(g.Lo2)
+		return binary.Write(w, binary.BigEndian, &written)
+	case *Grid90:
+		return binary.Write(w, binary.BigEndian, g)
+	}
+	return fmt.Errorf("Unsupported grid definition %T", grid)
+}
+
 //GridHeader is a common header in all grids
 type GridHeader struct {
 	EarthShape      uint8       `json:"earthShape"`
@@ -192,17 +239,17 @@ type Grid30 struct {
 type Grid40 struct {
 	//name =  "Gaussian latitude/longitude ";
 	GridHeader
-	Ni                          uint32 `json:"ni"`
-	Nj                          uint32 `json:"nj"`
-	BasicAngle                  uint32 `json:"basicAngle"`
-	La1                         int32  `json:"la1"`
-	Lo1                         int32  `json:"lo1"`
-	ResolutionAndComponentFlags uint8  `json:"resolutionAndComponentFlags"`
-	La2                         int32  `json:"la2"`
-	Lo2                         int32  `json:"lo2"`
-	Di                          int32  `json:"di"`
-	N                           uint32 `json:"n"`
-	ScanningMode                uint8  `json:"scanningMode"`
+	Ni                          uint32     `json:"ni"`
+	Nj                          uint32     `json:"nj"`
+	BasicAngle                  BasicAngle `json:"basicAngle"`
+	La1                         int32      `json:"la1"`
+	Lo1                         int32      `json:"lo1"`
+	ResolutionAndComponentFlags uint8      `json:"resolutionAndComponentFlags"`
+	La2                         int32      `json:"la2"`
+	Lo2                         int32      `json:"lo2"`
+	Di                          int32      `json:"di"`
+	N                           uint32     `json:"n"` // number of parallels between a pole and the equator
+	ScanningMode                uint8      `json:"scanningMode"`
 }
 
 // Grid90 Definition Template 3.90: Space view perspective or orthographic
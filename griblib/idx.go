@@ -0,0 +1,290 @@
+package griblib
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// WriteIdx writes index as a NOAA .idx file, one line per message:
+//
+//	1:0:d=2024010100:TMP:2 m above ground:anl:
+//
+// The fields are the message number, its offset, the reference time and the Variable, Level, Forecast
+// and Extras of the entry.
+func WriteIdx(w io.Writer, index Index) error {
+	for _, entry := range index {
+		if _, err := io.WriteString(w, entry.idxLine()+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (entry IndexEntry) idxLine() string {
+	time := entry.ReferenceTime
+	return fmt.Sprintf("%d:%d:d=%04d%02d%02d%02d:%s:%s:%s:%s", entry.Number, entry.Offset,
+		time.Year, time.Month, time.Day, time.Hour, entry.Variable, entry.Level, entry.Forecast, entry.Extras)
+}
+
+// ReadIdx reads a NOAA .idx file, as written by WriteIdx or published next to GRIB files by NOMADS.
+// Only the number, offset, length, reference time and the texts of the entries are known. The length
+// of a message is the distance to the next message, the length of the last message is 0 as it is not known.
+func ReadIdx(r io.Reader) (Index, error) {
+	index := Index{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		entry, err := parseIdxLine(text)
+		if err != nil {
+			return index, fmt.Errorf("Line %d of the idx file: %w", line, err)
+		}
+		index = append(index, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return index, err
+	}
+
+	// fields of the same message, numbered 1.1, 1.2, ..., share the offset
+	next := int64(-1)
+	for i := len(index) - 1; i >= 0; i-- {
+		if next >= 0 && next != index[i].Offset {
+			index[i].Length = next - index[i].Offset
+		} else if i+1 < len(index) {
+			index[i].Length = index[i+1].Length
+		}
+		next = index[i].Offset
+	}
+	return index, nil
+}
+
+func parseIdxLine(text string) (IndexEntry, error) {
+	entry := IndexEntry{}
+	fields := strings.SplitN(text, ":", 7)
+	if len(fields) < 6 {
+		return entry, fmt.Errorf("Expected at least 6 fields in %q", text)
+	}
+
+	number := strings.SplitN(fields[0], ".", 2)[0]
+	var err error
+	if entry.Number, err = strconv.Atoi(number); err != nil {
+		return entry, fmt.Errorf("Invalid message number %q", fields[0])
+	}
+	if entry.Offset, err = strconv.ParseInt(fields[1], 10, 64); err != nil || entry.Offset < 0 {
+		return entry, fmt.Errorf("Invalid offset %q", fields[1])
+	}
+
+	date := strings.TrimPrefix(fields[2], "d=")
+	if date == fields[2] || (len(date) != 10 && len(date) != 12) {
+		return entry, fmt.Errorf("Invalid reference time %q", fields[2])
+	}
+	digits := []int{}
+	for i := 4; i <= len(date); i += 2 {
+		value, err := strconv.Atoi(date[i-2 : i])
+		if i == 4 {
+			value, err = strconv.Atoi(date[:4])
+		}
+		if err != nil {
+			return entry, fmt.Errorf("Invalid reference time %q", fields[2])
+		}
+		digits = append(digits, value)
+	}
+	entry.ReferenceTime = Time{Year: uint16(digits[0]), Month: uint8(digits[1]), Day: uint8(digits[2]), Hour: uint8(digits[3])}
+	if len(digits) > 4 {
+		entry.ReferenceTime.Minute = uint8(digits[4])
+	}
+
+	entry.Variable, entry.Level, entry.Forecast = fields[3], fields[4], fields[5]
+	if len(fields) > 6 {
+		entry.Extras = fields[6]
+	}
+	return entry, nil
+}
+
+// describe sets the texts of entry from its fields, the way wgrib2 writes them
+func (entry *IndexEntry) describe() {
+	entry.Variable = ReadParameterAbbreviation(entry.Discipline, entry.Category, entry.ParameterNumber)
+	entry.Level = levelText(entry.FirstSurface, entry.SecondSurface)
+	entry.Forecast = forecastText(entry)
+	entry.Extras = ""
+
+	switch product := entry.Product.(type) {
+	case Product1:
+		entry.Extras = ensembleText(product)
+	case Product11:
+		entry.Extras = ensembleText(product.Product1)
+	case Product2:
+		entry.Extras = derivedText(product)
+	case Product12:
+		entry.Extras = derivedText(product.Product2)
+	}
+}
+
+// surfaceValue returns the value of surface in the unit of the level text, false if it has none
+func surfaceValue(surface Surface) (string, bool) {
+	switch surface.Type {
+	case 20, 100, 102, 103, 104, 105, 106, 107, 108, 109, 160:
+	default:
+		return "", false
+	}
+	if surface.Scale == 255 && surface.Value == math.MaxUint32 {
+		return "", false
+	}
+	value := float64(surface.Value) * math.Pow10(-int(surface.Scale))
+	if surface.Type == 100 || surface.Type == 108 {
+		// Pa to mb
+		value /= 100
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64), true
+}
+
+func levelText(first, second Surface) string {
+	name := ReadSurfaceLevelName(int(first.Type))
+	value, ok := surfaceValue(first)
+	if !ok {
+		if second.Type != 255 && second.Type != 0 && second.Type != first.Type {
+			return name + " - " + levelText(second, Surface{Type: 255})
+		}
+		return name
+	}
+	if first.Type == 109 {
+		return "PV=" + value + " " + name
+	}
+	if secondValue, ok := surfaceValue(second); ok && second.Type == first.Type {
+		return value + "-" + secondValue + " " + strings.Replace(name, "level", "layer", 1)
+	}
+	return value + " " + name
+}
+
+// timeUnit returns the name of a time unit (code table 4.4), with the number of those in the unit
+func timeUnit(unit uint8) (string, uint32) {
+	switch unit {
+	case 0:
+		return "min", 1
+	case 1:
+		return "hour", 1
+	case 2:
+		return "day", 1
+	case 3:
+		return "month", 1
+	case 4:
+		return "year", 1
+	case 10:
+		return "hour", 3
+	case 11:
+		return "hour", 6
+	case 12:
+		return "hour", 12
+	case 13:
+		return "sec", 1
+	default:
+		return strings.ToLower(ReadTimeRangeUnitIndicator(int(unit))), 1
+	}
+}
+
+func forecastText(entry *IndexEntry) string {
+	var timeRange *TimeRangeSpecification
+	switch product := entry.Product.(type) {
+	case Product8:
+		timeRange = &product.TimeRangeSpecification1
+	case Product11:
+		timeRange = &product.TimeRangeSpecification1
+	case Product12:
+		timeRange = &product.TimeRangeSpecification1
+	}
+
+	unit, count := timeUnit(entry.TimeUnitIndicator)
+	start := entry.ForecastTime * count
+	if timeRange == nil {
+		if start == 0 {
+			return "anl"
+		}
+		return fmt.Sprintf("%d %s fcst", start, unit)
+	}
+
+	rangeUnit, rangeCount := timeUnit(timeRange.IncrementBetweenSuccessiveFieldsRangeTimeUnitIndicator)
+	length := timeRange.StatististicalProcessTimeLength * rangeCount
+	process := ""
+	switch timeRange.StatisticalFieldCalculationProcess {
+	case 0:
+		process = "ave"
+	case 1:
+		process = "acc"
+	case 2:
+		process = "max"
+	case 3:
+		process = "min"
+	default:
+		process = strings.ToLower(ReadStatisticalProcessingType(int(timeRange.StatisticalFieldCalculationProcess)))
+	}
+	first, second, unit, ok := commonUnit(uint64(start), unit, uint64(length), rangeUnit)
+	if !ok {
+		// the end can not be given in a single unit, the start and the length of the range are given instead
+		return fmt.Sprintf("%d %s+%d %s %s fcst", start, unit, length, rangeUnit, process)
+	}
+	return fmt.Sprintf("%d-%d %s %s fcst", first, first+second, unit, process)
+}
+
+// unitLengths are the lengths of the time units of timeUnit, in seconds or in months
+var unitLengths = map[string]struct {
+	length uint64
+	months bool
+}{
+	"sec":   {1, false},
+	"min":   {60, false},
+	"hour":  {3600, false},
+	"day":   {86400, false},
+	"month": {1, true},
+	"year":  {12, true},
+}
+
+// commonUnit expresses the times first, in firstUnit, and second, in secondUnit, in the largest unit they both fit in
+func commonUnit(first uint64, firstUnit string, second uint64, secondUnit string) (uint64, uint64, string, bool) {
+	if firstUnit == secondUnit {
+		return first, second, firstUnit, true
+	}
+	if first == 0 {
+		return first, second, secondUnit, true
+	}
+	firstLength, firstOk := unitLengths[firstUnit]
+	secondLength, secondOk := unitLengths[secondUnit]
+	if !firstOk || !secondOk || firstLength.months != secondLength.months {
+		return first, second, firstUnit, false
+	}
+	first *= firstLength.length
+	second *= secondLength.length
+	for _, unit := range []string{"year", "month", "day", "hour", "min", "sec"} {
+		length := unitLengths[unit]
+		if length.months == firstLength.months && first%length.length == 0 && second%length.length == 0 {
+			return first / length.length, second / length.length, unit, true
+		}
+	}
+	return first, second, firstUnit, false
+}
+
+func ensembleText(product Product1) string {
+	switch product.EnsembleForecastType {
+	case 0:
+		return "ENS=hi-res ctl"
+	case 1:
+		return "ENS=low-res ctl"
+	case 2:
+		return fmt.Sprintf("ENS=-%d", product.PertubationNumber)
+	case 3:
+		return fmt.Sprintf("ENS=+%d", product.PertubationNumber)
+	}
+	return ""
+}
+
+func derivedText(product Product2) string {
+	if product.DerivedForecast == 0 {
+		return "ens mean"
+	}
+	return ""
+}
@@ -0,0 +1,186 @@
+package griblib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// IndexEntry locates a message in a grib file and tells which field it holds, see BuildIndex
+type IndexEntry struct {
+	Number            int     `json:"number"`            // number of the message in the file, starting at 1
+	Offset            int64   `json:"offset"`            // offset of the message in the file, in octets
+	Length            int64   `json:"length"`            // length of the message, in octets
+	Discipline        uint8   `json:"discipline"`        // Table 0.0
+	Category          uint8   `json:"category"`          // Table 4.1
+	ParameterNumber   uint8   `json:"parameterNumber"`   // Table 4.2
+	FirstSurface      Surface `json:"firstSurface"`      // the level
+	SecondSurface     Surface `json:"secondSurface"`     // the other end of a layer
+	ReferenceTime     Time    `json:"referenceTime"`     // from section 1
+	TimeUnitIndicator uint8   `json:"timeUnitIndicator"` // Table 4.4, unit of ForecastTime
+	ForecastTime      uint32  `json:"forecastTime"`
+	ProductTemplate   uint16  `json:"productTemplate"` // product definition template number
+	Product           Product `json:"product"`         // nil if the template is not supported
+
+	// the description of the field in NOAA .idx files, e.g. TMP, 2 m above ground and anl, see ReadIdx
+	Variable string `json:"variable"`
+	Level    string `json:"level"`
+	Forecast string `json:"forecast"`
+	Extras   string `json:"extras"` // e.g. ENS=+1 for ensemble members
+}
+
+// Index is the inventory of a grib file, in the order of the messages
+type Index []IndexEntry
+
+// Select returns the entries for which keep returns true
+func (index Index) Select(keep func(entry IndexEntry) bool) Index {
+	selected := Index{}
+	for _, entry := range index {
+		if keep(entry) {
+			selected = append(selected, entry)
+		}
+	}
+	return selected
+}
+
+// ByteRange is a part of a file, a Length of 0 runs to the end of the file
+type ByteRange struct {
+	Offset int64
+	Length int64
+}
+
+// ByteRanges returns the parts of the file holding the messages of index, in the order of the entries.
+// Consecutive messages are merged into one range, the fields of a message sharing its offset are read once.
+func (index Index) ByteRanges() []ByteRange {
+	ranges := []ByteRange{}
+	for i, entry := range index {
+		if i > 0 && entry.Offset == index[i-1].Offset {
+			continue
+		}
+		if len(ranges) > 0 {
+			last := &ranges[len(ranges)-1]
+			if last.Length != 0 && entry.Offset == last.Offset+last.Length {
+				last.Length += entry.Length
+				if entry.Length == 0 {
+					last.Length = 0
+				}
+				continue
+			}
+		}
+		ranges = append(ranges, ByteRange{Offset: entry.Offset, Length: entry.Length})
+	}
+	return ranges
+}
+
+// BuildIndex reads the inventory of gribFile. Only section 0 and the section headers are read, with
+// the content of sections 1 and 4; the other sections are skipped, with Seek if gribFile is an io.Seeker.
+func BuildIndex(gribFile io.Reader) (Index, error) {
+	index := Index{}
+	offset := int64(0)
+	for {
+		section0, err := ReadSection0(gribFile)
+		if err == io.EOF {
+			return index, nil
+		}
+		if err != nil {
+			return index, fmt.Errorf("Message %d at offset %d: %w", len(index)+1, offset, err)
+		}
+
+		entry := IndexEntry{
+			Number:     len(index) + 1,
+			Offset:     offset,
+			Length:     int64(section0.MessageLength),
+			Discipline: section0.Discipline,
+		}
+		if err := readIndexSections(gribFile, &entry); err != nil {
+			return index, fmt.Errorf("Message %d at offset %d: %w", entry.Number, offset, err)
+		}
+		index = append(index, entry)
+		offset += entry.Length
+	}
+}
+
+// readIndexSections reads the sections of a message after section 0 into entry, up to the end of the message
+func readIndexSections(gribFile io.Reader, entry *IndexEntry) error {
+	position := int64(16)
+	for position < entry.Length {
+		head, err := ReadSectionHead(gribFile)
+		if err != nil {
+			return err
+		}
+		if head.Number == 8 {
+			position += 4
+			break
+		}
+		if head.ByteLength < 5 {
+			return fmt.Errorf("Section %d has an invalid length %d", head.Number, head.ByteLength)
+		}
+		position += int64(head.ByteLength)
+		if position > entry.Length {
+			return fmt.Errorf("Section %d ends after the end of the message", head.Number)
+		}
+
+		switch head.Number {
+		case 1, 4:
+			content := make([]byte, head.ContentLength())
+			if _, err := io.ReadFull(gribFile, content); err != nil {
+				return err
+			}
+			if head.Number == 1 {
+				section1, err := ReadSection1(bytes.NewReader(content), len(content))
+				if err != nil {
+					return err
+				}
+				entry.ReferenceTime = section1.ReferenceTime
+				continue
+			}
+			section4, err := ReadSection4(bytes.NewReader(content), len(content))
+			if err != nil {
+				return err
+			}
+			product := section4.ProductDefinitionTemplate
+			entry.Category = product.ParameterCategory
+			entry.ParameterNumber = product.ParameterNumber
+			entry.FirstSurface = product.FirstSurface
+			entry.SecondSurface = product.SecondSurface
+			entry.TimeUnitIndicator = product.TimeUnitIndicator
+			entry.ForecastTime = product.ForecastTime
+			entry.ProductTemplate = section4.ProductDefinitionTemplateNumber
+			entry.Product = section4.Product
+		default:
+			if err := skip(gribFile, int64(head.ContentLength())); err != nil {
+				return err
+			}
+		}
+	}
+	if position != entry.Length {
+		return fmt.Errorf("Sections end at octet %d of a message of %d octets", position, entry.Length)
+	}
+	entry.describe()
+	return nil
+}
+
+// skip advances reader by n octets
+func skip(reader io.Reader, n int64) error {
+	if seeker, ok := reader.(io.Seeker); ok {
+		_, err := seeker.Seek(n, io.SeekCurrent)
+		return err
+	}
+	skipped, err := io.CopyN(io.Discard, reader, n)
+	if err == io.EOF && skipped < n {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// ReadMessageAt reads the message of entry from gribFile, without reading the other messages
+//
+// Like ReadMessage, a message refering to a previously defined bitmap can not be decoded by ReadMessageAt.
+func ReadMessageAt(gribFile io.ReaderAt, entry IndexEntry) (*Message, error) {
+	return ReadMessageAtWithOptions(gribFile, entry, DefaultReadOptions())
+}
+
+// ReadMessageAtWithOptions reads the message of entry from gribFile, decoding it as specified by options
+func ReadMessageAtWithOptions(gribFile io.ReaderAt, entry IndexEntry, options ReadOptions) (*Message, error) {
+	return newMessageReader(options).readMessage(io.NewSectionReader(gribFile, entry.Offset, entry.Length))
+}
@@ -0,0 +1,25 @@
+package griblib
+
+import (
+	"context"
+	"log/slog"
+)
+
+// discardLogger is used when no logger is given, the library is silent by default
+var discardLogger = slog.New(discardHandler{})
+
+// loggerOrDiscard returns logger, or a logger discarding everything if it is nil
+func loggerOrDiscard(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return discardLogger
+	}
+	return logger
+}
+
+// discardHandler is a slog.Handler dropping all records
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
@@ -0,0 +1,103 @@
+package griblib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// ReadMessagesParallel reads all messages of gribFile like ReadMessagesWithOptions, decoding section 7 of the
+// messages on workers goroutines, or on runtime.GOMAXPROCS(0) goroutines if workers is less than 1. The file
+// is read sequentially, message by message, and the messages are returned in the order of the file.
+//
+// If a message can not be decoded, the messages before it are returned with the error. Reading stops when ctx
+// is done, ctx.Err() is then returned.
+func ReadMessagesParallel(ctx context.Context, gribFile io.Reader, options ReadOptions, workers int) ([]*Message, error) {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	// the headers are read in order, for the bitmaps carried over from one message to the next
+	headerOptions := options
+	headerOptions.HeadersOnly = true
+	reader := newMessageReader(headerOptions)
+
+	// a message that can not be decoded stops the reading, not the decoding of the messages before it
+	dispatch, stop := context.WithCancel(ctx)
+	defer stop()
+
+	type job struct {
+		index   int
+		message *Message
+	}
+	jobs := make(chan job)
+	failed := map[int]error{}
+	var mutex sync.Mutex
+	var workersDone sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		workersDone.Add(1)
+		go func() {
+			defer workersDone.Done()
+			for job := range jobs {
+				if ctx.Err() != nil || options.HeadersOnly {
+					continue
+				}
+				if err := job.message.Decode(); err != nil {
+					mutex.Lock()
+					failed[job.index] = err
+					mutex.Unlock()
+					if !options.Tolerant {
+						stop()
+					}
+				}
+			}
+		}()
+	}
+
+	messages := []*Message{}
+	offsets := []int64{}
+	var readErr error
+	for dispatch.Err() == nil {
+		message, err := reader.readMessage(gribFile)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+		if message.pending != nil && !options.HeadersOnly {
+			// the messages failing on the workers are reported below, in the order of the file
+			message.pending.warn = nil
+		}
+		offsets = append(offsets, reader.offset-int64(message.Section0.MessageLength))
+		messages = append(messages, message)
+		select {
+		case jobs <- job{index: len(messages) - 1, message: message}:
+		case <-dispatch.Done():
+		}
+	}
+	close(jobs)
+	workersDone.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	decoded := make([]*Message, 0, len(messages))
+	for index, message := range messages {
+		err, ok := failed[index]
+		if ok && options.Tolerant {
+			reader.warn(offsets[index], int64(message.Section0.MessageLength), err)
+			continue
+		}
+		if ok {
+			return decoded, fmt.Errorf("Message at offset %d: %w", offsets[index], err)
+		}
+		decoded = append(decoded, message)
+	}
+	if readErr != nil {
+		loggerOrDiscard(options.Logger).Error("Error when parsing a message", "error", readErr)
+	}
+	return decoded, readErr
+}
@@ -2,7 +2,6 @@ package griblib
 
 import (
 	"image"
-	"log"
 
 	"fmt"
 	"image/color"
@@ -14,12 +13,16 @@ import (
 
 func ExportMessagesAsPngs(messages []*Message) {
 	for i, message := range messages {
-		dataImage, err := imageFromMessage(message)
-		if err != nil {
-			log.Printf("Message could not be converted to image: %v\n", err)
-		} else {
-			writeImageToFilename(dataImage, imageFileName(i, message))
-		}
+		exportMessageAsPng(i, message)
+	}
+}
+
+func exportMessageAsPng(messageNumber int, message *Message) {
+	dataImage, err := imageFromMessage(message)
+	if err != nil {
+		loggerOrDiscard(message.logger).Error("Message could not be converted to image", "error", err)
+	} else {
+		writeImageToFilename(dataImage, imageFileName(messageNumber, message))
 	}
 }
 
@@ -59,25 +62,32 @@ func writeImageToFilename(img image.Image, name string) error {
 
 func imageFromMessage(message *Message) (image.Image, error) {
 
-	grid0, ok := message.Section3.Definition.(*Grid0)
-
-	if !ok {
+	// the data is decoded first, a quasi-regular grid may be regularized by it
+	if err := message.Decode(); err != nil {
+		return nil, err
+	}
+	data := message.Section7.Data
+
+	var width, height int
+	switch grid := message.Section3.Definition.(type) {
+	case *Grid0:
+		width, height = int(grid.Ni), int(grid.Nj)
+	case *Grid40:
+		width, height = int(grid.Ni), int(grid.Nj)
+	default:
 		err := fmt.Errorf("Currently not supporting definition of type %s ", reflect.TypeOf(message.Section3.Definition))
 		return nil, err
 	}
 
-	height := int(grid0.Nj)
-	width := int(grid0.Ni)
-
-	maxValue, minValue := MaxMin(message.Section7.Data)
+	maxValue, minValue := MaxMin(data)
 
 	rgbaImage := image.NewNRGBA(image.Rect(0, 0, width, height))
-	length := len(message.Section7.Data)
+	length := len(data)
 	if length == width*height {
 		//		log.Printf("d=%d , w=%d, h=%d, wxh=%d\n", length, width, height, width*height)
 		for y := 0; y < height; y++ {
 			for x := 0; x < width; x++ {
-				value := message.Section7.Data[y*width+x]
+				value := data[y*width+x]
 				red := uint8(0)
 				blue := uint8(254)
 				rgbaImage.Set(x, y, color.NRGBA{
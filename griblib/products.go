@@ -1,5 +1,16 @@
 package griblib
 
+import (
+	"fmt"
+	"io"
+)
+
+// Product is a product definition template of section 4. All supported templates start with the
+// fields of template 4.0, which Header returns.
+type Product interface {
+	Header() Product0
+}
+
 // Product0 http://www.nco.ncep.noaa.gov/pmb/docs/grib2/grib2_doc/grib2_table4-0.shtml
 // Analysis or forecast at a horizontal level or in a horizontal layer at a point in time
 type Product0 struct {
@@ -17,6 +28,11 @@ type Product0 struct {
 	SecondSurface     Surface `json:"secondSurface"`
 }
 
+// Header returns the product itself, the other templates inherit it from their embedded Product0
+func (product Product0) Header() Product0 {
+	return product
+}
+
 //Product1 http://www.nco.ncep.noaa.gov/pmb/docs/grib2/grib2_temp4-1.shtml
 type Product1 struct {
 	Product0
@@ -66,6 +82,28 @@ type Product8 struct {
 	AdditionalTimeRangeSpecifications []TimeRangeSpecification `json:"additionalTimeRangeSpecifications"` // 71-n
 }
 
+//Product11 http://www.nco.ncep.noaa.gov/pmb/docs/grib2/grib2_temp4-11.shtml
+type Product11 struct {
+	Product1
+	Time                              Time                     `json:"time"`                              // 38-44
+	NumberOfIntervalTimeRanges        uint8                    `json:"numberOfIntervalTimeRanges"`        // 45
+	TotalMissingDataValuesCount       uint32                   `json:"totalMissingDataValuesCount"`       // 46-49
+	TimeRangeSpecification1           TimeRangeSpecification   `json:"timeRangeSpecification1"`           // 50-61
+	TimeRangeSpecification2           TimeRangeSpecification   `json:"timeRangeSpecification2"`           // 62-73
+	AdditionalTimeRangeSpecifications []TimeRangeSpecification `json:"additionalTimeRangeSpecifications"` // 74-n
+}
+
+//Product12 http://www.nco.ncep.noaa.gov/pmb/docs/grib2/grib2_temp4-12.shtml
+type Product12 struct {
+	Product2
+	Time                              Time                     `json:"time"`                              // 37-43
+	NumberOfIntervalTimeRanges        uint8                    `json:"numberOfIntervalTimeRanges"`        // 44
+	TotalMissingDataValuesCount       uint32                   `json:"totalMissingDataValuesCount"`       // 45-48
+	TimeRangeSpecification1           TimeRangeSpecification   `json:"timeRangeSpecification1"`           // 49-60
+	TimeRangeSpecification2           TimeRangeSpecification   `json:"timeRangeSpecification2"`           // 61-72
+	AdditionalTimeRangeSpecifications []TimeRangeSpecification `json:"additionalTimeRangeSpecifications"` // 73-n
+}
+
 //TimeRangeSpecification describes timerange for products
 type TimeRangeSpecification struct {
 	StatisticalFieldCalculationProcess                     uint8  `json:"statisticalFieldCalculationProcess"`                     // 47
@@ -82,3 +120,138 @@ type Surface struct {
 	Scale uint8  `json:"scale"`
 	Value uint32 `json:"value"` // e.g. meters above sea-level
 }
+
+//ReadProduct reads the product definition template with the given number (Code table 4.0)
+func ReadProduct(f io.Reader, templateNumber uint16) (Product, error) {
+	switch templateNumber {
+	case 0:
+		product := Product0{}
+		return product, read(f, &product)
+	case 1:
+		product := Product1{}
+		return product, read(f, &product)
+	case 2:
+		product := Product2{}
+		return product, read(f, &product)
+	case 5:
+		product := Product5{}
+		return product, read(f, &product)
+	case 6:
+		product := Product6{}
+		return product, read(f, &product)
+	case 7:
+		product := Product7{}
+		return product, read(f, &product)
+	case 8:
+		product := Product8{}
+		err := read(f, &product.Product0, &product.Time, &product.NumberOfIntervalTimeRanges, &product.TotalMissingDataValuesCount)
+		if err == nil {
+			err = readTimeRanges(f, product.NumberOfIntervalTimeRanges, &product.TimeRangeSpecification1, &product.TimeRangeSpecification2, &product.AdditionalTimeRangeSpecifications)
+		}
+		return product, err
+	case 11:
+		product := Product11{}
+		err := read(f, &product.Product1, &product.Time, &product.NumberOfIntervalTimeRanges, &product.TotalMissingDataValuesCount)
+		if err == nil {
+			err = readTimeRanges(f, product.NumberOfIntervalTimeRanges, &product.TimeRangeSpecification1, &product.TimeRangeSpecification2, &product.AdditionalTimeRangeSpecifications)
+		}
+		return product, err
+	case 12:
+		product := Product12{}
+		err := read(f, &product.Product2, &product.Time, &product.NumberOfIntervalTimeRanges, &product.TotalMissingDataValuesCount)
+		if err == nil {
+			err = readTimeRanges(f, product.NumberOfIntervalTimeRanges, &product.TimeRangeSpecification1, &product.TimeRangeSpecification2, &product.AdditionalTimeRangeSpecifications)
+		}
+		return product, err
+	}
+	return nil, ErrUnsupportedTemplate{Section: 4, Number: int(templateNumber)}
+}
+
+// newProduct returns a pointer to an empty product of templateNumber, nil if the template is not supported
+func newProduct(templateNumber uint16) interface{} {
+	switch templateNumber {
+	case 0:
+		return &Product0{}
+	case 1:
+		return &Product1{}
+	case 2:
+		return &Product2{}
+	case 5:
+		return &Product5{}
+	case 6:
+		return &Product6{}
+	case 7:
+		return &Product7{}
+	case 8:
+		return &Product8{}
+	case 11:
+		return &Product11{}
+	case 12:
+		return &Product12{}
+	}
+	return nil
+}
+
+//WriteProduct writes product in binary form, it is the inverse of ReadProduct
+func WriteProduct(w io.Writer, product Product) error {
+	switch p := product.(type) {
+	case Product8:
+		err := write(w, p.Product0, p.Time, p.NumberOfIntervalTimeRanges, p.TotalMissingDataValuesCount)
+		if err == nil {
+			err = writeTimeRanges(w, p.NumberOfIntervalTimeRanges, p.TimeRangeSpecification1, p.TimeRangeSpecification2, p.AdditionalTimeRangeSpecifications)
+		}
+		return err
+	case Product11:
+		err := write(w, p.Product1, p.Time, p.NumberOfIntervalTimeRanges, p.TotalMissingDataValuesCount)
+		if err == nil {
+			err = writeTimeRanges(w, p.NumberOfIntervalTimeRanges, p.TimeRangeSpecification1, p.TimeRangeSpecification2, p.AdditionalTimeRangeSpecifications)
+		}
+		return err
+	case Product12:
+		err := write(w, p.Product2, p.Time, p.NumberOfIntervalTimeRanges, p.TotalMissingDataValuesCount)
+		if err == nil {
+			err = writeTimeRanges(w, p.NumberOfIntervalTimeRanges, p.TimeRangeSpecification1, p.TimeRangeSpecification2, p.AdditionalTimeRangeSpecifications)
+		}
+		return err
+	case Product0, Product1, Product2, Product5, Product6, Product7:
+		return write(w, p)
+	}
+	return fmt.Errorf("Product definition template %T not supported", product)
+}
+
+// writeTimeRanges writes the time range specifications read by readTimeRanges
+func writeTimeRanges(w io.Writer, count uint8, first, second TimeRangeSpecification, additional []TimeRangeSpecification) error {
+	extra := 0
+	if count > 2 {
+		extra = int(count) - 2
+	}
+	if count == 0 || len(additional) != extra {
+		return fmt.Errorf("Product has %d time ranges and %d additional time range specifications", count, len(additional))
+	}
+	if err := write(w, first); err != nil || count == 1 {
+		return err
+	}
+	return write(w, second, additional)
+}
+
+// readTimeRanges reads the count time range specifications ending the templates of statistically processed
+// products. The second and additional specifications are only present when there is more than one time range.
+func readTimeRanges(f io.Reader, count uint8, first, second *TimeRangeSpecification, additional *[]TimeRangeSpecification) error {
+	if count == 0 {
+		return fmt.Errorf("Statistically processed product without time range specification")
+	}
+	if err := read(f, first); err != nil {
+		return err
+	}
+	if count == 1 {
+		return nil
+	}
+	if err := read(f, second); err != nil {
+		return err
+	}
+	if count > 2 {
+		*additional = make([]TimeRangeSpecification, count-2)
+		return read(f, *additional)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package griblib
+
+import (
+	"fmt"
+	"math"
+)
+
+// fullCircle is 360 degrees in the unit of the longitudes of Grid0 and Grid40, 10^-6 degree
+const fullCircle = 360_000_000
+
+// maxRegularGrowth is the most times the regular grid may outnumber the points of the quasi-regular grid, the
+// regular grid of a reduced Gaussian grid has about 1.3 to 2 times its points
+const maxRegularGrowth = 4
+
+// Regularize interpolates the data of a quasi-regular grid, such as a reduced Gaussian grid, onto the regular grid
+// with the number of points of its longest row in every row. The rows are interpolated linearly along the
+// longitudes, a grid point next to a NaN or missing value (see Section7.Missing) takes the value of the nearest point.
+// A row without points gives NaN values.
+//
+// The grid definition of section 3 is changed to the regular grid, Grid0 or Grid40, so that the filters and the
+// exports work with the message. Sections 5 and 6 still describe the packed values of the quasi-regular grid.
+// Regularize does nothing for a regular grid.
+func (message *Message) Regularize() error {
+	if len(message.Section3.PointCounts) == 0 {
+		return nil
+	}
+	if err := message.Decode(); err != nil {
+		return err
+	}
+	return message.regularize()
+}
+
+// regularize interpolates the decoded data of a quasi-regular grid, see Regularize
+func (message *Message) regularize() error {
+	section := &message.Section3
+	if len(section.PointCounts) == 0 {
+		return nil
+	}
+
+	var rows, ni uint32
+	var lo1, lo2 int32
+	var scanningMode uint8
+	switch grid := section.Definition.(type) {
+	case *Grid0:
+		rows, lo1, lo2, scanningMode = grid.Nj, grid.Lo1, grid.Lo2, grid.ScanningMode
+	case *Grid40:
+		rows, lo1, lo2, scanningMode = grid.Nj, grid.Lo1, grid.Lo2, grid.ScanningMode
+	default:
+		return fmt.Errorf("Quasi-regular grid definition %d not supported", section.TemplateNumber)
+	}
+	if scanningMode&0x20 != 0 {
+		return fmt.Errorf("Quasi-regular grid with consecutive points along the meridians not supported")
+	}
+	if int(rows) != len(section.PointCounts) {
+		return fmt.Errorf("%w: %d numbers of points for %d rows", ErrCorruptData, len(section.PointCounts), rows)
+	}
+	if len(message.Section7.Data) != int(section.DataPointCount) {
+		return fmt.Errorf("Message has %d values, the grid has %d points", len(message.Section7.Data), section.DataPointCount)
+	}
+	if missing := message.Section7.Missing; missing != nil && len(missing) != len(message.Section7.Data) {
+		return fmt.Errorf("Message has %d values and %d missing codes", len(message.Section7.Data), len(missing))
+	}
+	var total uint64
+	for _, count := range section.PointCounts {
+		if count > ni {
+			ni = count
+		}
+		total += uint64(count)
+	}
+	if total != uint64(section.DataPointCount) {
+		return fmt.Errorf("%w: rows of %d points in total, the grid has %d points", ErrCorruptData, total, section.DataPointCount)
+	}
+	if uint64(ni)*uint64(rows) > maxRegularGrowth*total {
+		return fmt.Errorf("%w: a regular grid of %d rows of %d points for %d points", ErrCorruptData, rows, ni, total)
+	}
+
+	// the rows either span the longitudes from Lo1 to Lo2, or a full circle from Lo1 (Code table 3.11)
+	span := ((int64(lo2)-int64(lo1))%fullCircle + fullCircle) % fullCircle
+	circle := section.PointCountInterpretation == 2 ||
+		(ni > 1 && math.Abs(float64(span)*float64(ni)/float64(ni-1)-fullCircle) < float64(ni))
+	var di int32
+	switch {
+	case circle:
+		di = int32(math.Round(fullCircle / float64(ni)))
+		lo2 = int32((int64(lo1) + int64(ni-1)*int64(di)) % fullCircle)
+	case ni > 1:
+		di = int32(math.Round(float64(span) / float64(ni-1)))
+	}
+
+	data, missing := message.Section7.Data, message.Section7.Missing
+	regular := make([]float64, 0, int(ni)*int(rows))
+	var regularMissing []uint8
+	if missing != nil {
+		regularMissing = make([]uint8, 0, cap(regular))
+	}
+	start := 0
+	for _, count := range section.PointCounts {
+		row := data[start : start+int(count)]
+		var rowMissing []uint8
+		if missing != nil {
+			rowMissing = missing[start : start+int(count)]
+		}
+		for i := 0; i < int(ni); i++ {
+			value, code := interpolateRow(row, rowMissing, i, int(ni), circle)
+			regular = append(regular, value)
+			if missing != nil {
+				regularMissing = append(regularMissing, code)
+			}
+		}
+		start += int(count)
+	}
+
+	// the grid is copied, the copies of the message keep the quasi-regular grid
+	switch grid := section.Definition.(type) {
+	case *Grid0:
+		regularGrid := *grid
+		regularGrid.Ni, regularGrid.Lo2, regularGrid.Di = ni, lo2, di
+		regularGrid.ResolutionAndComponentFlags |= 0x20
+		section.Definition = &regularGrid
+	case *Grid40:
+		regularGrid := *grid
+		regularGrid.Ni, regularGrid.Lo2, regularGrid.Di = ni, lo2, di
+		regularGrid.ResolutionAndComponentFlags |= 0x20
+		section.Definition = &regularGrid
+	}
+	section.DataPointCount = uint32(len(regular))
+	section.PointCountOctets = 0
+	section.PointCountInterpretation = 0
+	section.PointCounts = nil
+	message.Section7.Data, message.Section7.Missing = regular, regularMissing
+	return nil
+}
+
+// interpolateRow returns the value and the missing code at point i of a regular row of n points, interpolated
+// from the points of row. A row spanning a full circle wraps around.
+func interpolateRow(row []float64, missing []uint8, i int, n int, circle bool) (float64, uint8) {
+	count := len(row)
+	if count == 0 {
+		return math.NaN(), BitmapMissing
+	}
+	var position float64
+	switch {
+	case circle:
+		position = float64(i) * float64(count) / float64(n)
+	case n > 1:
+		position = float64(i) * float64(count-1) / float64(n-1)
+	}
+
+	first := int(position)
+	weight := position - float64(first)
+	second := first + 1
+	if second == count {
+		second = 0
+		if !circle {
+			second = first
+		}
+	}
+
+	code := func(index int) uint8 {
+		if missing == nil {
+			return NotMissing
+		}
+		return missing[index]
+	}
+	nearest := first
+	if weight > 0.5 {
+		nearest = second
+	}
+	if weight < 1e-9 || math.IsNaN(row[first]) || math.IsNaN(row[second]) ||
+		code(first) != NotMissing || code(second) != NotMissing {
+		return row[nearest], code(nearest)
+	}
+	return (1-weight)*row[first] + weight*row[second], NotMissing
+}
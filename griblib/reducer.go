@@ -2,53 +2,75 @@ package griblib
 
 import (
 	"bytes"
+	"fmt"
 	"io"
-	"log"
-	"strings"
 )
 
-//Reduce the file in readseeker with the given options, omitting all other products and areas
-func Reduce(readSeeker io.Reader, options Options, content chan []byte, end chan bool) {
-	if options.Discipline == -1 {
-		log.Println("No disciplines defined for reduce.")
-		end <- true
-		return
-	}
-	for {
-		messageSection0Bytes := make([]byte, 16)
-		if section0ByteCount, err := readSeeker.Read(messageSection0Bytes); section0ByteCount == 0 || err != nil {
-			log.Println("Read 0 bytes, returning.")
-			end <- true
-			return
+//Reduce copies the messages of gribFile satisfying options to reduced. The messages are selected on their
+//headers like FilterMessage, by discipline, category, parameters, surface and forecast times; the bytes of
+//a selected message are copied as they are, nothing is decoded or re-encoded.
+//
+//The GeoFilter of options is not applied, since cutting the grid requires the data to be re-encoded. Use
+//FilterMessage and WriteMessage for that.
+//
+//A *TruncatedMessageError is returned if gribFile ends in the middle of a message.
+func Reduce(gribFile io.Reader, reduced io.Writer, options Options) error {
+	reader := newMessageReader(ReadOptions{})
+	for number := 1; ; number++ {
+		section0, head, body, err := reader.readRawMessage(gribFile)
+		if err == io.EOF {
+			return nil
 		}
-		section0, err := ReadSection0(bytes.NewReader(messageSection0Bytes))
-
 		if err != nil {
-			if !isEOF(err) {
-				log.Println("section0 read err: ", err.Error())
-			}
-			end <- true
-			return
-
+			return err
 		}
 
-		if section0.Discipline == uint8(options.Discipline) {
-			messageContentBytes := make([]byte, section0.MessageLength-16)
-			_, err = readSeeker.Read(messageContentBytes)
-			if err != nil {
-				log.Printf("read2 err: %v", err.Error())
-				end <- true
-			}
-			content <- messageSection0Bytes
-			content <- messageContentBytes
-		} else {
-			readSeeker.Read(make([]byte, int64(section0.MessageLength)-16))
+		message, err := readHeaders(body, section0)
+		if err != nil {
+			return fmt.Errorf("Message %d: %w", number, err)
+		}
+		if !satisfiesHeaders(message, options) {
+			continue
+		}
+		if _, err := reduced.Write(head); err != nil {
+			return err
+		}
+		if _, err := reduced.Write(body); err != nil {
+			return err
 		}
-
 	}
 }
 
-func isEOF(err error) bool {
-	log.Printf("Error:: %s", err.Error())
-	return strings.Contains(err.Error(), "EOF")
+// readHeaders reads sections 1 and 4 of the body of a message, the sections that Reduce selects messages on.
+// The other sections are skipped, so messages with a grid or data template that can not be decoded are
+// selected like the others.
+func readHeaders(body []byte, section0 Section0) (*Message, error) {
+	message := Message{Section0: section0}
+	reader := bytes.NewReader(body)
+	for {
+		head, err := ReadSectionHead(reader)
+		if err != nil {
+			return &message, sectionsError(err)
+		}
+		if head.Number == 8 {
+			return &message, nil
+		}
+		length := head.ContentLength()
+		if length < 0 || length > reader.Len() {
+			return &message, fmt.Errorf("%w: section %d has a length of %d octets", ErrCorruptData, head.Number, head.ByteLength)
+		}
+		content := body[len(body)-reader.Len():][:length]
+		switch head.Number {
+		case 1:
+			message.Section1, err = ReadSection1(bytes.NewReader(content), length)
+		case 4:
+			message.Section4, err = ReadSection4(bytes.NewReader(content), length)
+		}
+		if err != nil {
+			return &message, err
+		}
+		if _, err := reader.Seek(int64(length), io.SeekCurrent); err != nil {
+			return &message, err
+		}
+	}
 }
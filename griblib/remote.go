@@ -0,0 +1,153 @@
+package griblib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Remote reads the messages of a grib file served over HTTP with range requests, so that only the
+// selected messages are downloaded. The server must support range requests.
+//
+//	remote := griblib.NewRemote(url, nil)
+//	index, err := remote.ReadIdx(url + ".idx")
+//	...
+//	messages, err := remote.ReadMessages(index.Select(...))
+type Remote struct {
+	url    string
+	client *http.Client
+}
+
+// NewRemote returns a Remote reading the file at url with client, or with http.DefaultClient if client is nil
+func NewRemote(url string, client *http.Client) *Remote {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Remote{url: url, client: client}
+}
+
+// ReadIdx reads the index of the file from the NOAA .idx file at idxURL, usually the url of the file followed by .idx
+func (remote *Remote) ReadIdx(idxURL string) (Index, error) {
+	response, err := remote.client.Get(idxURL)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Could not get %s: %s", idxURL, response.Status)
+	}
+	return ReadIdx(response.Body)
+}
+
+// ProbeIndex builds the index of the file from section 0 of every message, with a range request per message.
+// Only the number, offset, length and discipline of the entries are known, use ReadIdx for the other fields.
+func (remote *Remote) ProbeIndex() (Index, error) {
+	index := Index{}
+	offset := int64(0)
+	for {
+		body, err := remote.fetch(ByteRange{Offset: offset, Length: 16})
+		if err == io.EOF {
+			return index, nil
+		}
+		if err != nil {
+			return index, err
+		}
+		section0, err := ReadSection0(body)
+		body.Close()
+		if err == io.EOF {
+			return index, nil
+		}
+		if err != nil {
+			return index, fmt.Errorf("Message %d at offset %d: %w", len(index)+1, offset, err)
+		}
+		index = append(index, IndexEntry{
+			Number:     len(index) + 1,
+			Offset:     offset,
+			Length:     int64(section0.MessageLength),
+			Discipline: section0.Discipline,
+		})
+		offset += int64(section0.MessageLength)
+	}
+}
+
+// ReadAt reads len(p) octets of the file at offset with a range request, it implements io.ReaderAt
+// so that a Remote can be given to ReadMessageAt.
+func (remote *Remote) ReadAt(p []byte, offset int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	body, err := remote.fetch(ByteRange{Offset: offset, Length: int64(len(p))})
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	n, err := io.ReadFull(body, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// ReadMessages downloads the messages of index and reads them with ReadMessage. Consecutive messages are
+// downloaded with a single range request, see Index.ByteRanges.
+//
+// Like ReadMessage, a message refering to a previously defined bitmap can not be decoded by ReadMessages.
+func (remote *Remote) ReadMessages(index Index) ([]*Message, error) {
+	messages := []*Message{}
+	for _, byteRange := range index.ByteRanges() {
+		body, err := remote.fetch(byteRange)
+		if err != nil {
+			return messages, err
+		}
+		data, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return messages, err
+		}
+		if byteRange.Length != 0 && int64(len(data)) != byteRange.Length {
+			return messages, fmt.Errorf("Got %d octets at offset %d, expected %d", len(data), byteRange.Offset, byteRange.Length)
+		}
+
+		reader := bytes.NewReader(data)
+		for reader.Len() > 0 {
+			message, err := ReadMessage(reader)
+			if err != nil {
+				return messages, fmt.Errorf("Message at offset %d: %w", byteRange.Offset+reader.Size()-int64(reader.Len()), err)
+			}
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+// fetch requests byteRange of the file, io.EOF is returned if it starts at the end of the file
+func (remote *Remote) fetch(byteRange ByteRange) (io.ReadCloser, error) {
+	request, err := http.NewRequest(http.MethodGet, remote.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if byteRange.Length > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", byteRange.Offset, byteRange.Offset+byteRange.Length-1))
+	} else {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", byteRange.Offset))
+	}
+
+	response, err := remote.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	switch response.StatusCode {
+	case http.StatusPartialContent:
+		return response.Body, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		response.Body.Close()
+		return nil, io.EOF
+	case http.StatusOK:
+		response.Body.Close()
+		return nil, fmt.Errorf("The server of %s does not support range requests", remote.url)
+	default:
+		response.Body.Close()
+		return nil, fmt.Errorf("Could not get %s: %s", remote.url, response.Status)
+	}
+}
@@ -0,0 +1,80 @@
+package griblib
+
+import (
+	"io"
+)
+
+// Scanner reads the messages of a grib file one at a time, so that files larger than memory can be
+// processed. Successive calls to Next step through the messages:
+//
+//	scanner := griblib.NewScanner(gribFile)
+//	for scanner.Next() {
+//		message := scanner.Message()
+//		...
+//	}
+//	if err := scanner.Err(); err != nil {
+//		...
+//	}
+//
+// Unlike ReadMessage, a Scanner remembers the bitmaps of previous messages.
+//
+// With ReadOptions.Tolerant, junk between messages and messages that can not be read are skipped, and
+// reported by Warnings once the scanner has moved past them.
+type Scanner struct {
+	gribFile io.Reader
+	reader   *messageReader
+	message  *Message
+	err      error
+}
+
+// NewScanner returns a Scanner reading messages from gribFile with the default options
+func NewScanner(gribFile io.Reader) *Scanner {
+	return NewScannerWithOptions(gribFile, DefaultReadOptions())
+}
+
+// NewScannerWithOptions returns a Scanner reading messages from gribFile, decoding them as specified by options
+func NewScannerWithOptions(gribFile io.Reader, options ReadOptions) *Scanner {
+	return &Scanner{
+		gribFile: gribFile,
+		reader:   newMessageReader(options),
+	}
+}
+
+// Next reads the next message, which is then available through Message. It returns false at the end
+// of the file or when a message can not be read, Err tells which.
+func (s *Scanner) Next() bool {
+	if s.err != nil {
+		return false
+	}
+	message, err := s.reader.readMessage(s.gribFile)
+	if err != nil {
+		// io.EOF is only returned unwrapped, at the end of the last message; a file ending in the middle
+		// of a message gives an error matching ErrTruncatedMessage
+		s.message = nil
+		s.err = err
+		return false
+	}
+	s.message = message
+	return true
+}
+
+// Message returns the message read by the last call to Next
+func (s *Scanner) Message() *Message {
+	return s.message
+}
+
+// Warnings returns the parts of the file skipped so far with ReadOptions.Tolerant, in the order they were
+// skipped. With ReadOptions.HeadersOnly, the messages that fail when they are decoded are added then.
+func (s *Scanner) Warnings() []Warning {
+	s.reader.mutex.Lock()
+	defer s.reader.mutex.Unlock()
+	return append([]Warning(nil), s.reader.warnings...)
+}
+
+// Err returns the error that stopped the Scanner, or nil if it reached the end of the file
+func (s *Scanner) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+	return s.err
+}
@@ -3,10 +3,16 @@ package griblib
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
-	"strings"
+	"log/slog"
+	"math"
+	"math/bits"
+	"reflect"
+	"slices"
+	"sync"
 )
 
 //Message is the entire message for a data-layer
@@ -19,6 +25,39 @@ type Message struct {
 	Section5 Section5
 	Section6 Section6
 	Section7 Section7
+
+	// pending holds the undecoded section 7 of a message read with ReadOptions.HeadersOnly
+	pending *pendingData
+	// logger is the ReadOptions.Logger the message was read with, the filters log to it
+	logger *slog.Logger
+}
+
+// pendingData is a section 7 waiting to be decoded with options. The copies of a message share it, the data is
+// decoded once for all of them.
+type pendingData struct {
+	rawData []byte
+	options ReadOptions
+	// warn reports the decoding error as a warning of the reader, with ReadOptions.Tolerant
+	warn func(cause error)
+
+	once     sync.Once
+	section3 Section3
+	section7 Section7
+	err      error
+}
+
+// decode decodes the data of message the first time it is called, and returns the decoded sections 3 and 7
+func (pending *pendingData) decode(message Message) (Section3, Section7, error) {
+	pending.once.Do(func() {
+		message.pending = nil
+		pending.err = message.decodeSection7(pending.rawData, pending.options)
+		pending.section3, pending.section7 = message.Section3, message.Section7
+		pending.rawData = nil
+		if pending.err != nil && pending.warn != nil {
+			pending.warn(pending.err)
+		}
+	})
+	return pending.section3, pending.section7, pending.err
 }
 
 //Options is used to filter messages.
@@ -26,7 +65,9 @@ type Options struct {
 	Operation               string    `json:"operation"`
 	Discipline              int       `json:"discipline"` // -1 means all disciplines
 	DataExport              bool      `json:"dataExport"`
-	Category                int       `json:"category"` // -1 means all categories
+	Category                int       `json:"category"`      // -1 means all categories
+	Parameters              []int     `json:"parameters"`    // parameter numbers within the category, empty means all
+	ForecastTimes           []int     `json:"forecastTimes"` // forecast times in the unit of the product, empty means all
 	Filepath                string    `json:"filePath"`
 	ReduceFilePath          string    `json:"reduceFilePath"`
 	ExportType              int       `json:"exportType"`
@@ -36,6 +77,30 @@ type Options struct {
 	// empty filter , GeoFilter{},  means no filter
 }
 
+//ReadOptions controls how messages are decoded
+type ReadOptions struct {
+	// BitmapFill is the value given to grid points that are switched off by the bitmap in section 6
+	BitmapFill float64
+	// HeadersOnly keeps section 7 undecoded until Message.Data or Message.Decode is called, for
+	// messages that are only read for their headers
+	HeadersOnly bool
+	// Tolerant skips whatever is not a valid message, like bulletin headers, padding or corrupt messages,
+	// scanning forward to the next 'GRIB'. The skipped octets are reported by Scanner.Warnings.
+	Tolerant bool
+	// Logger receives the skipped octets and the errors met while reading, nothing is logged if it is nil
+	Logger *slog.Logger
+	// Regularize interpolates the data of quasi-regular grids onto regular grids, see Message.Regularize
+	Regularize bool
+}
+
+//DefaultReadOptions returns the options used by ReadMessage, ReadMessages and ReadNMessages.
+//Grid points masked out by a bitmap are filled with NaN.
+func DefaultReadOptions() ReadOptions {
+	return ReadOptions{
+		BitmapFill: math.NaN(),
+	}
+}
+
 const (
 	//Grib is a magic-number specifying the grib2-format
 	Grib = 0x47524942
@@ -45,131 +110,388 @@ const (
 	SupportedGribEdition = 2
 )
 
-// Data returns the data as an array of float64
+// Data returns the data as an array of float64. The data of a message read with ReadOptions.HeadersOnly
+// is decoded by the first call, use Decode to get the error if it can not be decoded.
+//
+// The copies of a message share the decoded data, Data leaves section 7 of the message as it is. Call Decode
+// to fill section 7, and section 3 of a grid regularized by ReadOptions.Regularize.
 func (message Message) Data() []float64 {
+	if message.pending != nil {
+		_, section7, err := message.pending.decode(message)
+		if err != nil {
+			loggerOrDiscard(message.pending.options.Logger).Error("Error decoding data", "error", err)
+		}
+		return section7.Data
+	}
 	return message.Section7.Data
 }
 
-//ReadMessages reads at most n first messages from gribFile
+// Decode decodes section 7 of a message read with ReadOptions.HeadersOnly into the message. It does
+// nothing if the data is decoded already.
+//
+// With ReadOptions.Tolerant, a message that can not be decoded is reported as a warning of the Scanner
+// that read it, like the messages skipped while reading.
+func (message *Message) Decode() error {
+	if message.pending == nil {
+		return nil
+	}
+	section3, section7, err := message.pending.decode(*message)
+	if err != nil {
+		return err
+	}
+	if message.pending.options.Regularize {
+		message.Section3 = section3
+	}
+	message.Section7, message.pending = section7, nil
+	return nil
+}
+
+// decodeSection7 decodes the content of section 7 and spreads the values over the grid, regularized if options
+// tell so
+func (message *Message) decodeSection7(rawData []byte, options ReadOptions) (err error) {
+	// the number of values decides the allocations of ReadSection7, it must match the grid before
+	valueCount, err := message.Section6.valueCount(int(message.Section3.DataPointCount))
+	if err != nil {
+		return err
+	}
+	if uint64(message.Section5.PointsNumber) != uint64(valueCount) {
+		return fmt.Errorf("%w: section 5 has %d values, the grid has %d points with a value", ErrCorruptData,
+			message.Section5.PointsNumber, valueCount)
+	}
+	message.Section7, err = ReadSection7(bytes.NewReader(rawData), len(rawData), message.Section5)
+	if err == nil {
+		message.Section7.Data, err = message.Section6.Expand(message.Section7.Data, int(message.Section3.DataPointCount), options.BitmapFill)
+	}
+	if err == nil {
+		message.Section7.Missing = message.Section6.expandMissing(message.Section7.Missing, int(message.Section3.DataPointCount))
+	}
+	if err == nil && options.Regularize {
+		err = message.regularize()
+	}
+	return err
+}
+
+//ReadNMessages reads at most n first messages from gribFile
 //if an error occurs, the read messages and the error is returned
 func ReadNMessages(gribFile io.Reader, n int) ([]*Message, error) {
 	messages := make([]*Message, 0)
+	scanner := NewScanner(gribFile)
 
-	for {
-		message, messageErr := ReadMessage(gribFile)
-
-		if messageErr != nil {
-			if strings.Contains(messageErr.Error(), "EOF") {
-				return messages, nil
-			}
-			log.Println("Error when parsing a message, ", messageErr.Error())
-			return messages, messageErr
-		}
-		messages = append(messages, message)
+	for scanner.Next() {
+		messages = append(messages, scanner.Message())
 		if len(messages) >= n {
 			return messages, nil
 		}
 	}
+	if err := scanner.Err(); err != nil {
+		return messages, err
+	}
+	return messages, nil
 }
 
 //ReadMessages reads all message from gribFile
 func ReadMessages(gribFile io.Reader) ([]*Message, error) {
+	return ReadMessagesWithOptions(gribFile, DefaultReadOptions())
+}
+
+//ReadMessagesWithOptions reads all message from gribFile, decoding them as specified by options.
+//All messages are kept in memory, use a Scanner to process one message at a time.
+//The parts of the file skipped with options.Tolerant are logged to options.Logger, Scanner.Warnings returns them.
+func ReadMessagesWithOptions(gribFile io.Reader, options ReadOptions) ([]*Message, error) {
 
 	messages := make([]*Message, 0)
+	scanner := NewScannerWithOptions(gribFile, options)
 
-	for {
-		message, messageErr := ReadMessage(gribFile)
-		if messageErr != nil {
-			if strings.Contains(messageErr.Error(), "EOF") {
-				return messages, nil
-			}
-			log.Println("Error when parsing a message, ", messageErr.Error())
-			return messages, messageErr
-		}
-		messages = append(messages, message)
+	for scanner.Next() {
+		messages = append(messages, scanner.Message())
+	}
+	if err := scanner.Err(); err != nil {
+		loggerOrDiscard(options.Logger).Error("Error when parsing a message", "error", err)
+		return messages, err
 	}
+	return messages, nil
 }
 
 //ReadMessage reads the actual messages from a gribfile-reader (io.Reader from either file, http or any other io.Reader)
+//Use a Remote to download only selected messages of a file served over http.
+//
+//Since every call is independent of the previous ones, a message refering to a previously defined bitmap
+//can not be decoded by ReadMessage. Use ReadMessages for those.
 func ReadMessage(gribFile io.Reader) (*Message, error) {
+	return newMessageReader(DefaultReadOptions()).readMessage(gribFile)
+}
+
+// messageReader reads consecutive messages from the same file, keeping the state that
+// carries over from one message to the next.
+type messageReader struct {
+	options    ReadOptions
+	lastBitmap []byte
+	offset     int64     // offset of the next message in the file
+	unread     []byte    // octets read ahead of offset while looking for the next message
+	warnings   []Warning // octets skipped with ReadOptions.Tolerant
+	// mutex guards warnings, which are also added by the messages decoded later, see Message.Decode
+	mutex sync.Mutex
+}
 
-	message := Message{}
-	section0, headError := ReadSection0(gribFile)
+func newMessageReader(options ReadOptions) *messageReader {
+	return &messageReader{options: options}
+}
 
-	if headError != nil {
-		return &message, headError
+func (r *messageReader) readMessage(gribFile io.Reader) (*Message, error) {
+	for {
+		section0, _, messageBytes, err := r.readRawMessage(gribFile)
+		if err != nil {
+			return &Message{Section0: section0}, err
+		}
+		// junk may have been skipped before the message
+		offset := r.offset - int64(section0.MessageLength)
+		message, err := r.readSections(messageBytes, section0)
+		if err != nil && r.options.Tolerant {
+			r.warn(offset, int64(section0.MessageLength), err)
+			continue
+		}
+		if err != nil {
+			return message, fmt.Errorf("Message at offset %d: %w", offset, err)
+		}
+		if message.pending != nil && r.options.Tolerant {
+			length := int64(section0.MessageLength)
+			message.pending.warn = func(cause error) { r.warn(offset, length, cause) }
+		}
+		return message, nil
+	}
+}
+
+// readRawMessage reads the next message of gribFile without decoding it. It returns section 0 with its
+// 16 octets and the octets of the rest of the message. io.EOF is returned at the end of the file, a
+// *TruncatedMessageError if the file ends in the middle of a message.
+//
+// With ReadOptions.Tolerant, the octets up to the next 'GRIB' are skipped instead of returning an error.
+func (r *messageReader) readRawMessage(gribFile io.Reader) (Section0, []byte, []byte, error) {
+	for {
+		section0, head, body, err := r.readFramedMessage(gribFile)
+		if err == nil || err == io.EOF || !r.options.Tolerant {
+			return section0, head, body, err
+		}
+		if err = r.resync(gribFile, append(head, body...), err); err != nil {
+			return section0, nil, nil, err
+		}
 	}
+}
 
-	messageBytes := make([]byte, section0.MessageLength-16)
+// readFramedMessage reads the message at offset, checking that it starts with 'GRIB' and ends with '7777'.
+// On errors, head and body hold the octets that were read.
+func (r *messageReader) readFramedMessage(gribFile io.Reader) (section0 Section0, head []byte, body []byte, err error) {
+	head = make([]byte, 16)
+	n, err := r.readFull(gribFile, head)
+	head = head[:n]
+	if err == io.ErrUnexpectedEOF {
+		return section0, head, nil, &TruncatedMessageError{Offset: r.offset, Length: 16, Read: int64(n)}
+	}
+	if err != nil {
+		return section0, head, nil, err
+	}
+	section0, err = ReadSection0(bytes.NewReader(head))
+	if err != nil {
+		return section0, head, nil, err
+	}
+	if section0.MessageLength < 20 || section0.MessageLength > math.MaxInt64 {
+		return section0, head, nil, fmt.Errorf("%w: invalid message length %d at offset %d", ErrBadIndicator, section0.MessageLength, r.offset)
+	}
 
-	numBytes, readError := gribFile.Read(messageBytes)
+	body, err = r.readBody(gribFile, section0.MessageLength-16)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return section0, head, body, &TruncatedMessageError{Offset: r.offset, Length: int64(section0.MessageLength), Read: int64(16 + len(body))}
+	}
+	if err != nil {
+		return section0, head, body, err
+	}
+	if string(body[len(body)-4:]) != "7777" {
+		return section0, head, body, fmt.Errorf("Message at offset %d: %w", r.offset, ErrMissingEndSection)
+	}
+	r.offset += int64(section0.MessageLength)
+	return section0, head, body, nil
+}
 
-	if readError != nil {
-		log.Println("Error reading message")
-		return &message, readError
+// readBody reads the length octets of a message after section 0. The buffer grows with the octets read, so
+// that a corrupt length can not allocate more than the file holds.
+func (r *messageReader) readBody(gribFile io.Reader, length uint64) ([]byte, error) {
+	const chunkSize = 1 << 20
+	var body []byte
+	for uint64(len(body)) < length {
+		size := int(min(length-uint64(len(body)), chunkSize))
+		body = slices.Grow(body, size)
+		n, err := r.readFull(gribFile, body[len(body):len(body)+size])
+		body = body[:len(body)+n]
+		if err == io.EOF && len(body) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return body, err
+		}
 	}
+	return body, nil
+}
 
-	if numBytes != int(section0.MessageLength-16) {
-		log.Println("Did not read full message")
+// readFull reads len(p) octets, first from the octets read ahead then from gribFile
+func (r *messageReader) readFull(gribFile io.Reader, p []byte) (int, error) {
+	n := copy(p, r.unread)
+	r.unread = r.unread[n:]
+	if n == len(p) {
+		return n, nil
+	}
+	m, err := io.ReadFull(gribFile, p[n:])
+	if err == io.EOF && n > 0 {
+		err = io.ErrUnexpectedEOF
 	}
+	return n + m, err
+}
 
-	return readMessage(bytes.NewReader(messageBytes), section0)
+// resync skips the octets of a bad message at offset up to the next 'GRIB', read is what was read of the
+// message and cause why it was rejected. io.EOF is returned if no message follows.
+func (r *messageReader) resync(gribFile io.Reader, read []byte, cause error) error {
+	const marker = "GRIB"
+	start := r.offset
+	// the bad message starts at offset, look for the next one after its first octet
+	r.offset++
+	pending := read
+	if len(pending) > 0 {
+		pending = pending[1:]
+	}
+	chunk := make([]byte, 4096)
+	for {
+		if i := bytes.Index(pending, []byte(marker)); i >= 0 {
+			r.offset += int64(i)
+			r.unread = append(pending[i:], r.unread...)
+			r.warn(start, r.offset-start, cause)
+			return nil
+		}
+		// keep the end of pending, which may be the start of a marker
+		keep := len(pending) - len(marker) + 1
+		if keep < 0 {
+			keep = 0
+		}
+		r.offset += int64(keep)
+		pending = pending[keep:]
+
+		var n int
+		var err error
+		if len(r.unread) > 0 {
+			n = copy(chunk, r.unread)
+			r.unread = r.unread[n:]
+		} else {
+			n, err = gribFile.Read(chunk)
+		}
+		pending = append(pending, chunk[:n]...)
+		if err == io.EOF && n == 0 {
+			r.offset += int64(len(pending))
+			r.warn(start, r.offset-start, cause)
+			return io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+	}
+}
 
+// warn records that length octets at offset were skipped because of cause
+func (r *messageReader) warn(offset int64, length int64, cause error) {
+	r.mutex.Lock()
+	r.warnings = append(r.warnings, Warning{Offset: offset, Length: length, Err: cause})
+	r.mutex.Unlock()
+	loggerOrDiscard(r.options.Logger).Warn("Skipped octets", "offset", offset, "length", length, "error", cause)
 }
 
-func readMessage(gribFile io.Reader, section0 Section0) (*Message, error) {
+func (r *messageReader) readSections(body []byte, section0 Section0) (*Message, error) {
+	gribFile := bytes.NewReader(body)
 
 	message := Message{
 		Section0: section0,
+		logger:   r.options.Logger,
 	}
 	for {
 
 		// pre-parse section head to decide which struct use
 		sectionHead, headErr := ReadSectionHead(gribFile)
 		if headErr != nil {
-			log.Println("Error reading header", headErr.Error())
-			return &message, headErr
+			return &message, sectionsError(headErr)
 		}
 
-		if sectionHead.ContentLength() > 0 {
-			var rawData = make([]byte, sectionHead.ContentLength())
-			err := binary.Read(gribFile, binary.BigEndian, &rawData)
-			if err != nil {
-				return &message, err
-			}
-			byteReader := bytes.NewBuffer(rawData)
-
-			switch sectionHead.Number {
-
-			case 1:
-				message.Section1, err = ReadSection1(byteReader, sectionHead.ContentLength())
-			case 2:
-				message.Section2, err = ReadSection2(byteReader, sectionHead.ContentLength())
-			case 3:
-				message.Section3, err = ReadSection3(byteReader, sectionHead.ContentLength())
-			case 4:
-				message.Section4, err = ReadSection4(byteReader, sectionHead.ContentLength())
-			case 5:
-				message.Section5, err = ReadSection5(byteReader, sectionHead.ContentLength())
-			case 6:
-				message.Section6, err = ReadSection6(byteReader, sectionHead.ContentLength())
-			case 7:
-				message.Section7, err = ReadSection7(byteReader, sectionHead.ContentLength(), message.Section5)
-			case 8:
-				// end-section, return
-				return &message, nil
-			default:
-				err = fmt.Errorf("Unknown section number %d  (Something bad with parser or files)", sectionHead.Number)
+		if sectionHead.Number == 8 {
+			// end-section, return
+			return &message, nil
+		}
+		if sectionHead.ContentLength() < 0 {
+			return &message, fmt.Errorf("%w: section %d has a length of %d octets", ErrCorruptData, sectionHead.Number, sectionHead.ByteLength)
+		}
+		// checked before allocating the section, its length is read from the file
+		if sectionHead.ContentLength() > gribFile.Len() {
+			return &message, fmt.Errorf("%w: section %d of %d octets runs past the end of the message", ErrTruncatedMessage, sectionHead.Number, sectionHead.ByteLength)
+		}
+
+		// section 7 is empty for constant fields, section 2 may be empty
+		var rawData = make([]byte, sectionHead.ContentLength())
+		err := binary.Read(gribFile, binary.BigEndian, &rawData)
+		if err != nil {
+			return &message, sectionsError(err)
+		}
+		byteReader := bytes.NewBuffer(rawData)
+
+		switch sectionHead.Number {
+
+		case 1:
+			message.Section1, err = ReadSection1(byteReader, sectionHead.ContentLength())
+		case 2:
+			message.Section2, err = ReadSection2(byteReader, sectionHead.ContentLength())
+		case 3:
+			message.Section3, err = ReadSection3(byteReader, sectionHead.ContentLength())
+		case 4:
+			message.Section4, err = ReadSection4(byteReader, sectionHead.ContentLength())
+		case 5:
+			message.Section5, err = ReadSection5(byteReader, sectionHead.ContentLength())
+		case 6:
+			message.Section6, err = ReadSection6(byteReader, sectionHead.ContentLength())
+			if err == nil {
+				err = r.resolveBitmap(&message.Section6)
 			}
-			if err != nil {
-				return &message, err
+		case 7:
+			if r.options.HeadersOnly {
+				message.pending = &pendingData{rawData: rawData, options: r.options}
+			} else {
+				err = message.decodeSection7(rawData, r.options)
 			}
-		} else {
-			return &message, nil
+		default:
+			err = fmt.Errorf("Unknown section number %d  (Something bad with parser or files)", sectionHead.Number)
+		}
+		if err != nil {
+			return &message, err
 		}
 	}
 }
 
+// sectionsError returns ErrTruncatedMessage for an end of file in the sections of a message, which
+// means that the sections run past the length given in section 0
+func sectionsError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: the sections run past the end of the message", ErrTruncatedMessage)
+	}
+	return err
+}
+
+// resolveBitmap remembers the bitmap of section for later messages, or copies the remembered bitmap into
+// section if it refers to a previously defined bitmap.
+func (r *messageReader) resolveBitmap(section *Section6) error {
+	switch section.BitmapIndicator {
+	case BitmapApplies:
+		r.lastBitmap = section.Bitmap
+	case BitmapPreviouslyDefined:
+		if r.lastBitmap == nil {
+			return fmt.Errorf("Message refers to a previously defined bitmap, but no bitmap has been defined")
+		}
+		section.Bitmap = r.lastBitmap
+	}
+	return nil
+}
+
 // Section0 is the indicator section http://www.nco.ncep.noaa.gov/pmb/docs/grib2/grib2_sect0.shtml
 // This section serves to identify the start of the record in a human readable form, indicate the total length of the message,
 // and indicate the Edition number of GRIB used to construct or encode the message. For GRIB2, this section is always 16 octets
@@ -199,10 +521,10 @@ func ReadSection0(reader io.Reader) (section0 Section0, err error) {
 
 	if section0.Indicator == Grib {
 		if section0.Edition != SupportedGribEdition {
-			return section0, fmt.Errorf("Unsupported grib edition %d", section0.Edition)
+			return section0, fmt.Errorf("%w %d", ErrUnsupportedEdition, section0.Edition)
 		}
 	} else {
-		return section0, fmt.Errorf("Unsupported grib indicator %d", section0.Indicator)
+		return section0, fmt.Errorf("%w: unsupported grib indicator %d", ErrBadIndicator, section0.Indicator)
 	}
 
 	return
@@ -224,7 +546,7 @@ func ReadSectionHead(section io.Reader) (head SectionHead, err error) {
 	var length uint32
 	err = binary.Read(section, binary.BigEndian, &length)
 	if err != nil {
-		return head, fmt.Errorf("Read of Length failed: %s", err.Error())
+		return head, fmt.Errorf("Read of Length failed: %w", err)
 	}
 	if length == EndSectionLength {
 		return SectionHead{
@@ -379,14 +701,16 @@ type Section3 struct {
 	PointCountInterpretation uint8       `json:"pointCountInterpretation"`
 	TemplateNumber           uint16      `json:"templateNumber"`
 	Definition               interface{} `json:"definition"`
+	PointCounts              []uint32    `json:"pointCounts,omitempty"` // numbers of points of the rows of a quasi-regular grid
 }
 
 func (s Section3) String() string {
 	return fmt.Sprint("Point count: ", s.DataPointCount, " Definition: ", GridDefinitionTemplateDescription(int(s.TemplateNumber)))
 }
 
-//ReadSection3 reads section3 from reader(f). the Lenght parameter is ignored
-func ReadSection3(f io.Reader, _ int) (section Section3, err error) {
+//ReadSection3 reads section3 from reader(f), length is the length of the content of the section. The optional
+//list of numbers of points of a quasi-regular grid is read into PointCounts.
+func ReadSection3(f io.Reader, length int) (section Section3, err error) {
 
 	err = read(f, &section.Source, &section.DataPointCount, &section.PointCountOctets, &section.PointCountInterpretation, &section.TemplateNumber)
 	if err != nil {
@@ -395,9 +719,54 @@ func ReadSection3(f io.Reader, _ int) (section Section3, err error) {
 
 	//
 	section.Definition, err = ReadGrid(f, section.TemplateNumber)
+	if err != nil || section.PointCountOctets == 0 {
+		return section, err
+	}
+
+	section.PointCounts, err = readPointCounts(f, length-9-binary.Size(section.Definition), section)
 	return section, err
 }
 
+// readPointCounts reads the list of numbers of points of a quasi-regular grid from the last length octets of
+// section 3. There is a number for each row of the grid, or for each column if the points of a column are
+// consecutive (bit 3 of the scanning mode), on section.PointCountOctets octets.
+func readPointCounts(f io.Reader, length int, section Section3) ([]uint32, error) {
+	octets := int(section.PointCountOctets)
+	rows := length / octets
+	switch grid := section.Definition.(type) {
+	case *Grid0:
+		rows = int(grid.Nj)
+		if grid.ScanningMode&0x20 != 0 {
+			rows = int(grid.Ni)
+		}
+	case *Grid40:
+		rows = int(grid.Nj)
+		if grid.ScanningMode&0x20 != 0 {
+			rows = int(grid.Ni)
+		}
+	}
+	if octets > 4 || rows <= 0 || rows > length/octets {
+		return nil, fmt.Errorf("%w: %d numbers of points of %d octets in %d octets", ErrCorruptData, rows, octets, length)
+	}
+
+	raw := make([]byte, rows*octets)
+	if _, err := io.ReadFull(f, raw); err != nil {
+		return nil, err
+	}
+	counts := make([]uint32, rows)
+	var total uint64
+	for i := range counts {
+		for _, octet := range raw[i*octets : (i+1)*octets] {
+			counts[i] = counts[i]<<8 | uint32(octet)
+		}
+		total += uint64(counts[i])
+	}
+	if total != uint64(section.DataPointCount) {
+		return nil, fmt.Errorf("%w: rows of %d points in total, the grid has %d points", ErrCorruptData, total, section.DataPointCount)
+	}
+	return counts, nil
+}
+
 // Section4 is the Product Definition Section http://www.nco.ncep.noaa.gov/pmb/docs/grib2/grib2_doc/grib2_sect4.shtml
 //    | Octet Number | Content
 //    -----------------------------------------------------------------------------------------
@@ -422,7 +791,8 @@ func ReadSection3(f io.Reader, _ int) (section Section3, err error) {
 type Section4 struct {
 	CoordinatesCount                uint16   `json:"coordinatesCount"`
 	ProductDefinitionTemplateNumber uint16   `json:"productDefinitionTemplateNumber"`
-	ProductDefinitionTemplate       Product0 `json:"productDefinitionTemplate"` // FIXME, support more products
+	ProductDefinitionTemplate       Product0 `json:"productDefinitionTemplate"` // the header shared by all products, see Product
+	Product                         Product  `json:"product"`                   // nil if the template is not supported
 	Coordinates                     []byte   `json:"coordinates"`
 }
 
@@ -434,8 +804,8 @@ func ReadSection4(f io.Reader, length int) (section Section4, err error) {
 	}
 
 	switch section.ProductDefinitionTemplateNumber {
-	case 0:
-		err = read(f, &section.ProductDefinitionTemplate)
+	case 0, 1, 2, 5, 6, 7, 8, 11, 12:
+		section.Product, err = ReadProduct(f, section.ProductDefinitionTemplateNumber)
 	default:
 		//return section, fmt.Errorf("Category definition template number %d not implemented yet", section.ProductDefinitionTemplateNumber)
 		return section, nil
@@ -444,12 +814,67 @@ func ReadSection4(f io.Reader, length int) (section Section4, err error) {
 	if err != nil {
 		return section, err
 	}
+	section.ProductDefinitionTemplate = section.Product.Header()
 
 	section.Coordinates = make([]byte, section.CoordinatesCount)
 
 	return section, read(f, &section.Coordinates)
 }
 
+// section4JSON is the json form of Section4, see Section4.MarshalJSON
+type section4JSON struct {
+	CoordinatesCount                uint16          `json:"coordinatesCount"`
+	ProductDefinitionTemplateNumber uint16          `json:"productDefinitionTemplateNumber"`
+	ProductDefinitionTemplate       json.RawMessage `json:"productDefinitionTemplate"`
+	Coordinates                     []byte          `json:"coordinates"`
+}
+
+// MarshalJSON writes the product once, as productDefinitionTemplate: all the fields of Product if the template
+// is supported, the header otherwise.
+func (section Section4) MarshalJSON() ([]byte, error) {
+	var product interface{} = section.ProductDefinitionTemplate
+	if section.Product != nil {
+		product = section.Product
+	}
+	template, err := json.Marshal(product)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(section4JSON{
+		CoordinatesCount:                section.CoordinatesCount,
+		ProductDefinitionTemplateNumber: section.ProductDefinitionTemplateNumber,
+		ProductDefinitionTemplate:       template,
+		Coordinates:                     section.Coordinates,
+	})
+}
+
+// UnmarshalJSON reads the json written by MarshalJSON, productDefinitionTemplate is read as the product of
+// the template number into Product and ProductDefinitionTemplate.
+func (section *Section4) UnmarshalJSON(data []byte) error {
+	var raw section4JSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*section = Section4{
+		CoordinatesCount:                raw.CoordinatesCount,
+		ProductDefinitionTemplateNumber: raw.ProductDefinitionTemplateNumber,
+		Coordinates:                     raw.Coordinates,
+	}
+	if raw.ProductDefinitionTemplate == nil {
+		return nil
+	}
+	product := newProduct(raw.ProductDefinitionTemplateNumber)
+	if product == nil {
+		return json.Unmarshal(raw.ProductDefinitionTemplate, &section.ProductDefinitionTemplate)
+	}
+	if err := json.Unmarshal(raw.ProductDefinitionTemplate, product); err != nil {
+		return err
+	}
+	section.Product = reflect.ValueOf(product).Elem().Interface().(Product)
+	section.ProductDefinitionTemplate = section.Product.Header()
+	return nil
+}
+
 // Section5 is Data Representation section http://www.nco.ncep.noaa.gov/pmb/docs/grib2/grib2_doc/grib2_sect5.shtml
 //    | Octet Number | Content
 //    -----------------------------------------------------------------------------------------
@@ -476,8 +901,10 @@ func ReadSection5(f io.Reader, length int) (section Section5, err error) {
 		return section, err
 	}
 
-	if section.DataTemplateNumber != 0 && section.DataTemplateNumber != 2 && section.DataTemplateNumber != 3 {
-		return section, fmt.Errorf("Template number not supported: %d", section.DataTemplateNumber)
+	switch section.DataTemplateNumber {
+	case 0, 2, 3, 4, 40, 41, 42:
+	default:
+		return section, ErrUnsupportedTemplate{Section: 5, Number: int(section.DataTemplateNumber)}
 	}
 
 	return section, nil
@@ -489,19 +916,44 @@ func (section Section5) GetDataTemplate() (interface{}, error) {
 
 	case 0:
 		data := Data0{}
-		read(bytes.NewReader(section.Data), &data)
+		readDataTemplate(section.Data, &data)
 		return data, nil
 	case 2:
 		data := Data2{}
-		read(bytes.NewReader(section.Data), &data)
+		readDataTemplate(section.Data, &data)
 		return data, nil
 	case 3:
 		data := Data3{}
-		read(bytes.NewReader(section.Data), &data)
+		readDataTemplate(section.Data, &data)
+		return data, nil
+	case 4:
+		data := Data4{}
+		readDataTemplate(section.Data, &data)
+		return data, nil
+	case 40:
+		data := Data40{}
+		readDataTemplate(section.Data, &data)
+		return data, nil
+	case 41:
+		data := Data41{}
+		readDataTemplate(section.Data, &data)
+		return data, nil
+	case 42:
+		data := Data42{}
+		readDataTemplate(section.Data, &data)
 		return data, nil
 	}
 
-	return struct{}{}, fmt.Errorf("Unknown data format")
+	return struct{}{}, ErrUnsupportedTemplate{Section: 5, Number: int(section.DataTemplateNumber)}
+}
+
+// readDataTemplate reads the data representation template pointed to by template from data. The signed scale
+// factors of the templates embedding Data0 are decoded, see Data0.
+func readDataTemplate(data []byte, template interface{}) {
+	read(bytes.NewReader(data), template)
+	if withHeader, ok := template.(interface{ header() *Data0 }); ok {
+		withHeader.header().decodeScales()
+	}
 }
 
 // Section6 is the Bit-Map section http://www.nco.ncep.noaa.gov/pmb/docs/grib2/grib2_doc/grib2_sect6.shtml
@@ -517,6 +969,15 @@ type Section6 struct {
 	Bitmap          []byte `json:"bitmap"`
 }
 
+const (
+	// BitmapApplies means that the bitmap in section 6 applies to the data in section 7 (Table 6.0)
+	BitmapApplies = 0
+	// BitmapPreviouslyDefined means that the last bitmap defined in the same file applies to the data in section 7 (Table 6.0)
+	BitmapPreviouslyDefined = 254
+	// BitmapNone means that no bitmap applies, every grid point has a value in section 7 (Table 6.0)
+	BitmapNone = 255
+)
+
 //ReadSection6 is poorly documented other than code
 func ReadSection6(f io.Reader, length int) (section Section6, err error) {
 	section.Bitmap = make([]byte, length-1)
@@ -524,6 +985,84 @@ func ReadSection6(f io.Reader, length int) (section Section6, err error) {
 	return section, read(f, &section.BitmapIndicator, &section.Bitmap)
 }
 
+// valueCount returns the number of the pointCount points of the grid that have a value in section 7, the points
+// set in the bitmap or all points if no bitmap applies
+func (section Section6) valueCount(pointCount int) (int, error) {
+	switch section.BitmapIndicator {
+	case BitmapNone:
+		return pointCount, nil
+	case BitmapApplies, BitmapPreviouslyDefined:
+	default:
+		return 0, fmt.Errorf("Predefined bitmap %d not supported", section.BitmapIndicator)
+	}
+	if len(section.Bitmap)*8 < pointCount {
+		return 0, fmt.Errorf("Bitmap has %d bits, grid has %d points", len(section.Bitmap)*8, pointCount)
+	}
+	count := 0
+	for _, octet := range section.Bitmap[:pointCount/8] {
+		count += bits.OnesCount8(octet)
+	}
+	if rest := pointCount % 8; rest != 0 {
+		count += bits.OnesCount8(section.Bitmap[pointCount/8] &^ (0xff >> rest))
+	}
+	return count, nil
+}
+
+// Expand spreads the packed values from section 7 over all pointCount points of the grid.
+// Bit n of the bitmap tells if grid point n has a value in section 7, points without a value
+// are given the value fill. The values are returned unchanged if no bitmap applies.
+func (section Section6) Expand(values []float64, pointCount int, fill float64) ([]float64, error) {
+	switch section.BitmapIndicator {
+	case BitmapNone:
+		return values, nil
+	case BitmapApplies, BitmapPreviouslyDefined:
+	default:
+		return values, fmt.Errorf("Predefined bitmap %d not supported", section.BitmapIndicator)
+	}
+
+	if len(section.Bitmap)*8 < pointCount {
+		return values, fmt.Errorf("Bitmap has %d bits, grid has %d points", len(section.Bitmap)*8, pointCount)
+	}
+
+	expanded := make([]float64, pointCount)
+	next := 0
+	for i := range expanded {
+		if section.Bitmap[i/8]&(0x80>>uint(i%8)) == 0 {
+			expanded[i] = fill
+			continue
+		}
+		if next >= len(values) {
+			return values, fmt.Errorf("Bitmap defines more points than the %d values in section 7", len(values))
+		}
+		expanded[i] = values[next]
+		next++
+	}
+	if next != len(values) {
+		return values, fmt.Errorf("Bitmap defines %d points, section 7 has %d values", next, len(values))
+	}
+
+	return expanded, nil
+}
+
+// expandMissing spreads the missing mask of the values from section 7 over the grid like Expand, the points
+// left out by the bitmap are marked BitmapMissing. The bitmap must match the values, see Expand.
+func (section Section6) expandMissing(missing []uint8, pointCount int) []uint8 {
+	if missing == nil || section.BitmapIndicator == BitmapNone {
+		return missing
+	}
+	expanded := make([]uint8, pointCount)
+	next := 0
+	for i := range expanded {
+		if section.Bitmap[i/8]&(0x80>>uint(i%8)) == 0 {
+			expanded[i] = BitmapMissing
+			continue
+		}
+		expanded[i] = missing[next]
+		next++
+	}
+	return expanded
+}
+
 // Section7 is the Data section http://www.nco.ncep.noaa.gov/pmb/docs/grib2/grib2_doc/grib2_sect7.shtml
 //    | Octet Number | Content
 //    -----------------------------------------------------------------------------------------
@@ -531,18 +1070,29 @@ func ReadSection6(f io.Reader, length int) (section Section6, err error) {
 //    | 5            | Number of the section (7)
 //    | 6-nn         | Data in a format described by data Template 7.X, where X is the data representation template number
 //    |              | given in octets 10-11 of Section 5.
+//
+// Missing tells for each value of Data whether it is missing, it is nil unless the data template manages missing
+// values (Code table 5.5, templates 5.2 and 5.3). Missing values are given the missing value substitute of the
+// template.
 type Section7 struct {
-	Data []float64 `json:"data"`
+	Data    []float64 `json:"data"`
+	Missing []uint8   `json:"missing,omitempty"`
 }
 
-//ReadSection7 reads the actual data
-func ReadSection7(f io.Reader, length int, section5 Section5) (section Section7, sectionError error) {
-	defer func() {
-		if err := recover(); err != nil {
-			log.Printf("Corrupt message %q\n", err)
-		}
-	}()
+// Values of Section7.Missing
+const (
+	// NotMissing means that the value is not missing
+	NotMissing = 0
+	// PrimaryMissing means that the value is the primary missing value (Code table 5.5)
+	PrimaryMissing = 1
+	// SecondaryMissing means that the value is the secondary missing value (Code table 5.5)
+	SecondaryMissing = 2
+	// BitmapMissing means that the grid point is left out by the bitmap of section 6
+	BitmapMissing = 3
+)
 
+//ReadSection7 reads the actual data. Packed data that does not match section5 gives an error matching ErrCorruptData.
+func ReadSection7(f io.Reader, length int, section5 Section5) (section Section7, sectionError error) {
 	data, sectionError := section5.GetDataTemplate()
 
 	if sectionError != nil {
@@ -555,18 +1105,71 @@ func ReadSection7(f io.Reader, length int, section5 Section5) (section Section7,
 		case Data0:
 			section.Data, sectionError = ParseData0(f, length, &x)
 		case Data2:
-			section.Data, sectionError = ParseData2(f, length, &x)
+			section.Data, section.Missing, sectionError = parseData2(f, length, &x, int(section5.PointsNumber))
 		case Data3:
-			section.Data, sectionError = ParseData3(f, length, &x)
+			section.Data, section.Missing, sectionError = parseData3(f, length, &x, int(section5.PointsNumber))
+		case Data4:
+			section.Data, sectionError = ParseData4(f, length, &x)
+		case Data40:
+			section.Data, sectionError = ParseData40(f, length, &x)
+		case Data41:
+			section.Data, sectionError = ParseData41(f, length, &x)
+		case Data42:
+			section.Data, sectionError = ParseData42(f, length, &x, int(section5.PointsNumber))
 		default:
-			sectionError = fmt.Errorf("Unknown data type")
+			sectionError = ErrUnsupportedTemplate{Section: 5, Number: int(section5.DataTemplateNumber)}
 			return
 		}
 	}
 
+	// a constant field is sent without coded values, all values equal the reference value
+	var header *Data0
+	switch x := data.(type) {
+	case Data0:
+		header = &x
+	case Data40:
+		header = &x.Data0
+	case Data41:
+		header = &x.Data0
+	case Data42:
+		header = &x.Data0
+	}
+	if header != nil && header.Bits == 0 && sectionError == nil {
+		ref, _ := header.getRefScale()
+		section.Data = make([]float64, section5.PointsNumber)
+		for i := range section.Data {
+			section.Data[i] = ref
+		}
+	}
+
+	// simple packing pads the last octet, do not return the padding as values
+	if len(section.Data) > int(section5.PointsNumber) {
+		section.Data = section.Data[:section5.PointsNumber]
+	}
+
 	return section, sectionError
 }
 
+// MarshalJSON writes missing values (NaN) as null, since json has no representation of NaN, and the missing mask
+// as a list of numbers
+func (section Section7) MarshalJSON() ([]byte, error) {
+	data := make([]interface{}, len(section.Data))
+	for i, value := range section.Data {
+		if !math.IsNaN(value) {
+			data[i] = value
+		}
+	}
+	// the missing mask is written as numbers rather than base64, like a []uint8
+	var missing []int
+	for _, value := range section.Missing {
+		missing = append(missing, int(value))
+	}
+	return json.Marshal(struct {
+		Data    []interface{} `json:"data"`
+		Missing []int         `json:"missing,omitempty"`
+	}{data, missing})
+}
+
 //read bytes from reader and serialize the bytes into the given data .. pointers
 func read(reader io.Reader, data ...interface{}) (err error) {
 	for _, what := range data {
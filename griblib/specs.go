@@ -1,6 +1,9 @@
 package griblib
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // translated from https://github.com/ArtemisiaSolutions/grib2js/blob/master/lib/grib/Grib2Spec.js
 
@@ -2935,6 +2938,1072 @@ func ReadProductDisciplineCategoryParameters(discipline uint16, category uint8,
 	}
 }
 
+//ReadParameterAbbreviation  Abbreviation of a parameter as used by NCEP, e.g. TMP for temperature (code table 4.2).
+//Parameters without an abbreviation are named var<discipline>_<category>_<number>.
+func ReadParameterAbbreviation(discipline uint8, category uint8, number uint8) string {
+	switch discipline {
+	//Discipline 0: Meteorological products
+	case 0:
+		switch category {
+		//Category 0: Temperature
+		case 0:
+			switch number {
+			case 0:
+				return "TMP"
+			case 1:
+				return "VTMP"
+			case 2:
+				return "POT"
+			case 3:
+				return "EPOT"
+			case 4:
+				return "TMAX"
+			case 5:
+				return "TMIN"
+			case 6:
+				return "DPT"
+			case 7:
+				return "DEPR"
+			case 8:
+				return "LAPR"
+			case 9:
+				return "TMPA"
+			case 10:
+				return "LHTFL"
+			case 11:
+				return "SHTFL"
+			case 12:
+				return "HEATX"
+			case 13:
+				return "WCF"
+			case 14:
+				return "MINDPD"
+			case 15:
+				return "VPTMP"
+			case 16:
+				return "SNOHF"
+			case 17:
+				return "SKINT"
+			case 18:
+				return "SNOT"
+			case 19:
+				return "TTCHT"
+			case 20:
+				return "TDCHT"
+			case 21:
+				return "APTMP"
+			case 192:
+				return "SNOHF"
+			case 193:
+				return "TTRAD"
+			case 194:
+				return "REV"
+			case 195:
+				return "LRGHR"
+			case 196:
+				return "CNVHR"
+			case 197:
+				return "THFLX"
+			case 198:
+				return "TTDIA"
+			case 199:
+				return "TTPHY"
+			case 200:
+				return "TSD1D"
+			case 201:
+				return "SHAHR"
+			case 202:
+				return "VDFHR"
+			case 203:
+				return "THZ0"
+			case 204:
+				return "TCHP"
+			}
+		//Category 1: Moisture
+		case 1:
+			switch number {
+			case 0:
+				return "SPFH"
+			case 1:
+				return "RH"
+			case 2:
+				return "MIXR"
+			case 3:
+				return "PWAT"
+			case 4:
+				return "VAPP"
+			case 5:
+				return "SATD"
+			case 6:
+				return "EVP"
+			case 7:
+				return "PRATE"
+			case 8:
+				return "APCP"
+			case 9:
+				return "NCPCP"
+			case 10:
+				return "ACPCP"
+			case 11:
+				return "SNOD"
+			case 12:
+				return "SRWEQ"
+			case 13:
+				return "WEASD"
+			case 14:
+				return "SNOC"
+			case 15:
+				return "SNOL"
+			case 16:
+				return "SNOM"
+			case 17:
+				return "SNOAG"
+			case 18:
+				return "ABSH"
+			case 19:
+				return "PTYPE"
+			case 20:
+				return "ILIQW"
+			case 21:
+				return "TCOND"
+			case 22:
+				return "CLWMR"
+			case 23:
+				return "ICMR"
+			case 24:
+				return "RWMR"
+			case 25:
+				return "SNMR"
+			case 26:
+				return "MCONV"
+			case 27:
+				return "MAXRH"
+			case 28:
+				return "MAXAH"
+			case 29:
+				return "ASNOW"
+			case 30:
+				return "PWCAT"
+			case 31:
+				return "HAIL"
+			case 32:
+				return "GRLE"
+			case 33:
+				return "CRAIN"
+			case 34:
+				return "CFRZR"
+			case 35:
+				return "CICEP"
+			case 36:
+				return "CSNOW"
+			case 37:
+				return "CPRAT"
+			case 39:
+				return "CPOFP"
+			case 192:
+				return "CRAIN"
+			case 193:
+				return "CFRZR"
+			case 194:
+				return "CICEP"
+			case 195:
+				return "CSNOW"
+			case 196:
+				return "CPRAT"
+			case 197:
+				return "MCONV"
+			case 199:
+				return "PEVAP"
+			case 200:
+				return "PEVPR"
+			case 201:
+				return "SNOWC"
+			case 202:
+				return "FRAIN"
+			case 203:
+				return "RIME"
+			case 204:
+				return "TCOLR"
+			case 205:
+				return "TCOLS"
+			case 207:
+				return "NCIP"
+			case 208:
+				return "SNOT"
+			case 209:
+				return "TCLSW"
+			case 210:
+				return "TCOLM"
+			case 211:
+				return "EMNP"
+			case 212:
+				return "SBSNO"
+			case 213:
+				return "CNVMR"
+			case 214:
+				return "SHAMR"
+			case 215:
+				return "VDFMR"
+			case 216:
+				return "CONDP"
+			case 217:
+				return "LRGMR"
+			case 218:
+				return "QZ0"
+			case 219:
+				return "QMAX"
+			case 220:
+				return "QMIN"
+			case 221:
+				return "ARAIN"
+			case 222:
+				return "SNOWT"
+			case 223:
+				return "APCPN"
+			case 224:
+				return "ACPCPN"
+			case 225:
+				return "FRZR"
+			case 226:
+				return "PWTHER"
+			case 227:
+				return "FROZR"
+			case 241:
+				return "TSNOW"
+			}
+		//Category 2: Momentum
+		case 2:
+			switch number {
+			case 0:
+				return "WDIR"
+			case 1:
+				return "WIND"
+			case 2:
+				return "UGRD"
+			case 3:
+				return "VGRD"
+			case 4:
+				return "STRM"
+			case 5:
+				return "VPOT"
+			case 6:
+				return "MNTSF"
+			case 7:
+				return "SGCVV"
+			case 8:
+				return "VVEL"
+			case 9:
+				return "DZDT"
+			case 10:
+				return "ABSV"
+			case 11:
+				return "ABSD"
+			case 12:
+				return "RELV"
+			case 13:
+				return "RELD"
+			case 14:
+				return "PVORT"
+			case 15:
+				return "VUCSH"
+			case 16:
+				return "VVCSH"
+			case 17:
+				return "UFLX"
+			case 18:
+				return "VFLX"
+			case 19:
+				return "WMIXE"
+			case 20:
+				return "BLYDP"
+			case 21:
+				return "MAXGUST"
+			case 22:
+				return "GUST"
+			case 23:
+				return "UGUST"
+			case 24:
+				return "VGUST"
+			case 25:
+				return "VWSH"
+			case 26:
+				return "MFLX"
+			case 27:
+				return "USTM"
+			case 28:
+				return "VSTM"
+			case 29:
+				return "CD"
+			case 30:
+				return "FRICV"
+			case 192:
+				return "VWSH"
+			case 193:
+				return "MFLX"
+			case 194:
+				return "USTM"
+			case 195:
+				return "VSTM"
+			case 196:
+				return "CD"
+			case 197:
+				return "FRICV"
+			case 198:
+				return "LAUV"
+			case 199:
+				return "LOUV"
+			case 200:
+				return "LAVV"
+			case 201:
+				return "LOVV"
+			case 202:
+				return "LAPP"
+			case 203:
+				return "LOPP"
+			case 204:
+				return "VEDH"
+			case 205:
+				return "COVMZ"
+			case 206:
+				return "COVTZ"
+			case 207:
+				return "COVTM"
+			case 208:
+				return "VDFUA"
+			case 209:
+				return "VDFVA"
+			case 210:
+				return "GWDU"
+			case 211:
+				return "GWDV"
+			case 212:
+				return "CNVU"
+			case 213:
+				return "CNVV"
+			case 214:
+				return "WTEND"
+			case 215:
+				return "OMGALF"
+			case 216:
+				return "CNGWDU"
+			case 217:
+				return "CNGWDV"
+			case 218:
+				return "LMV"
+			case 219:
+				return "PVMWW"
+			case 220:
+				return "MAXUVV"
+			case 221:
+				return "MAXDVV"
+			case 222:
+				return "MAXUW"
+			case 223:
+				return "MAXVW"
+			case 224:
+				return "VRATE"
+			}
+		//Category 3: Mass
+		case 3:
+			switch number {
+			case 0:
+				return "PRES"
+			case 1:
+				return "PRMSL"
+			case 2:
+				return "PTEND"
+			case 3:
+				return "ICAHT"
+			case 4:
+				return "GP"
+			case 5:
+				return "HGT"
+			case 6:
+				return "DIST"
+			case 7:
+				return "HSTDV"
+			case 8:
+				return "PRESA"
+			case 9:
+				return "GPA"
+			case 10:
+				return "DEN"
+			case 11:
+				return "ALTS"
+			case 12:
+				return "THICK"
+			case 13:
+				return "PRESALT"
+			case 14:
+				return "DENALT"
+			case 15:
+				return "5WAVH"
+			case 16:
+				return "U-GWD"
+			case 17:
+				return "V-GWD"
+			case 18:
+				return "HPBL"
+			case 19:
+				return "5WAVA"
+			case 20:
+				return "SDSGSO"
+			case 21:
+				return "AOSGSO"
+			case 22:
+				return "SSGSO"
+			case 192:
+				return "MSLET"
+			case 193:
+				return "5WAVH"
+			case 194:
+				return "U-GWD"
+			case 195:
+				return "V-GWD"
+			case 196:
+				return "HPBL"
+			case 197:
+				return "5WAVA"
+			case 198:
+				return "MSLMA"
+			case 199:
+				return "TSLSA"
+			case 200:
+				return "PLPL"
+			case 201:
+				return "LPSX"
+			case 202:
+				return "LPSY"
+			case 203:
+				return "HGTX"
+			case 204:
+				return "HGTY"
+			case 205:
+				return "LAYTH"
+			case 206:
+				return "NLGSP"
+			case 207:
+				return "CNVUMF"
+			case 208:
+				return "CNVDMF"
+			case 209:
+				return "CNVDEMF"
+			case 210:
+				return "LMH"
+			case 211:
+				return "HGTN"
+			case 212:
+				return "PRESN"
+			}
+		//Category 4: Short-wave radiation
+		case 4:
+			switch number {
+			case 0:
+				return "NSWRS"
+			case 1:
+				return "NSWRT"
+			case 2:
+				return "SWAVR"
+			case 3:
+				return "GRAD"
+			case 4:
+				return "BRTMP"
+			case 5:
+				return "LWRAD"
+			case 6:
+				return "SWRAD"
+			case 7:
+				return "DSWRF"
+			case 8:
+				return "USWRF"
+			case 9:
+				return "NSWRF"
+			case 10:
+				return "PHOTAR"
+			case 11:
+				return "NSWRFCS"
+			case 12:
+				return "DWUVR"
+			case 192:
+				return "DSWRF"
+			case 193:
+				return "USWRF"
+			case 194:
+				return "DUVB"
+			case 195:
+				return "CDUVB"
+			case 196:
+				return "CSDSF"
+			case 197:
+				return "SWHR"
+			case 198:
+				return "CSUSF"
+			case 199:
+				return "CFNSF"
+			case 200:
+				return "VBDSF"
+			case 201:
+				return "VDDSF"
+			case 202:
+				return "NBDSF"
+			case 203:
+				return "NDDSF"
+			case 204:
+				return "DTRF"
+			case 205:
+				return "UTRF"
+			}
+		//Category 5: Long-wave radiation
+		case 5:
+			switch number {
+			case 0:
+				return "NLWRS"
+			case 1:
+				return "NLWRT"
+			case 2:
+				return "LWAVR"
+			case 3:
+				return "DLWRF"
+			case 4:
+				return "ULWRF"
+			case 5:
+				return "NLWRF"
+			case 6:
+				return "NLWRCS"
+			case 192:
+				return "DLWRF"
+			case 193:
+				return "ULWRF"
+			case 194:
+				return "LWHR"
+			case 195:
+				return "CSULF"
+			case 196:
+				return "CSDLF"
+			case 197:
+				return "CFNLF"
+			}
+		//Category 6: Cloud
+		case 6:
+			switch number {
+			case 0:
+				return "CICE"
+			case 1:
+				return "TCDC"
+			case 2:
+				return "CDCON"
+			case 3:
+				return "LCDC"
+			case 4:
+				return "MCDC"
+			case 5:
+				return "HCDC"
+			case 6:
+				return "CWAT"
+			case 7:
+				return "CDCA"
+			case 8:
+				return "CDCT"
+			case 9:
+				return "TMAXT"
+			case 10:
+				return "THUNC"
+			case 11:
+				return "CDCB"
+			case 12:
+				return "CDCTOP"
+			case 13:
+				return "CEIL"
+			case 14:
+				return "CDLYR"
+			case 15:
+				return "CWORK"
+			case 16:
+				return "CUEFI"
+			case 17:
+				return "TCOND"
+			case 18:
+				return "TCOLW"
+			case 19:
+				return "TCOLI"
+			case 20:
+				return "TCOLC"
+			case 21:
+				return "FICE"
+			case 192:
+				return "CDLYR"
+			case 193:
+				return "CWORK"
+			case 194:
+				return "CUEFI"
+			case 195:
+				return "TCOND"
+			case 196:
+				return "TCOLW"
+			case 197:
+				return "TCOLI"
+			case 198:
+				return "TCOLC"
+			case 199:
+				return "FICE"
+			case 200:
+				return "MFLUX"
+			case 201:
+				return "SUNSD"
+			}
+		//Category 7: Thermodynamic stability indices
+		case 7:
+			switch number {
+			case 0:
+				return "PLI"
+			case 1:
+				return "BLI"
+			case 2:
+				return "KX"
+			case 3:
+				return "KOX"
+			case 4:
+				return "TOTALX"
+			case 5:
+				return "SX"
+			case 6:
+				return "CAPE"
+			case 7:
+				return "CIN"
+			case 8:
+				return "HLCY"
+			case 9:
+				return "EHLX"
+			case 10:
+				return "LFTX"
+			case 11:
+				return "4LFTX"
+			case 12:
+				return "RI"
+			case 192:
+				return "LFTX"
+			case 193:
+				return "4LFTX"
+			case 194:
+				return "RI"
+			case 195:
+				return "CWDI"
+			case 196:
+				return "UVI"
+			case 197:
+				return "UPHL"
+			case 198:
+				return "LAI"
+			}
+		//Category 14: Trace gases
+		case 14:
+			switch number {
+			case 0:
+				return "TOZNE"
+			case 1:
+				return "O3MR"
+			case 2:
+				return "TCIOZ"
+			case 192:
+				return "O3MR"
+			case 193:
+				return "OZCON"
+			case 194:
+				return "OZCAT"
+			case 195:
+				return "VDFOZ"
+			case 196:
+				return "POZ"
+			case 197:
+				return "TOZ"
+			case 198:
+				return "POZT"
+			case 199:
+				return "POZO"
+			}
+		//Category 15: Radar
+		case 15:
+			switch number {
+			case 0:
+				return "BSWID"
+			case 1:
+				return "BREF"
+			case 2:
+				return "BRVEL"
+			case 3:
+				return "VIL"
+			}
+		//Category 16: Forecast radar imagery
+		case 16:
+			switch number {
+			case 0:
+				return "REFZR"
+			case 1:
+				return "REFZI"
+			case 2:
+				return "REFZC"
+			case 3:
+				return "RETOP"
+			case 4:
+				return "REFD"
+			case 5:
+				return "REFC"
+			case 192:
+				return "REFZR"
+			case 193:
+				return "REFZI"
+			case 194:
+				return "REFZC"
+			case 195:
+				return "REFD"
+			case 196:
+				return "REFC"
+			case 197:
+				return "RETOP"
+			}
+		//Category 19: Physical atmospheric properties
+		case 19:
+			switch number {
+			case 0:
+				return "VIS"
+			case 1:
+				return "ALBDO"
+			case 2:
+				return "TSTM"
+			case 3:
+				return "MIXHT"
+			case 4:
+				return "VOLASH"
+			case 5:
+				return "ICIT"
+			case 6:
+				return "ICIB"
+			case 7:
+				return "ICI"
+			case 8:
+				return "TURBT"
+			case 9:
+				return "TURBB"
+			case 10:
+				return "TURB"
+			case 11:
+				return "TKE"
+			case 12:
+				return "PBLREG"
+			case 13:
+				return "CONTI"
+			case 14:
+				return "CONTET"
+			case 15:
+				return "CONTT"
+			case 16:
+				return "CONTB"
+			case 17:
+				return "MXSALB"
+			case 18:
+				return "SNFALB"
+			case 192:
+				return "MXSALB"
+			case 193:
+				return "SNFALB"
+			}
+		}
+	//Discipline 2: Land surface products
+	case 2:
+		switch category {
+		//Category 0: Vegetation/Biomass
+		case 0:
+			switch number {
+			case 0:
+				return "LAND"
+			case 1:
+				return "SFCR"
+			case 2:
+				return "TSOIL"
+			case 3:
+				return "SOILM"
+			case 4:
+				return "VEG"
+			case 5:
+				return "WATR"
+			case 6:
+				return "EVAPT"
+			case 7:
+				return "MTERH"
+			case 8:
+				return "LANDU"
+			case 9:
+				return "SOILW"
+			case 10:
+				return "GFLUX"
+			case 11:
+				return "MSTAV"
+			case 12:
+				return "SFEXC"
+			case 13:
+				return "CNWAT"
+			case 14:
+				return "BMIXL"
+			case 15:
+				return "CCOND"
+			case 16:
+				return "RSMIN"
+			case 17:
+				return "RCS"
+			case 18:
+				return "RCT"
+			case 19:
+				return "RCSOL"
+			case 20:
+				return "RCQ"
+			case 192:
+				return "SOILW"
+			case 193:
+				return "GFLUX"
+			case 194:
+				return "MSTAV"
+			case 195:
+				return "SFEXC"
+			case 196:
+				return "CNWAT"
+			case 197:
+				return "BMIXL"
+			case 198:
+				return "VGTYP"
+			case 199:
+				return "CCOND"
+			case 200:
+				return "RSMIN"
+			case 201:
+				return "WILT"
+			case 202:
+				return "RCS"
+			case 203:
+				return "RCT"
+			case 204:
+				return "RCQ"
+			case 205:
+				return "RCSOL"
+			case 206:
+				return "RDRIP"
+			case 207:
+				return "ICWAT"
+			case 208:
+				return "AKHS"
+			case 209:
+				return "AKMS"
+			case 210:
+				return "VEGT"
+			case 211:
+				return "SSTOR"
+			case 212:
+				return "LSOIL"
+			case 213:
+				return "EWATR"
+			case 214:
+				return "GWREC"
+			case 215:
+				return "QREC"
+			case 216:
+				return "SFCRH"
+			case 217:
+				return "NDVI"
+			case 218:
+				return "LANDN"
+			case 219:
+				return "AMIXL"
+			case 220:
+				return "WVINC"
+			case 221:
+				return "WCINC"
+			case 222:
+				return "WVCONV"
+			case 223:
+				return "WCCONV"
+			case 224:
+				return "WVUFLX"
+			case 225:
+				return "WVVFLX"
+			case 226:
+				return "WCUFLX"
+			case 227:
+				return "WCVFLX"
+			case 228:
+				return "ACOND"
+			case 229:
+				return "EVCW"
+			case 230:
+				return "TRANS"
+			}
+		//Category 3: Soil
+		case 3:
+			switch number {
+			case 0:
+				return "SOTYP"
+			case 1:
+				return "UPLST"
+			case 2:
+				return "LOWLST"
+			case 3:
+				return "UPLSM"
+			case 4:
+				return "LOWLSM"
+			case 5:
+				return "BOTLST"
+			case 6:
+				return "SOILL"
+			case 7:
+				return "RLYRS"
+			case 8:
+				return "SMREF"
+			case 9:
+				return "SMDRY"
+			case 10:
+				return "POROS"
+			case 11:
+				return "LIQVSM"
+			case 12:
+				return "VOLTSO"
+			case 13:
+				return "TRANSO"
+			case 14:
+				return "VOLEVO"
+			case 15:
+				return "VOLDEC"
+			case 16:
+				return "VOLTD"
+			case 192:
+				return "SOILL"
+			case 193:
+				return "RLYRS"
+			case 194:
+				return "SLTYP"
+			case 195:
+				return "SMREF"
+			case 196:
+				return "SMDRY"
+			case 197:
+				return "POROS"
+			case 198:
+				return "EVBS"
+			case 199:
+				return "LSPA"
+			case 200:
+				return "BARET"
+			case 201:
+				return "AVSFT"
+			case 202:
+				return "RADT"
+			case 203:
+				return "FLDCP"
+			}
+		//Category 4: Fire weather
+		case 4:
+			switch number {
+			case 0:
+				return "FIREOLK"
+			case 1:
+				return "FIREODT"
+			case 2:
+				return "HINDEX"
+			}
+		}
+	//Discipline 10: Oceanographic products
+	case 10:
+		switch category {
+		//Category 0: Waves
+		case 0:
+			switch number {
+			case 0:
+				return "WVSP1"
+			case 1:
+				return "WVSP2"
+			case 2:
+				return "WVSP3"
+			case 3:
+				return "HTSGW"
+			case 4:
+				return "WVDIR"
+			case 5:
+				return "WVHGT"
+			case 6:
+				return "WVPER"
+			case 7:
+				return "SWDIR"
+			case 8:
+				return "SWELL"
+			case 9:
+				return "SWPER"
+			case 10:
+				return "DIRPW"
+			case 11:
+				return "PERPW"
+			case 12:
+				return "DIRSW"
+			case 13:
+				return "PERSW"
+			case 14:
+				return "WWSDIR"
+			case 15:
+				return "MWSPER"
+			}
+		//Category 1: Currents
+		case 1:
+			switch number {
+			case 0:
+				return "DIRC"
+			case 1:
+				return "SPC"
+			case 2:
+				return "UOGRD"
+			case 3:
+				return "VOGRD"
+			}
+		//Category 2: Ice
+		case 2:
+			switch number {
+			case 0:
+				return "ICEC"
+			case 1:
+				return "ICETK"
+			case 2:
+				return "DICED"
+			case 3:
+				return "SICED"
+			case 4:
+				return "UICE"
+			case 5:
+				return "VICE"
+			case 6:
+				return "ICEG"
+			case 7:
+				return "ICED"
+			}
+		//Category 3: Surface properties
+		case 3:
+			switch number {
+			case 0:
+				return "WTMP"
+			case 1:
+				return "DSLM"
+			}
+		//Category 4: Sub-surface properties
+		case 4:
+			switch number {
+			case 0:
+				return "MTHD"
+			case 1:
+				return "MTHA"
+			case 2:
+				return "TTHDP"
+			case 3:
+				return "SALTY"
+			}
+		}
+	}
+	return fmt.Sprintf("var%d_%d_%d", discipline, category, number)
+}
+
 //ReadGeneratingProcessType  Type of generating process (code table 4.3)
 func ReadGeneratingProcessType(value int) string {
 	switch value {
@@ -3173,6 +4242,57 @@ func ReadSurfaceTypesUnits(value int) string {
 	}
 }
 
+//ReadSurfaceLevelName  Short name of a fixed surface type as used in NOAA inventories (code table 4.5). For surfaces
+//with a value, it is the unit and name that follow the value, e.g. "m above ground" in "2 m above ground".
+func ReadSurfaceLevelName(value int) string {
+	switch value {
+	case 1:
+		return "surface"
+	case 2:
+		return "cloud base"
+	case 3:
+		return "cloud top"
+	case 4:
+		return "0C isotherm"
+	case 6:
+		return "max wind"
+	case 7:
+		return "tropopause"
+	case 8:
+		return "top of atmosphere"
+	case 9:
+		return "sea bottom"
+	case 10:
+		return "entire atmosphere"
+	case 20:
+		return "K level"
+	case 100:
+		return "mb"
+	case 101:
+		return "mean sea level"
+	case 102:
+		return "m above mean sea level"
+	case 103:
+		return "m above ground"
+	case 104:
+		return "sigma level"
+	case 105:
+		return "hybrid level"
+	case 106:
+		return "m below ground"
+	case 107:
+		return "K isentropic level"
+	case 108:
+		return "mb above ground"
+	case 109:
+		return "(Km^2/kg/s) surface"
+	case 160:
+		return "m below sea level"
+	default:
+		return strings.ToLower(ReadSurfaceTypesUnits(value))
+	}
+}
+
 //ReadEnsembleForecastType  Type of ensemble forecast (code table 4.6)
 func ReadEnsembleForecastType(value int) string {
 	switch value {
@@ -0,0 +1,364 @@
+package griblib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+
+	"github.com/nilsmagnus/grib/internal/writer"
+)
+
+//WriteOptions controls how WriteMessageWithOptions packs the data of section 7
+type WriteOptions struct {
+	// DecimalScale is the number of decimals kept of each value, the decimal scale factor D. A negative factor
+	// rounds the values to the tens, hundreds...
+	DecimalScale int
+	// BinaryScale is the binary scale factor E, the values are packed in steps of 2^E / 10^D
+	BinaryScale int
+	// Bits is the number of bits of each packed value. With 0, the bits needed for DecimalScale and BinaryScale
+	// are used. Otherwise the values are rounded to the most decimals, at least DecimalScale, for which they fit
+	// in Bits bits, or further with a binary scale factor above BinaryScale.
+	Bits int
+	// DataTemplate is the data representation template used to pack the values: 0 (simple packing),
+	// 2 (complex packing) or 3 (complex packing and spatial differencing)
+	DataTemplate int
+	// SpatialDifferencingOrder is the order of spatial differencing for DataTemplate 3, 1 or 2. 0 means 2.
+	SpatialDifferencingOrder int
+}
+
+//DefaultWriteOptions returns the options used by WriteMessage: the decimal scale factor, binary scale factor and
+//number of bits of the data template in section 5 of message, so that unchanged values keep their precision, or 24
+//bits, the precision of a 32-bit float, if the template has none. Messages packed with complex packing (template 5.2
+//or 5.3) keep their template and the bits needed by the values, other messages use simple packing.
+func DefaultWriteOptions(message *Message) WriteOptions {
+	template, err := message.Section5.GetDataTemplate()
+	if err != nil {
+		return WriteOptions{Bits: 24}
+	}
+	options := WriteOptions{Bits: 24}
+	if header := dataHeader(template); header != nil {
+		options = WriteOptions{DecimalScale: int(header.DecimalScale), BinaryScale: int(header.BinaryScale), Bits: int(header.Bits)}
+	}
+	// the bits of complex packing are those of the group references, the values take the bits they need
+	switch x := template.(type) {
+	case Data2:
+		options.DataTemplate = 2
+		options.Bits = 0
+	case Data3:
+		options.DataTemplate = 3
+		options.SpatialDifferencingOrder = int(x.SpatialOrderDifference)
+		options.Bits = 0
+	}
+	return options
+}
+
+// dataHeader returns the header shared by data templates, nil if the template has none
+func dataHeader(template interface{}) *Data0 {
+	switch x := template.(type) {
+	case Data0:
+		return &x
+	case Data2:
+		return &x.Data0
+	case Data3:
+		return &x.Data0
+	case Data40:
+		return &x.Data0
+	case Data41:
+		return &x.Data0
+	case Data42:
+		return &x.Data0
+	}
+	return nil
+}
+
+// writtenTemplate returns the data template as written in section 5, with the signed scale factors of its header
+// encoded as sign-magnitude integers
+func writtenTemplate(template interface{}) interface{} {
+	switch x := template.(type) {
+	case Data0:
+		x.encodeScales()
+		return x
+	case Data2:
+		x.encodeScales()
+		return x
+	case Data3:
+		x.encodeScales()
+		return x
+	}
+	return template
+}
+
+//WriteMessage writes message as a GRIB2 message, the data is packed as specified by DefaultWriteOptions
+func WriteMessage(w io.Writer, message *Message) error {
+	return WriteMessageWithOptions(w, message, DefaultWriteOptions(message))
+}
+
+//WriteMessageWithOptions writes message as a GRIB2 message with sections 0 to 8. The data is packed as specified
+//by options. Grid points with a NaN value, or missing after Section7.Missing, are left out with a bitmap in
+//section 6.
+func WriteMessageWithOptions(w io.Writer, message *Message, options WriteOptions) error {
+	if err := message.Decode(); err != nil {
+		return err
+	}
+	data := message.Section7.Data
+	if len(data) != int(message.Section3.DataPointCount) {
+		return fmt.Errorf("Message has %d values, the grid has %d points", len(data), message.Section3.DataPointCount)
+	}
+
+	var body bytes.Buffer
+
+	if err := writeSection(&body, 1, message.Section1); err != nil {
+		return err
+	}
+	if len(message.Section2.LocalUse) > 0 {
+		if err := writeSection(&body, 2, message.Section2.LocalUse); err != nil {
+			return err
+		}
+	}
+
+	var section3 bytes.Buffer
+	err := write(&section3, message.Section3.Source, message.Section3.DataPointCount, message.Section3.PointCountOctets,
+		message.Section3.PointCountInterpretation, message.Section3.TemplateNumber)
+	if err == nil {
+		grid, _ := message.Section3.Definition.(Grid)
+		err = WriteGrid(&section3, grid)
+	}
+	if err == nil {
+		err = writePointCounts(&section3, message.Section3)
+	}
+	if err == nil {
+		err = writeSection(&body, 3, section3.Bytes())
+	}
+	if err != nil {
+		return err
+	}
+
+	var section4 bytes.Buffer
+	product := message.Section4.Product
+	if product == nil {
+		if message.Section4.ProductDefinitionTemplateNumber != 0 {
+			return ErrUnsupportedTemplate{Section: 4, Number: int(message.Section4.ProductDefinitionTemplateNumber)}
+		}
+		product = message.Section4.ProductDefinitionTemplate
+	}
+	err = write(&section4, uint16(len(message.Section4.Coordinates)), message.Section4.ProductDefinitionTemplateNumber)
+	if err == nil {
+		err = WriteProduct(&section4, product)
+	}
+	if err == nil {
+		err = write(&section4, message.Section4.Coordinates)
+	}
+	if err == nil {
+		err = writeSection(&body, 4, section4.Bytes())
+	}
+	if err != nil {
+		return err
+	}
+
+	// grid points without value are left out with a bitmap, so are the missing values of the missing mask
+	missing := message.Section7.Missing
+	if len(missing) != len(data) {
+		missing = nil
+	}
+	values := make([]float64, 0, len(data))
+	bitmap := writer.New()
+	for i, value := range data {
+		if math.IsNaN(value) || (missing != nil && missing[i] != NotMissing) {
+			bitmap.WriteUint(0, 1)
+			continue
+		}
+		bitmap.WriteUint(1, 1)
+		values = append(values, value)
+	}
+
+	var template interface{}
+	var packed []byte
+	switch options.DataTemplate {
+	case 0:
+		template, packed, err = PackData0(values, options)
+	case 2:
+		template, packed, err = PackData2(values, options)
+	case 3:
+		template, packed, err = PackData3(values, options, options.SpatialDifferencingOrder)
+	default:
+		err = ErrUnsupportedTemplate{Section: 5, Number: options.DataTemplate}
+	}
+	if err != nil {
+		return err
+	}
+	if err := writeSection(&body, 5, uint32(len(values)), uint16(options.DataTemplate), writtenTemplate(template)); err != nil {
+		return err
+	}
+	if len(values) < len(data) {
+		err = writeSection(&body, 6, uint8(BitmapApplies), bitmap.Bytes())
+	} else {
+		err = writeSection(&body, 6, uint8(BitmapNone))
+	}
+	if err != nil {
+		return err
+	}
+	if err := writeSection(&body, 7, packed); err != nil {
+		return err
+	}
+	body.WriteString("7777")
+
+	section0 := Section0{
+		Indicator:     Grib,
+		Discipline:    message.Section0.Discipline,
+		Edition:       SupportedGribEdition,
+		MessageLength: uint64(16 + body.Len()),
+	}
+	if err := write(w, section0); err != nil {
+		return err
+	}
+	_, err = w.Write(body.Bytes())
+	return err
+}
+
+// writePointCounts writes the list of numbers of points of a quasi-regular grid, the inverse of readPointCounts
+func writePointCounts(w io.Writer, section Section3) error {
+	octets := int(section.PointCountOctets)
+	if octets == 0 {
+		return nil
+	}
+	if octets > 4 || len(section.PointCounts) == 0 {
+		return fmt.Errorf("Can not write %d numbers of points of %d octets", len(section.PointCounts), octets)
+	}
+	list := writer.New()
+	for _, count := range section.PointCounts {
+		if bits.Len32(count) > 8*octets {
+			return fmt.Errorf("Can not write %d points on %d octets", count, octets)
+		}
+		list.WriteUint(uint64(count), 8*octets)
+	}
+	_, err := w.Write(list.Bytes())
+	return err
+}
+
+// writeSection writes a section with its head: the length of the section and its number
+func writeSection(w io.Writer, number uint8, content ...interface{}) error {
+	var section bytes.Buffer
+	if err := write(&section, content...); err != nil {
+		return err
+	}
+	return write(w, uint32(5+section.Len()), number, section.Bytes())
+}
+
+// maxPackedBits is the largest number of bits of a value packed by PackData0
+const maxPackedBits = 63
+
+//PackData0 packs values with simple packing (template 5.0), as specified by options
+func PackData0(values []float64, options WriteOptions) (Data0, []byte, error) {
+	template, integers, err := quantize(values, options)
+	if err != nil {
+		return template, nil, err
+	}
+	packed := writer.New()
+	packed.WriteUintsBlock(integers, int(template.Bits))
+	return template, packed.Bytes(), nil
+}
+
+// quantize scales values to non-negative integers X, with Y * 10^D = R + X * 2^E. The returned header holds
+// R, E, D and the number of bits of the largest X.
+func quantize(values []float64, options WriteOptions) (Data0, []uint64, error) {
+	template := Data0{}
+	// the scale factors are written as sign-magnitude integers of 16 bits
+	if options.DecimalScale < -math.MaxInt16 || options.DecimalScale > math.MaxInt16 {
+		return template, nil, fmt.Errorf("Decimal scale factor %d not supported", options.DecimalScale)
+	}
+	if options.BinaryScale < -math.MaxInt16 || options.BinaryScale > math.MaxInt16 {
+		return template, nil, fmt.Errorf("Binary scale factor %d not supported", options.BinaryScale)
+	}
+	if options.Bits < 0 || options.Bits > maxPackedBits {
+		return template, nil, fmt.Errorf("Can not pack values in %d bits", options.Bits)
+	}
+	if len(values) == 0 {
+		return template, nil, nil
+	}
+
+	decimalScale := options.DecimalScale
+	minValue, maxValue := values[0], values[0]
+	for _, value := range values {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return template, nil, fmt.Errorf("Can not pack the value %g", value)
+		}
+		minValue = math.Min(minValue, value)
+		maxValue = math.Max(maxValue, value)
+	}
+
+	// with a fixed number of bits, use more decimals as long as the values fit
+	if options.Bits > 0 && maxValue > minValue {
+		limit := math.Ldexp(1, options.Bits) - 1
+		magnitude := math.Max(math.Abs(minValue), math.Abs(maxValue))
+		for decimalScale < 30 && math.Ldexp((maxValue-minValue)*math.Pow10(decimalScale+1), -options.BinaryScale) <= limit &&
+			magnitude*math.Pow10(decimalScale+1) < math.MaxFloat32/2 {
+			decimalScale++
+		}
+	}
+
+	scale := math.Pow10(decimalScale)
+	// the values are rounded to integers, so is the reference value if float32 allows. With a negative binary
+	// scale factor, the values are rounded to fractions and the reference value is kept as it is.
+	rounded := math.Round(minValue * scale)
+	if options.BinaryScale < 0 {
+		rounded = minValue * scale
+	}
+	reference := float32(rounded)
+	if math.IsInf(float64(reference), 0) {
+		return template, nil, fmt.Errorf("Can not pack the value %g with %d decimals", minValue, decimalScale)
+	}
+	if float64(reference) > rounded {
+		reference = math.Nextafter32(reference, float32(math.Inf(-1)))
+	}
+	span := maxValue*scale - float64(reference)
+
+	binaryScale := options.BinaryScale
+	bits := options.Bits
+	if bits == 0 {
+		bits = bitsFor(math.Round(math.Ldexp(span, -binaryScale)))
+	} else {
+		for math.Round(math.Ldexp(span, -binaryScale)) > math.Ldexp(1, bits)-1 {
+			binaryScale++
+		}
+	}
+	if bits > maxPackedBits {
+		return template, nil, fmt.Errorf("Can not pack values ranging from %g to %g with %d decimals", minValue, maxValue, decimalScale)
+	}
+
+	template = Data0{
+		Reference:    reference,
+		BinaryScale:  int16(binaryScale),
+		DecimalScale: int16(decimalScale),
+		Bits:         uint8(bits),
+	}
+	integers := make([]uint64, len(values))
+	limit := math.Ldexp(1, bits) - 1
+	for i, value := range values {
+		integer := math.Round(math.Ldexp(value*scale-float64(reference), -binaryScale))
+		integers[i] = uint64(math.Min(math.Max(integer, 0), limit))
+	}
+	return template, integers, nil
+}
+
+// bitsFor returns the number of bits needed for the non-negative integer value
+func bitsFor(value float64) int {
+	bits := 0
+	for value >= math.Ldexp(1, bits) {
+		bits++
+	}
+	return bits
+}
+
+//write serializes the given data into writer
+func write(w io.Writer, data ...interface{}) (err error) {
+	for _, what := range data {
+		err = binary.Write(w, binary.BigEndian, what)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
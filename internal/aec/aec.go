@@ -0,0 +1,310 @@
+// Package aec decodes data compressed with the Adaptive Entropy Coding of CCSDS 121.0-B-2,
+// as written by libaec and used by GRIB2 data representation template 5.42.
+package aec
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// Flags of the compression options mask, the values are those of libaec
+const (
+	DataSigned     = 1  // samples are signed
+	Data3Byte      = 2  // samples of 17 to 24 bits are stored in 3 octets
+	DataMSB        = 4  // samples are stored most significant octet first
+	DataPreprocess = 8  // samples are coded as mapped prediction residuals
+	Restricted     = 16 // restricted set of code options for samples of up to 4 bits
+	PadRSI         = 32 // every reference sample interval is padded to an octet boundary
+	NotEnforce     = 64 // do not enforce the standard block sizes
+)
+
+// lowEntropy is the identifier of the zero block and second extension options
+const lowEntropy = 0
+
+// remainderOfSegment is the zero block count telling that zero blocks run to the end of
+// the segment of 64 blocks or of the reference sample interval
+const remainderOfSegment = 5
+
+// maxSecondExtension is the largest codeword of the second extension option
+const maxSecondExtension = 90
+
+// Params are the coding parameters of a stream
+type Params struct {
+	BitsPerSample int
+	BlockSize     int // samples per block
+	RSI           int // blocks per reference sample interval
+	Flags         int
+}
+
+// idLength returns the number of bits of the code option identifiers
+func (p Params) idLength() (int, error) {
+	switch {
+	case p.BitsPerSample > 16:
+		return 5, nil
+	case p.BitsPerSample > 8:
+		return 4, nil
+	case p.Flags&Restricted == 0:
+		return 3, nil
+	case p.BitsPerSample <= 2:
+		return 1, nil
+	case p.BitsPerSample <= 4:
+		return 2, nil
+	}
+	return 0, fmt.Errorf("aec: restricted coding of %d bit samples", p.BitsPerSample)
+}
+
+func (p Params) validate() error {
+	if p.BitsPerSample < 1 || p.BitsPerSample > 32 {
+		return fmt.Errorf("aec: invalid sample size of %d bits", p.BitsPerSample)
+	}
+	if p.RSI < 1 || p.RSI > 4096 {
+		return fmt.Errorf("aec: invalid reference sample interval of %d blocks", p.RSI)
+	}
+	if p.Flags&NotEnforce != 0 {
+		if p.BlockSize < 2 || p.BlockSize%2 != 0 || p.BlockSize > 256 {
+			return fmt.Errorf("aec: invalid block size %d", p.BlockSize)
+		}
+		return nil
+	}
+	switch p.BlockSize {
+	case 8, 16, 32, 64:
+		return nil
+	}
+	return fmt.Errorf("aec: invalid block size %d", p.BlockSize)
+}
+
+// Decode decodes count samples from data
+func Decode(data []byte, count int, p Params) ([]int64, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	if count < 0 {
+		return nil, fmt.Errorf("aec: invalid sample count %d", count)
+	}
+	idLength, err := p.idLength()
+	if err != nil {
+		return nil, err
+	}
+	uncompressed := 1<<uint(idLength) - 1
+	preprocess := p.Flags&DataPreprocess != 0
+
+	r := &bitReader{data: data}
+	// count comes from the message, the samples grow with the data rather than being allocated up front
+	samples := make([]int64, 0, min(count, 8*len(data)))
+	// interval holds the coded samples of one reference sample interval
+	interval := make([]uint64, 0, p.RSI*p.BlockSize)
+
+	for len(samples) < count {
+		interval = interval[:0]
+		for block := 0; block < p.RSI && len(samples)+len(interval) < count; block++ {
+			reference := preprocess && block == 0
+			id := int(r.bits(idLength))
+
+			switch {
+			case id == lowEntropy:
+				secondExtension := r.bits(1) == 1
+				if reference {
+					interval = append(interval, r.bits(p.BitsPerSample))
+				}
+				if secondExtension {
+					if interval, err = decodeSecondExtension(r, interval, p.BlockSize, reference); err != nil {
+						return nil, err
+					}
+					break
+				}
+				blocks := decodeZeroBlockCount(r, block, p.RSI)
+				for i := boolInt(reference); i < blocks*p.BlockSize; i++ {
+					interval = append(interval, 0)
+				}
+				block += blocks - 1
+			case id == uncompressed:
+				for i := 0; i < p.BlockSize; i++ {
+					interval = append(interval, r.bits(p.BitsPerSample))
+				}
+			default:
+				k := id - 1
+				if reference {
+					interval = append(interval, r.bits(p.BitsPerSample))
+				}
+				start := len(interval)
+				for i := boolInt(reference); i < p.BlockSize; i++ {
+					interval = append(interval, r.fundamentalSequence()<<uint(k))
+				}
+				for i := start; i < len(interval); i++ {
+					interval[i] |= r.bits(k)
+				}
+			}
+			if r.overrun() {
+				return nil, fmt.Errorf("aec: data ends after %d of %d samples", len(samples)+len(interval), count)
+			}
+		}
+		if p.Flags&PadRSI != 0 {
+			r.align()
+		}
+
+		if preprocess {
+			samples = postprocess(samples, interval, p)
+		} else {
+			for _, value := range interval {
+				samples = append(samples, signExtend(value, p))
+			}
+		}
+	}
+	return samples[:count], nil
+}
+
+// decodeZeroBlockCount reads the number of all zero blocks starting with block
+func decodeZeroBlockCount(r *bitReader, block, rsi int) int {
+	blocks := int(r.fundamentalSequence()) + 1
+	if blocks == remainderOfSegment {
+		blocks = 64 - block%64
+		if rest := rsi - block; rest < blocks {
+			blocks = rest
+		}
+	} else if blocks > remainderOfSegment {
+		blocks--
+	}
+	if rest := rsi - block; blocks > rest {
+		blocks = rest
+	}
+	return blocks
+}
+
+// decodeSecondExtension reads a block coded with the second extension option, where each
+// pair of samples is coded as one codeword. The first sample of a block starting with a
+// reference sample is not coded.
+func decodeSecondExtension(r *bitReader, interval []uint64, blockSize int, reference bool) ([]uint64, error) {
+	for i := boolInt(reference); i < blockSize; {
+		m := r.fundamentalSequence()
+		if m > maxSecondExtension {
+			return interval, fmt.Errorf("aec: invalid second extension codeword %d", m)
+		}
+		// m = beta*(beta+1)/2 + second, where beta is the sum of the pair
+		beta := uint64(0)
+		for (beta+1)*(beta+2)/2 <= m {
+			beta++
+		}
+		second := m - beta*(beta+1)/2
+		if i%2 == 0 {
+			interval = append(interval, beta-second)
+			i++
+		}
+		interval = append(interval, second)
+		i++
+	}
+	return interval, nil
+}
+
+// postprocess reverses the unit delay prediction and the mapping of the prediction
+// residuals (CCSDS 121.0-B-2 section 4), the first value of interval is the reference sample
+func postprocess(samples []int64, interval []uint64, p Params) []int64 {
+	if len(interval) == 0 {
+		return samples
+	}
+	xmin, xmax := int64(0), int64(1)<<uint(p.BitsPerSample)-1
+	if p.Flags&DataSigned != 0 {
+		xmin, xmax = -(int64(1) << uint(p.BitsPerSample-1)), int64(1)<<uint(p.BitsPerSample-1)-1
+	}
+	last := signExtend(interval[0], p)
+	samples = append(samples, last)
+	for _, mapped := range interval[1:] {
+		d := int64(mapped)
+		theta := last - xmin
+		if xmax-last < theta {
+			theta = xmax - last
+		}
+		switch {
+		case d <= 2*theta && d%2 == 0:
+			last += d / 2
+		case d <= 2*theta:
+			last -= (d + 1) / 2
+		case theta == last-xmin:
+			last = xmin + d
+		default:
+			last = xmax - d
+		}
+		samples = append(samples, last)
+	}
+	return samples
+}
+
+// signExtend interprets a raw sample as a two's complement value for signed data
+func signExtend(value uint64, p Params) int64 {
+	if p.Flags&DataSigned != 0 && value&(1<<uint(p.BitsPerSample-1)) != 0 {
+		return int64(value) - int64(1)<<uint(p.BitsPerSample)
+	}
+	return int64(value)
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// bitReader reads a stream of bits, most significant bit first. Reading beyond the data
+// returns zero bits and is reported by overrun.
+type bitReader struct {
+	data     []byte
+	pos      int    // next octet to load into acc
+	acc      uint64 // bits not read yet, left aligned
+	n        uint   // number of bits in acc
+	consumed int    // number of bits read
+}
+
+func (r *bitReader) fill() {
+	for r.n <= 56 {
+		var b byte
+		if r.pos < len(r.data) {
+			b = r.data[r.pos]
+		}
+		r.pos++
+		r.acc |= uint64(b) << (56 - r.n)
+		r.n += 8
+	}
+}
+
+// bits reads an unsigned value of n bits, n is at most 32
+func (r *bitReader) bits(n int) uint64 {
+	if n == 0 {
+		return 0
+	}
+	r.fill()
+	v := r.acc >> uint(64-n)
+	r.acc <<= uint(n)
+	r.n -= uint(n)
+	r.consumed += n
+	return v
+}
+
+// fundamentalSequence reads a fundamental sequence codeword, the number of zero bits before a one bit
+func (r *bitReader) fundamentalSequence() uint64 {
+	var zeros uint64
+	for !r.overrun() {
+		r.fill()
+		if r.acc == 0 {
+			zeros += uint64(r.n)
+			r.consumed += int(r.n)
+			r.acc, r.n = 0, 0
+			continue
+		}
+		z := uint(bits.LeadingZeros64(r.acc))
+		r.acc <<= z + 1
+		r.n -= z + 1
+		r.consumed += int(z) + 1
+		return zeros + uint64(z)
+	}
+	return zeros
+}
+
+// align skips the bits up to the next octet boundary
+func (r *bitReader) align() {
+	if rest := r.consumed % 8; rest != 0 {
+		r.bits(8 - rest)
+	}
+}
+
+func (r *bitReader) overrun() bool {
+	return r.consumed > 8*len(r.data)
+}
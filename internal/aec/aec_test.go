@@ -0,0 +1,384 @@
+package aec
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encoder is a simple Adaptive Entropy Coding encoder, it only exists to produce streams
+// for the decoder tests. It picks the shortest code option for every block and counts the
+// options it used.
+type encoder struct {
+	p        Params
+	idLength int
+	out      []byte
+	buf      uint64
+	n        uint
+	options  map[string]int
+}
+
+func (e *encoder) put(value uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		e.buf = e.buf<<1 | value>>uint(i)&1
+		e.n++
+		if e.n == 8 {
+			e.out = append(e.out, byte(e.buf))
+			e.buf, e.n = 0, 0
+		}
+	}
+}
+
+func (e *encoder) fundamentalSequence(value uint64) {
+	for i := uint64(0); i < value; i++ {
+		e.put(0, 1)
+	}
+	e.put(1, 1)
+}
+
+func (e *encoder) align() {
+	if e.n > 0 {
+		e.put(0, int(8-e.n))
+	}
+}
+
+// encode codes samples, the last block is padded with the last sample
+func encode(t *testing.T, samples []int64, p Params) ([]byte, map[string]int) {
+	t.Helper()
+	idLength, err := p.idLength()
+	require.NoError(t, err)
+	e := &encoder{p: p, idLength: idLength, options: map[string]int{}}
+	mask := uint64(1)<<uint(p.BitsPerSample) - 1
+	xmin, xmax := int64(0), int64(mask)
+	if p.Flags&DataSigned != 0 {
+		xmin, xmax = -int64(mask/2)-1, int64(mask/2)
+	}
+
+	intervalSize := p.RSI * p.BlockSize
+	for start := 0; start < len(samples); start += intervalSize {
+		end := start + intervalSize
+		if end > len(samples) {
+			end = len(samples)
+		}
+		raw := append([]int64{}, samples[start:end]...)
+		for len(raw)%p.BlockSize != 0 {
+			raw = append(raw, raw[len(raw)-1])
+		}
+
+		// preprocessing: the mapped prediction residuals of CCSDS 121.0-B-2 section 4
+		coded := make([]uint64, len(raw))
+		for i, x := range raw {
+			if p.Flags&DataPreprocess == 0 || i == 0 {
+				coded[i] = uint64(x) & mask
+				continue
+			}
+			last := raw[i-1]
+			delta := x - last
+			theta := last - xmin
+			if xmax-last < theta {
+				theta = xmax - last
+			}
+			switch {
+			case delta >= 0 && delta <= theta:
+				coded[i] = uint64(2 * delta)
+			case delta < 0 && -delta <= theta:
+				coded[i] = uint64(-2*delta - 1)
+			case delta < 0:
+				coded[i] = uint64(theta - delta)
+			default:
+				coded[i] = uint64(theta + delta)
+			}
+		}
+
+		blocks := len(coded) / p.BlockSize
+		for b := 0; b < blocks; b++ {
+			reference := p.Flags&DataPreprocess != 0 && b == 0
+			block := coded[b*p.BlockSize : (b+1)*p.BlockSize]
+			if run := e.zeroRun(coded, b, blocks, reference); run > 0 {
+				e.put(lowEntropy, idLength)
+				e.put(0, 1)
+				if reference {
+					e.put(block[0], p.BitsPerSample)
+				}
+				atEnd := b+run == blocks || (b+run)%64 == 0
+				switch {
+				case run > 4 && atEnd:
+					e.fundamentalSequence(remainderOfSegment - 1)
+				case run > 4:
+					e.fundamentalSequence(uint64(run))
+				default:
+					e.fundamentalSequence(uint64(run - 1))
+				}
+				e.options["zero"]++
+				b += run - 1
+				continue
+			}
+			e.encodeBlock(block, reference)
+		}
+		if p.Flags&PadRSI != 0 {
+			e.align()
+		}
+	}
+	e.align()
+	return e.out, e.options
+}
+
+// zeroRun returns the number of all zero blocks starting with block b, within the segment of 64 blocks
+func (e *encoder) zeroRun(coded []uint64, b, blocks int, reference bool) int {
+	run := 0
+	for ; b+run < blocks && (run == 0 || (b+run)%64 != 0); run++ {
+		first := (b + run) * e.p.BlockSize
+		if run == 0 && reference {
+			first++
+		}
+		for _, v := range coded[first : (b+run+1)*e.p.BlockSize] {
+			if v != 0 {
+				return run
+			}
+		}
+	}
+	return run
+}
+
+func (e *encoder) encodeBlock(block []uint64, reference bool) {
+	values := block
+	if reference {
+		values = block[1:]
+	}
+	uncompressed := 1<<uint(e.idLength) - 1
+
+	// the cost of every option in bits, -1 is the second extension
+	bestOption, bestCost := uncompressed, e.p.BitsPerSample*len(block)
+	if cost, ok := secondExtensionCost(block, reference); ok && cost+1 < bestCost {
+		bestOption, bestCost = -1, cost+1
+	}
+	for k := 0; k < uncompressed-1; k++ {
+		cost := k * len(values)
+		for _, v := range values {
+			cost += int(v>>uint(k)) + 1
+		}
+		if reference {
+			cost += e.p.BitsPerSample
+		}
+		if cost < bestCost {
+			bestOption, bestCost = k+1, cost
+		}
+	}
+
+	switch {
+	case bestOption == -1:
+		e.put(lowEntropy, e.idLength)
+		e.put(1, 1)
+		if reference {
+			e.put(block[0], e.p.BitsPerSample)
+		}
+		for i := 0; i < len(block); i += 2 {
+			first, second := block[i], block[i+1]
+			if i == 0 && reference {
+				first = 0
+			}
+			beta := first + second
+			e.fundamentalSequence(beta*(beta+1)/2 + second)
+		}
+		e.options["second extension"]++
+	case bestOption == uncompressed:
+		e.put(uint64(uncompressed), e.idLength)
+		for _, v := range block {
+			e.put(v, e.p.BitsPerSample)
+		}
+		e.options["uncompressed"]++
+	default:
+		k := bestOption - 1
+		e.put(uint64(bestOption), e.idLength)
+		if reference {
+			e.put(block[0], e.p.BitsPerSample)
+		}
+		for _, v := range values {
+			e.fundamentalSequence(v >> uint(k))
+		}
+		for _, v := range values {
+			e.put(v&(1<<uint(k)-1), k)
+		}
+		e.options[fmt.Sprintf("split %d", k)]++
+	}
+}
+
+func secondExtensionCost(block []uint64, reference bool) (int, bool) {
+	cost := 0
+	for i := 0; i < len(block); i += 2 {
+		first, second := block[i], block[i+1]
+		if i == 0 && reference {
+			first = 0
+		}
+		beta := first + second
+		m := beta*(beta+1)/2 + second
+		if m > maxSecondExtension {
+			return 0, false
+		}
+		cost += int(m) + 1
+	}
+	return cost, true
+}
+
+// testSamples returns count samples of the given size with runs of constant values,
+// smooth parts and noise, so that every code option is used
+func testSamples(count, bitsPerSample int, signed bool, seed int64) []int64 {
+	random := rand.New(rand.NewSource(seed))
+	high := int64(1)<<uint(bitsPerSample) - 1
+	low := int64(0)
+	if signed {
+		low, high = -(high/2)-1, high/2
+	}
+	clamp := func(v int64) int64 {
+		if v < low {
+			return low
+		}
+		if v > high {
+			return high
+		}
+		return v
+	}
+	samples := make([]int64, count)
+	value := (low + high) / 2
+	for i := range samples {
+		switch part := (i / 700) % 5; part {
+		case 0:
+			// constant
+		case 1:
+			if random.Intn(4) == 0 {
+				value = clamp(value + int64(random.Intn(3)) - 1)
+			}
+		case 2:
+			value = clamp(value + int64(random.Intn(9)) - 4)
+		case 3:
+			value = clamp(value + random.Int63n(high/8+1) - high/16)
+		case 4:
+			value = low + random.Int63n(high-low+1)
+		}
+		samples[i] = value
+	}
+	return samples
+}
+
+func Test_decode_round_trip(t *testing.T) {
+	used := map[string]int{}
+	for _, bitsPerSample := range []int{1, 2, 3, 8, 12, 16, 17, 24, 32} {
+		for _, blockSize := range []int{8, 16, 32, 64} {
+			for _, flags := range []int{DataPreprocess, 0, DataPreprocess | DataSigned, DataPreprocess | PadRSI, DataSigned} {
+				p := Params{BitsPerSample: bitsPerSample, BlockSize: blockSize, RSI: 128, Flags: flags | DataMSB}
+				name := fmt.Sprintf("%d bits, block size %d, flags %d", bitsPerSample, blockSize, flags)
+				samples := testSamples(7001, bitsPerSample, flags&DataSigned != 0, int64(bitsPerSample))
+
+				data, options := encode(t, samples, p)
+				for option, count := range options {
+					used[option] += count
+				}
+				decoded, err := Decode(data, len(samples), p)
+
+				require.NoError(t, err, name)
+				require.Equal(t, samples, decoded, name)
+			}
+		}
+	}
+	for _, option := range []string{"zero", "second extension", "uncompressed", "split 0", "split 1", "split 4"} {
+		assert.NotZero(t, used[option], "option %s should be tested", option)
+	}
+}
+
+func Test_decode_spelled_stream(t *testing.T) {
+	// a stream spelled out after the code options of CCSDS 121.0-B-2 section 3, rather than written by the test
+	// encoder: 8 bit samples without preprocessing, blocks of 8 samples and identifiers of 3 bits
+	stream := strings.Join([]string{
+		// uncompressed, identifier 111 and the samples
+		"111", "00010010 00110100 01010110 01111000 10011010 10111100 11011110 11110000",
+		// split with k = 1, identifier 010, the samples shifted right as fundamental sequences, then their last bit
+		"010", "01 1 001 01 1 001 0001 0001", "1 0 1 0 1 0 1 0",
+		// zero block, identifier 000, selector 0 and a run of 1 block as the fundamental sequence of 0
+		"000", "0", "1",
+		// fundamental sequence, identifier 001
+		"001", "1 01 1 001 1 1 0001 01",
+		// second extension, identifier 000, selector 1 and the pairs (0,0) (1,0) (0,1) (1,1) as 0, 1, 2 and 4
+		"000", "1", "1 01 001 00001",
+	}, "")
+	stream = strings.ReplaceAll(stream, " ", "")
+	data := make([]byte, (len(stream)+7)/8)
+	for i, bit := range stream {
+		if bit == '1' {
+			data[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+
+	decoded, err := Decode(data, 40, Params{BitsPerSample: 8, BlockSize: 8, RSI: 64})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{
+		0x12, 0x34, 0x56, 0x78, 0x9A, 0xBC, 0xDE, 0xF0,
+		3, 0, 5, 2, 1, 4, 7, 6,
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0, 1, 0, 2, 0, 0, 3, 1,
+		0, 0, 1, 0, 0, 1, 1, 1,
+	}, decoded)
+}
+
+func Test_decode_short_intervals(t *testing.T) {
+	// zero blocks running to the end of a reference sample interval
+	p := Params{BitsPerSample: 8, BlockSize: 8, RSI: 3, Flags: DataPreprocess}
+	samples := make([]int64, 200)
+	for i := 150; i < len(samples); i++ {
+		samples[i] = int64(i % 7)
+	}
+
+	data, _ := encode(t, samples, p)
+	decoded, err := Decode(data, len(samples), p)
+
+	require.NoError(t, err)
+	assert.Equal(t, samples, decoded)
+}
+
+func Test_decode_restricted(t *testing.T) {
+	for _, bitsPerSample := range []int{1, 2, 3, 4} {
+		p := Params{BitsPerSample: bitsPerSample, BlockSize: 16, RSI: 32, Flags: DataPreprocess | Restricted}
+		samples := testSamples(3500, bitsPerSample, false, 1)
+
+		data, _ := encode(t, samples, p)
+		decoded, err := Decode(data, len(samples), p)
+
+		require.NoError(t, err)
+		assert.Equal(t, samples, decoded, "%d bits", bitsPerSample)
+	}
+
+	_, err := Decode(nil, 1, Params{BitsPerSample: 8, BlockSize: 16, RSI: 32, Flags: Restricted})
+	assert.Error(t, err, "restricted coding is only defined up to 4 bits")
+}
+
+func Test_decode_invalid_params(t *testing.T) {
+	for _, p := range []Params{
+		{BitsPerSample: 0, BlockSize: 16, RSI: 32},
+		{BitsPerSample: 33, BlockSize: 16, RSI: 32},
+		{BitsPerSample: 8, BlockSize: 12, RSI: 32},
+		{BitsPerSample: 8, BlockSize: 16, RSI: 0},
+	} {
+		_, err := Decode([]byte{0xFF}, 1, p)
+		assert.Error(t, err, "%+v", p)
+	}
+}
+
+func Test_decode_truncated(t *testing.T) {
+	p := Params{BitsPerSample: 16, BlockSize: 32, RSI: 64, Flags: DataPreprocess}
+	samples := testSamples(5000, 16, false, 1)
+	data, _ := encode(t, samples, p)
+
+	for _, length := range []int{0, 1, len(data) / 2, len(data) - 10} {
+		_, err := Decode(data[:length], len(samples), p)
+		assert.Error(t, err, "data cut at %d", length)
+	}
+
+	// a corrupt count is not allocated before the data runs out
+	_, err := Decode(data, 1<<50, p)
+	assert.Error(t, err)
+	_, err = Decode(data, -1, p)
+	assert.Error(t, err)
+}
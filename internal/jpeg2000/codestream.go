@@ -0,0 +1,354 @@
+package jpeg2000
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Marker codes of the codestream, see ITU-T T.800 Annex A
+const (
+	markerSOC = 0xFF4F // start of codestream
+	markerSOT = 0xFF90 // start of tile-part
+	markerSOD = 0xFF93 // start of data
+	markerEOC = 0xFFD9 // end of codestream
+	markerSIZ = 0xFF51 // image and tile size
+	markerCOD = 0xFF52 // coding style default
+	markerCOC = 0xFF53 // coding style component
+	markerRGN = 0xFF5E // region of interest
+	markerQCD = 0xFF5C // quantization default
+	markerQCC = 0xFF5D // quantization component
+	markerPOC = 0xFF5F // progression order change
+	markerPPM = 0xFF60 // packed packet headers, main header
+	markerPPT = 0xFF61 // packed packet headers, tile-part header
+	markerSOP = 0xFF91 // start of packet
+	markerEPH = 0xFF92 // end of packet header
+)
+
+// Progression orders (Table A.16)
+const (
+	progressionLRCP = iota
+	progressionRLCP
+	progressionRPCL
+	progressionPCRL
+	progressionCPRL
+)
+
+// Code-block style flags (Table A.19)
+const (
+	styleBypass             = 0x01
+	styleReset              = 0x02
+	styleTerminateAll       = 0x04
+	styleVerticallyCausal   = 0x08
+	stylePredictableTerm    = 0x10
+	styleSegmentationSymbol = 0x20
+)
+
+// componentSize holds the SIZ parameters of one component
+type componentSize struct {
+	precision int
+	signed    bool
+	dx, dy    int
+}
+
+// imageSize is the content of the SIZ marker segment
+type imageSize struct {
+	width, height          int // Xsiz, Ysiz
+	x0, y0                 int // XOsiz, YOsiz
+	tileWidth, tileHeight  int // XTsiz, YTsiz
+	tileX0, tileY0         int // XTOsiz, YTOsiz
+	components             []componentSize
+	tilesAcross, tilesDown int
+}
+
+// codingStyle is the content of the COD and COC marker segments
+type codingStyle struct {
+	precincts       bool
+	sop             bool
+	eph             bool
+	progression     int
+	layers          int
+	mct             int
+	levels          int
+	codeBlockWidth  int // exponent, xcb
+	codeBlockHeight int // exponent, ycb
+	codeBlockStyle  int
+	reversible      bool
+	precinctWidth   []int // exponent per resolution level
+	precinctHeight  []int
+}
+
+// stepSize is one quantization step size of a subband
+type stepSize struct {
+	exponent int
+	mantissa int
+}
+
+// quantization is the content of the QCD and QCC marker segments
+type quantization struct {
+	style     int // 0: none, 1: scalar derived, 2: scalar expounded
+	guardBits int
+	steps     []stepSize
+}
+
+// header holds the coding parameters that apply to a tile, per component
+type header struct {
+	coding       []codingStyle
+	quantization []quantization
+	roiShift     []int
+}
+
+func (h header) clone() header {
+	return header{
+		coding:       append([]codingStyle{}, h.coding...),
+		quantization: append([]quantization{}, h.quantization...),
+		roiShift:     append([]int{}, h.roiShift...),
+	}
+}
+
+// segmentReader reads marker segments from a codestream
+type segmentReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *segmentReader) marker() (int, error) {
+	if r.pos+2 > len(r.data) {
+		return 0, fmt.Errorf("jpeg2000: unexpected end of codestream")
+	}
+	m := int(binary.BigEndian.Uint16(r.data[r.pos:]))
+	r.pos += 2
+	return m, nil
+}
+
+// segment returns the body of the marker segment following a marker
+func (r *segmentReader) segment() ([]byte, error) {
+	if r.pos+2 > len(r.data) {
+		return nil, fmt.Errorf("jpeg2000: unexpected end of codestream")
+	}
+	length := int(binary.BigEndian.Uint16(r.data[r.pos:]))
+	if length < 2 || r.pos+length > len(r.data) {
+		return nil, fmt.Errorf("jpeg2000: invalid marker segment length %d", length)
+	}
+	body := r.data[r.pos+2 : r.pos+length]
+	r.pos += length
+	return body, nil
+}
+
+func parseSIZ(body []byte) (imageSize, error) {
+	var siz imageSize
+	if len(body) < 36 {
+		return siz, fmt.Errorf("jpeg2000: SIZ segment too short")
+	}
+	u32 := func(i int) int { return int(binary.BigEndian.Uint32(body[i:])) }
+	siz.width, siz.height = u32(2), u32(6)
+	siz.x0, siz.y0 = u32(10), u32(14)
+	siz.tileWidth, siz.tileHeight = u32(18), u32(22)
+	siz.tileX0, siz.tileY0 = u32(26), u32(30)
+	count := int(binary.BigEndian.Uint16(body[34:]))
+	if count == 0 || len(body) < 36+3*count {
+		return siz, fmt.Errorf("jpeg2000: SIZ segment has invalid component count %d", count)
+	}
+	for c := 0; c < count; c++ {
+		ssiz := body[36+3*c]
+		siz.components = append(siz.components, componentSize{
+			precision: int(ssiz&0x7F) + 1,
+			signed:    ssiz&0x80 != 0,
+			dx:        int(body[37+3*c]),
+			dy:        int(body[38+3*c]),
+		})
+		if siz.components[c].dx == 0 || siz.components[c].dy == 0 {
+			return siz, fmt.Errorf("jpeg2000: component %d has zero subsampling", c)
+		}
+	}
+	if siz.width <= siz.x0 || siz.height <= siz.y0 || siz.tileWidth == 0 || siz.tileHeight == 0 ||
+		siz.tileX0 > siz.x0 || siz.tileY0 > siz.y0 ||
+		siz.tileX0+siz.tileWidth <= siz.x0 || siz.tileY0+siz.tileHeight <= siz.y0 {
+		return siz, fmt.Errorf("jpeg2000: invalid image or tile size")
+	}
+	siz.tilesAcross = ceilDiv(siz.width-siz.tileX0, siz.tileWidth)
+	siz.tilesDown = ceilDiv(siz.height-siz.tileY0, siz.tileHeight)
+	return siz, nil
+}
+
+// parseCOD reads a COD segment into style
+func parseCOD(body []byte, style *codingStyle) error {
+	if len(body) < 5 {
+		return fmt.Errorf("jpeg2000: COD segment too short")
+	}
+	scod := body[0]
+	style.precincts = scod&0x01 != 0
+	style.sop = scod&0x02 != 0
+	style.eph = scod&0x04 != 0
+	style.progression = int(body[1])
+	style.layers = int(binary.BigEndian.Uint16(body[2:]))
+	style.mct = int(body[4])
+	if style.progression > progressionCPRL || style.layers == 0 {
+		return fmt.Errorf("jpeg2000: invalid progression order %d or layer count %d", style.progression, style.layers)
+	}
+	return parseCodingParameters(body[5:], style.precincts, style)
+}
+
+// parseCOC reads a COC segment into the style of the component it applies to
+func parseCOC(body []byte, components int, styles []codingStyle) error {
+	index, rest, err := componentIndex(body, components)
+	if err != nil {
+		return err
+	}
+	if len(rest) < 1 {
+		return fmt.Errorf("jpeg2000: COC segment too short")
+	}
+	style := styles[index]
+	style.precincts = rest[0]&0x01 != 0
+	if err := parseCodingParameters(rest[1:], style.precincts, &style); err != nil {
+		return err
+	}
+	styles[index] = style
+	return nil
+}
+
+// parseCodingParameters reads the SPcod/SPcoc parameters shared by COD and COC
+func parseCodingParameters(body []byte, precincts bool, style *codingStyle) error {
+	if len(body) < 5 {
+		return fmt.Errorf("jpeg2000: coding style parameters too short")
+	}
+	style.levels = int(body[0])
+	style.codeBlockWidth = int(body[1]&0x0F) + 2
+	style.codeBlockHeight = int(body[2]&0x0F) + 2
+	style.codeBlockStyle = int(body[3])
+	style.reversible = body[4] == 1
+	if style.levels > 32 || style.codeBlockWidth > 10 || style.codeBlockHeight > 10 || style.codeBlockWidth+style.codeBlockHeight > 12 {
+		return fmt.Errorf("jpeg2000: invalid coding style parameters")
+	}
+	style.precinctWidth = make([]int, style.levels+1)
+	style.precinctHeight = make([]int, style.levels+1)
+	for r := 0; r <= style.levels; r++ {
+		style.precinctWidth[r], style.precinctHeight[r] = 15, 15
+		if precincts {
+			if len(body) < 6+r {
+				return fmt.Errorf("jpeg2000: missing precinct size for resolution %d", r)
+			}
+			style.precinctWidth[r] = int(body[5+r] & 0x0F)
+			style.precinctHeight[r] = int(body[5+r] >> 4)
+		}
+	}
+	return nil
+}
+
+func parseQuantization(body []byte) (quantization, error) {
+	var q quantization
+	if len(body) < 1 {
+		return q, fmt.Errorf("jpeg2000: quantization segment too short")
+	}
+	q.style = int(body[0] & 0x1F)
+	q.guardBits = int(body[0] >> 5)
+	body = body[1:]
+	switch q.style {
+	case 0:
+		for _, b := range body {
+			q.steps = append(q.steps, stepSize{exponent: int(b >> 3)})
+		}
+	case 1, 2:
+		for i := 0; i+1 < len(body); i += 2 {
+			v := int(binary.BigEndian.Uint16(body[i:]))
+			q.steps = append(q.steps, stepSize{exponent: v >> 11, mantissa: v & 0x7FF})
+		}
+	default:
+		return q, fmt.Errorf("jpeg2000: unknown quantization style %d", q.style)
+	}
+	if len(q.steps) == 0 {
+		return q, fmt.Errorf("jpeg2000: quantization segment has no step sizes")
+	}
+	return q, nil
+}
+
+// componentIndex reads the component index of COC, QCC and RGN segments, which is 8 bit when
+// there are less than 257 components and 16 bit otherwise
+func componentIndex(body []byte, components int) (int, []byte, error) {
+	var index int
+	if components < 257 {
+		if len(body) < 1 {
+			return 0, nil, fmt.Errorf("jpeg2000: marker segment too short")
+		}
+		index, body = int(body[0]), body[1:]
+	} else {
+		if len(body) < 2 {
+			return 0, nil, fmt.Errorf("jpeg2000: marker segment too short")
+		}
+		index, body = int(binary.BigEndian.Uint16(body)), body[2:]
+	}
+	if index >= components {
+		return 0, nil, fmt.Errorf("jpeg2000: component index %d out of range", index)
+	}
+	return index, body, nil
+}
+
+// parseHeaderSegment applies a COD, COC, QCD, QCC or RGN segment to h. Segments that apply
+// to one component take precedence over the default segments, which is tracked in
+// the explicit slices.
+func parseHeaderSegment(marker int, body []byte, h *header, explicitCoding, explicitQuantization []bool) error {
+	components := len(h.coding)
+	switch marker {
+	case markerCOD:
+		var style codingStyle
+		if err := parseCOD(body, &style); err != nil {
+			return err
+		}
+		for c := range h.coding {
+			if !explicitCoding[c] {
+				h.coding[c] = style
+			} else {
+				// COC does not carry the progression, layers and mct, these always come from COD
+				h.coding[c].sop, h.coding[c].eph = style.sop, style.eph
+				h.coding[c].progression, h.coding[c].layers, h.coding[c].mct = style.progression, style.layers, style.mct
+			}
+		}
+	case markerCOC:
+		index, _, err := componentIndex(body, components)
+		if err != nil {
+			return err
+		}
+		if err := parseCOC(body, components, h.coding); err != nil {
+			return err
+		}
+		explicitCoding[index] = true
+	case markerQCD:
+		q, err := parseQuantization(body)
+		if err != nil {
+			return err
+		}
+		for c := range h.quantization {
+			if !explicitQuantization[c] {
+				h.quantization[c] = q
+			}
+		}
+	case markerQCC:
+		index, rest, err := componentIndex(body, components)
+		if err != nil {
+			return err
+		}
+		q, err := parseQuantization(rest)
+		if err != nil {
+			return err
+		}
+		h.quantization[index] = q
+		explicitQuantization[index] = true
+	case markerRGN:
+		index, rest, err := componentIndex(body, components)
+		if err != nil {
+			return err
+		}
+		if len(rest) < 2 || rest[0] != 0 {
+			return fmt.Errorf("jpeg2000: unsupported region of interest style")
+		}
+		h.roiShift[index] = int(rest[1])
+	case markerPOC:
+		return fmt.Errorf("jpeg2000: progression order changes are not supported")
+	case markerPPM, markerPPT:
+		return fmt.Errorf("jpeg2000: packed packet headers are not supported")
+	}
+	return nil
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
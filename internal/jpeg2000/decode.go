@@ -0,0 +1,699 @@
+// Package jpeg2000 decodes JPEG 2000 codestreams (ITU-T T.800 | ISO/IEC 15444-1), as used by
+// GRIB2 data representation template 5.40.
+package jpeg2000
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// maxSamples limits the size of images, so that a corrupt SIZ segment does not exhaust memory
+const maxSamples = 1 << 28
+
+// Image is a decoded image. Each component holds its samples in raster order.
+type Image struct {
+	Width      int
+	Height     int
+	Components []Component
+}
+
+// Component is one decoded component of an image
+type Component struct {
+	Width     int
+	Height    int
+	Precision int
+	Signed    bool
+	Samples   []int64
+}
+
+// band is a subband of a tile-component
+type band struct {
+	orientation    int
+	x0, y0, x1, y1 int
+	coefficients   []float64
+	magnitudeBits  int
+	step           float64
+}
+
+type resolution struct {
+	x0, y0, x1, y1 int
+	bands          []*band
+	precinctWidth  int // exponent
+	precinctHeight int // exponent
+	precinctsWide  int
+	precinctsHigh  int
+	precincts      []precinct
+}
+
+type tileComponent struct {
+	x0, y0, x1, y1 int
+	style          codingStyle
+	quantization   quantization
+	roiShift       int
+	resolutions    []resolution
+	samples        []float64
+}
+
+type tile struct {
+	index          int
+	x0, y0, x1, y1 int
+	header         header
+	data           []byte
+	parts          int
+	components     []tileComponent
+}
+
+// Decode decodes a JPEG 2000 codestream. A codestream wrapped in a JP2 file is also accepted.
+func Decode(data []byte) (*Image, error) {
+	codestream, err := unwrapJP2(data)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &segmentReader{data: codestream}
+	if m, err := r.marker(); err != nil || m != markerSOC {
+		return nil, fmt.Errorf("jpeg2000: missing SOC marker")
+	}
+	if m, err := r.marker(); err != nil || m != markerSIZ {
+		return nil, fmt.Errorf("jpeg2000: missing SIZ marker")
+	}
+	body, err := r.segment()
+	if err != nil {
+		return nil, err
+	}
+	siz, err := parseSIZ(body)
+	if err != nil {
+		return nil, err
+	}
+
+	components := len(siz.components)
+	main := header{
+		coding:       make([]codingStyle, components),
+		quantization: make([]quantization, components),
+		roiShift:     make([]int, components),
+	}
+	explicitCoding, explicitQuantization := make([]bool, components), make([]bool, components)
+	seenCOD, seenQCD := false, false
+	for {
+		m, err := r.marker()
+		if err != nil {
+			return nil, err
+		}
+		if m == markerSOT {
+			r.pos -= 2
+			break
+		}
+		body, err := r.segment()
+		if err != nil {
+			return nil, err
+		}
+		seenCOD = seenCOD || m == markerCOD
+		seenQCD = seenQCD || m == markerQCD
+		if err := parseHeaderSegment(m, body, &main, explicitCoding, explicitQuantization); err != nil {
+			return nil, err
+		}
+	}
+	if !seenCOD || !seenQCD {
+		return nil, fmt.Errorf("jpeg2000: main header lacks COD or QCD marker")
+	}
+
+	tiles, err := readTileParts(r, siz, main)
+	if err != nil {
+		return nil, err
+	}
+
+	img := &Image{Width: siz.width - siz.x0, Height: siz.height - siz.y0}
+	total := 0
+	for _, c := range siz.components {
+		width := ceilDiv(siz.width, c.dx) - ceilDiv(siz.x0, c.dx)
+		height := ceilDiv(siz.height, c.dy) - ceilDiv(siz.y0, c.dy)
+		if width > maxSamples || height > maxSamples || total+width*height > maxSamples {
+			return nil, fmt.Errorf("jpeg2000: image of %dx%d with %d components is too large", img.Width, img.Height, len(siz.components))
+		}
+		img.Components = append(img.Components, Component{
+			Width:     width,
+			Height:    height,
+			Precision: c.precision,
+			Signed:    c.signed,
+			Samples:   make([]int64, width*height),
+		})
+		total += width * height
+	}
+
+	for _, t := range tiles {
+		if err := t.decode(siz); err != nil {
+			return nil, err
+		}
+		t.store(siz, img)
+	}
+	return img, nil
+}
+
+// unwrapJP2 returns the contiguous codestream box of a JP2 file, or data itself if it is not a JP2 file
+func unwrapJP2(data []byte) ([]byte, error) {
+	signature := []byte{0, 0, 0, 0x0C, 'j', 'P', ' ', ' ', 0x0D, 0x0A, 0x87, 0x0A}
+	if !bytes.HasPrefix(data, signature) {
+		return data, nil
+	}
+	for pos := 0; pos+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		boxType := string(data[pos+4 : pos+8])
+		header := 8
+		if length == 1 {
+			if pos+16 > len(data) {
+				break
+			}
+			length = int(binary.BigEndian.Uint64(data[pos+8:]))
+			header = 16
+		} else if length == 0 {
+			length = len(data) - pos
+		}
+		if length < header || pos+length > len(data) {
+			break
+		}
+		if boxType == "jp2c" {
+			return data[pos+header : pos+length], nil
+		}
+		pos += length
+	}
+	return nil, fmt.Errorf("jpeg2000: JP2 file without codestream")
+}
+
+// readTileParts reads all tile-parts, collecting the data of each tile
+func readTileParts(r *segmentReader, siz imageSize, main header) ([]*tile, error) {
+	byIndex := map[int]*tile{}
+	var tiles []*tile
+	for {
+		start := r.pos
+		m, err := r.marker()
+		if err != nil {
+			return nil, err
+		}
+		if m == markerEOC {
+			break
+		}
+		if m != markerSOT {
+			return nil, fmt.Errorf("jpeg2000: expected SOT marker, found %04X", m)
+		}
+		body, err := r.segment()
+		if err != nil {
+			return nil, err
+		}
+		if len(body) < 8 {
+			return nil, fmt.Errorf("jpeg2000: SOT segment too short")
+		}
+		index := int(binary.BigEndian.Uint16(body))
+		length := int(binary.BigEndian.Uint32(body[2:]))
+		if index >= siz.tilesAcross*siz.tilesDown {
+			return nil, fmt.Errorf("jpeg2000: tile index %d out of range", index)
+		}
+		end := start + length
+		if length == 0 {
+			end = len(r.data)
+			if bytes.HasSuffix(r.data, []byte{0xFF, 0xD9}) {
+				end -= 2
+			}
+		}
+		if end > len(r.data) || end < r.pos {
+			return nil, fmt.Errorf("jpeg2000: tile-part length %d out of range", length)
+		}
+
+		t, ok := byIndex[index]
+		if !ok {
+			t = &tile{index: index, header: main.clone()}
+			byIndex[index] = t
+			tiles = append(tiles, t)
+		}
+		components := len(siz.components)
+		explicitCoding, explicitQuantization := make([]bool, components), make([]bool, components)
+		for {
+			m, err := r.marker()
+			if err != nil {
+				return nil, err
+			}
+			if m == markerSOD {
+				break
+			}
+			body, err := r.segment()
+			if err != nil {
+				return nil, err
+			}
+			// only the first tile-part of a tile may change coding parameters
+			if t.parts > 0 && m != markerPPT {
+				continue
+			}
+			if err := parseHeaderSegment(m, body, &t.header, explicitCoding, explicitQuantization); err != nil {
+				return nil, err
+			}
+		}
+		t.data = append(t.data, r.data[r.pos:end]...)
+		t.parts++
+		r.pos = end
+		if length == 0 {
+			break
+		}
+	}
+	sort.SliceStable(tiles, func(i, j int) bool { return tiles[i].index < tiles[j].index })
+	return tiles, nil
+}
+
+// init computes the bounds of the tile and the geometry of its components
+func (t *tile) init(siz imageSize) error {
+	p, q := t.index%siz.tilesAcross, t.index/siz.tilesAcross
+	t.x0 = maxInt(siz.tileX0+p*siz.tileWidth, siz.x0)
+	t.y0 = maxInt(siz.tileY0+q*siz.tileHeight, siz.y0)
+	t.x1 = minInt(siz.tileX0+(p+1)*siz.tileWidth, siz.width)
+	t.y1 = minInt(siz.tileY0+(q+1)*siz.tileHeight, siz.height)
+
+	t.components = make([]tileComponent, len(siz.components))
+	for c := range t.components {
+		if err := t.components[c].init(t, siz.components[c], t.header.coding[c], t.header.quantization[c], t.header.roiShift[c]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decode decodes all packets of the tile and reconstructs the samples of its components
+func (t *tile) decode(siz imageSize) error {
+	if err := t.init(siz); err != nil {
+		return err
+	}
+
+	pos := 0
+	for _, packet := range t.packets(siz) {
+		if pos >= len(t.data) {
+			break
+		}
+		tc := &t.components[packet.component]
+		res := &tc.resolutions[packet.resolution]
+		var err error
+		pos, err = decodePacket(t.data, pos, &res.precincts[packet.precinct], packet.layer, tc.style)
+		if err != nil {
+			return err
+		}
+	}
+
+	for c := range t.components {
+		if err := t.components[c].reconstruct(); err != nil {
+			return err
+		}
+	}
+	t.inverseComponentTransform(siz)
+	return nil
+}
+
+// store writes the samples of the tile into the image, with level shift and clipping
+func (t *tile) store(siz imageSize, img *Image) {
+	for c := range t.components {
+		tc := &t.components[c]
+		info := siz.components[c]
+		out := &img.Components[c]
+		offsetX, offsetY := ceilDiv(siz.x0, info.dx), ceilDiv(siz.y0, info.dy)
+		var shift, low, high float64
+		if info.signed {
+			low, high = -math.Ldexp(1, info.precision-1), math.Ldexp(1, info.precision-1)-1
+		} else {
+			shift = math.Ldexp(1, info.precision-1)
+			low, high = 0, math.Ldexp(1, info.precision)-1
+		}
+		width := tc.x1 - tc.x0
+		for y := tc.y0; y < tc.y1; y++ {
+			for x := tc.x0; x < tc.x1; x++ {
+				v := math.Round(tc.samples[(y-tc.y0)*width+x-tc.x0] + shift)
+				if v < low {
+					v = low
+				} else if v > high {
+					v = high
+				}
+				out.Samples[(y-offsetY)*out.Width+x-offsetX] = int64(v)
+			}
+		}
+	}
+}
+
+// inverseComponentTransform undoes the multiple component transformation of the first three components (T.800 Annex G)
+func (t *tile) inverseComponentTransform(siz imageSize) {
+	if len(t.components) < 3 || t.components[0].style.mct == 0 {
+		return
+	}
+	c0, c1, c2 := t.components[0].samples, t.components[1].samples, t.components[2].samples
+	if len(c1) != len(c0) || len(c2) != len(c0) {
+		return
+	}
+	if t.components[0].style.reversible {
+		for i := range c0 {
+			g := c0[i] - math.Floor((c1[i]+c2[i])/4)
+			c0[i], c1[i], c2[i] = c2[i]+g, g, c1[i]+g
+		}
+		return
+	}
+	for i := range c0 {
+		y, cb, cr := c0[i], c1[i], c2[i]
+		c0[i] = y + 1.402*cr
+		c1[i] = y - 0.34413*cb - 0.71414*cr
+		c2[i] = y + 1.772*cb
+	}
+}
+
+// init computes the geometry of the resolutions, subbands, precincts and code-blocks of a tile-component
+func (tc *tileComponent) init(t *tile, info componentSize, style codingStyle, q quantization, roiShift int) error {
+	tc.x0, tc.y0 = ceilDiv(t.x0, info.dx), ceilDiv(t.y0, info.dy)
+	tc.x1, tc.y1 = ceilDiv(t.x1, info.dx), ceilDiv(t.y1, info.dy)
+	tc.style, tc.quantization, tc.roiShift = style, q, roiShift
+
+	levels := style.levels
+	for r := 0; r <= levels; r++ {
+		scale := levels - r
+		res := resolution{
+			x0:             ceilShift(tc.x0, scale),
+			y0:             ceilShift(tc.y0, scale),
+			x1:             ceilShift(tc.x1, scale),
+			y1:             ceilShift(tc.y1, scale),
+			precinctWidth:  style.precinctWidth[r],
+			precinctHeight: style.precinctHeight[r],
+		}
+		if r == 0 {
+			res.bands = []*band{tc.newBand(bandLL, levels, 0, info.precision)}
+		} else {
+			for orientation := bandHL; orientation <= bandHH; orientation++ {
+				res.bands = append(res.bands, tc.newBand(orientation, levels-r+1, r, info.precision))
+			}
+		}
+		for _, b := range res.bands {
+			if b.magnitudeBits < 0 {
+				return fmt.Errorf("jpeg2000: missing quantization step size")
+			}
+		}
+		if res.x1 > res.x0 {
+			res.precinctsWide = ceilShift(res.x1, res.precinctWidth) - res.x0>>uint(res.precinctWidth)
+		}
+		if res.y1 > res.y0 {
+			res.precinctsHigh = ceilShift(res.y1, res.precinctHeight) - res.y0>>uint(res.precinctHeight)
+		}
+		if res.precinctsWide*res.precinctsHigh > 1<<24 {
+			return fmt.Errorf("jpeg2000: too many precincts")
+		}
+		res.precincts = make([]precinct, res.precinctsWide*res.precinctsHigh)
+		for j := 0; j < res.precinctsHigh; j++ {
+			for i := 0; i < res.precinctsWide; i++ {
+				res.precincts[j*res.precinctsWide+i] = tc.newPrecinct(&res, r, i, j)
+			}
+		}
+		tc.resolutions = append(tc.resolutions, res)
+	}
+	return nil
+}
+
+// newBand creates a subband with its quantization parameters. levels is the number of
+// decomposition levels (nb) from the tile-component to the subband.
+func (tc *tileComponent) newBand(orientation, levels, r, precision int) *band {
+	xob, yob := 0, 0
+	if orientation == bandHL || orientation == bandHH {
+		xob = 1
+	}
+	if orientation == bandLH || orientation == bandHH {
+		yob = 1
+	}
+	b := &band{orientation: orientation}
+	if orientation == bandLL {
+		b.x0, b.y0 = ceilShift(tc.x0, levels), ceilShift(tc.y0, levels)
+		b.x1, b.y1 = ceilShift(tc.x1, levels), ceilShift(tc.y1, levels)
+	} else {
+		half := 1 << uint(levels-1)
+		b.x0, b.y0 = ceilShift(tc.x0-half*xob, levels), ceilShift(tc.y0-half*yob, levels)
+		b.x1, b.y1 = ceilShift(tc.x1-half*xob, levels), ceilShift(tc.y1-half*yob, levels)
+	}
+	if b.x1 > b.x0 && b.y1 > b.y0 {
+		b.coefficients = make([]float64, (b.x1-b.x0)*(b.y1-b.y0))
+	}
+
+	index := 0
+	if r > 0 {
+		index = 3*(r-1) + orientation
+	}
+	q := tc.quantization
+	var step stepSize
+	switch {
+	case q.style == 1:
+		step = q.steps[0]
+		step.exponent = step.exponent - tc.style.levels + levels
+	case index < len(q.steps):
+		step = q.steps[index]
+	default:
+		b.magnitudeBits = -1
+		return b
+	}
+	b.magnitudeBits = q.guardBits + step.exponent - 1 + tc.roiShift
+	b.step = 1
+	if q.style != 0 {
+		gain := [4]int{0, 1, 1, 2}[orientation]
+		b.step = math.Ldexp(1+float64(step.mantissa)/2048, precision+gain-step.exponent)
+	}
+	return b
+}
+
+// newPrecinct creates precinct (i, j) of a resolution with its code-blocks
+func (tc *tileComponent) newPrecinct(res *resolution, r, i, j int) precinct {
+	ppx, ppy := res.precinctWidth, res.precinctHeight
+	xcb, ycb := tc.style.codeBlockWidth, tc.style.codeBlockHeight
+	if r > 0 {
+		ppx, ppy = ppx-1, ppy-1
+	}
+	xcb, ycb = minInt(xcb, ppx), minInt(ycb, ppy)
+
+	var p precinct
+	for _, b := range res.bands {
+		// the precinct partition is anchored at 0 in subband coordinates too
+		px0 := (res.x0>>uint(res.precinctWidth) + i) << uint(ppx)
+		py0 := (res.y0>>uint(res.precinctHeight) + j) << uint(ppy)
+		px1, py1 := px0+1<<uint(ppx), py0+1<<uint(ppy)
+		px0, py0 = maxInt(px0, b.x0), maxInt(py0, b.y0)
+		px1, py1 = minInt(px1, b.x1), minInt(py1, b.y1)
+
+		pb := precinctBand{band: b}
+		if px1 > px0 && py1 > py0 {
+			cbx0, cby0 := px0>>uint(xcb), py0>>uint(ycb)
+			pb.blocksWide = ceilShift(px1, xcb) - cbx0
+			pb.blocksHigh = ceilShift(py1, ycb) - cby0
+			for n := 0; n < pb.blocksHigh; n++ {
+				for m := 0; m < pb.blocksWide; m++ {
+					x0, y0 := (cbx0+m)<<uint(xcb), (cby0+n)<<uint(ycb)
+					pb.blocks = append(pb.blocks, codeBlock{
+						x0: maxInt(x0, px0), y0: maxInt(y0, py0),
+						x1: minInt(x0+1<<uint(xcb), px1), y1: minInt(y0+1<<uint(ycb), py1),
+					})
+				}
+			}
+		}
+		pb.inclusion = newTagTree(pb.blocksWide, pb.blocksHigh)
+		pb.zeroBitPlanes = newTagTree(pb.blocksWide, pb.blocksHigh)
+		p.bands = append(p.bands, pb)
+	}
+	return p
+}
+
+// reconstruct decodes the code-blocks, dequantizes and applies the inverse wavelet transform
+func (tc *tileComponent) reconstruct() error {
+	for r := range tc.resolutions {
+		res := &tc.resolutions[r]
+		for p := range res.precincts {
+			for _, pb := range res.precincts[p].bands {
+				if err := tc.decodeBlocks(pb); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	ll := tc.resolutions[0].bands[0]
+	samples := ll.coefficients
+	for r := 1; r < len(tc.resolutions); r++ {
+		res := &tc.resolutions[r]
+		width, height := res.x1-res.x0, res.y1-res.y0
+		interleaved := make([]float64, width*height)
+		low := &band{x0: tc.resolutions[r-1].x0, y0: tc.resolutions[r-1].y0, x1: tc.resolutions[r-1].x1, y1: tc.resolutions[r-1].y1, coefficients: samples}
+		for _, b := range append([]*band{low}, res.bands...) {
+			xob, yob := 0, 0
+			if b.orientation == bandHL || b.orientation == bandHH {
+				xob = 1
+			}
+			if b.orientation == bandLH || b.orientation == bandHH {
+				yob = 1
+			}
+			bw := b.x1 - b.x0
+			for y := b.y0; y < b.y1; y++ {
+				for x := b.x0; x < b.x1; x++ {
+					ix, iy := 2*x+xob-res.x0, 2*y+yob-res.y0
+					if ix < 0 || ix >= width || iy < 0 || iy >= height {
+						continue
+					}
+					interleaved[iy*width+ix] = b.coefficients[(y-b.y0)*bw+x-b.x0]
+				}
+			}
+		}
+		if width > 0 && height > 0 {
+			synthesize2D(interleaved, width, height, res.x0, res.y0, tc.style.reversible)
+		}
+		samples = interleaved
+	}
+	tc.samples = samples
+	if tc.samples == nil {
+		tc.samples = []float64{}
+	}
+	return nil
+}
+
+// decodeBlocks decodes the code-blocks of a subband inside a precinct into the subband coefficients
+func (tc *tileComponent) decodeBlocks(pb precinctBand) error {
+	b := pb.band
+	bw := b.x1 - b.x0
+	for i := range pb.blocks {
+		block := &pb.blocks[i]
+		if block.passes == 0 {
+			continue
+		}
+		width, height := block.x1-block.x0, block.y1-block.y0
+		values := make([]float64, width*height)
+		bitPlanes := b.magnitudeBits - block.zeroBitPlanes
+		if err := decodeBlock(block.segments, width, height, b.orientation, tc.style.codeBlockStyle, bitPlanes, tc.style.reversible, values); err != nil {
+			return err
+		}
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				v := values[y*width+x]
+				if tc.roiShift > 0 {
+					if magnitude := math.Abs(v); magnitude >= math.Ldexp(1, tc.roiShift) {
+						v = math.Copysign(math.Ldexp(magnitude, -tc.roiShift), v)
+					}
+				}
+				b.coefficients[(block.y0-b.y0+y)*bw+block.x0-b.x0+x] = v * b.step
+			}
+		}
+	}
+	return nil
+}
+
+// packet identifies one packet of a tile
+type packet struct {
+	layer, resolution, component, precinct int
+}
+
+// packets lists the packets of the tile in the order of its progression (T.800 B.12)
+func (t *tile) packets(siz imageSize) []packet {
+	style := t.components[0].style
+	layers := style.layers
+	maxResolutions := 0
+	for _, tc := range t.components {
+		maxResolutions = maxInt(maxResolutions, len(tc.resolutions))
+	}
+
+	// every precinct, with the position on the reference grid where the progression visits it
+	type located struct {
+		packet
+		x, y int
+	}
+	var precincts []located
+	for c := range t.components {
+		tc := &t.components[c]
+		info := siz.components[c]
+		for r := range tc.resolutions {
+			res := &tc.resolutions[r]
+			scale := uint(len(tc.resolutions) - 1 - r)
+			for j := 0; j < res.precinctsHigh; j++ {
+				y := (res.y0>>uint(res.precinctHeight) + j) << uint(res.precinctHeight)
+				if j == 0 {
+					y = res.y0
+				}
+				for i := 0; i < res.precinctsWide; i++ {
+					x := (res.x0>>uint(res.precinctWidth) + i) << uint(res.precinctWidth)
+					if i == 0 {
+						x = res.x0
+					}
+					precincts = append(precincts, located{
+						packet: packet{resolution: r, component: c, precinct: j*res.precinctsWide + i},
+						x:      maxInt(x<<scale*info.dx, t.x0),
+						y:      maxInt(y<<scale*info.dy, t.y0),
+					})
+				}
+			}
+		}
+	}
+
+	var keys func(l located) [4]int
+	switch style.progression {
+	case progressionRPCL:
+		keys = func(l located) [4]int { return [4]int{l.resolution, l.y, l.x, l.component} }
+	case progressionPCRL:
+		keys = func(l located) [4]int { return [4]int{l.y, l.x, l.component, l.resolution} }
+	case progressionCPRL:
+		keys = func(l located) [4]int { return [4]int{l.component, l.y, l.x, l.resolution} }
+	default:
+		keys = func(l located) [4]int { return [4]int{l.resolution, l.component, l.precinct, 0} }
+	}
+	sort.SliceStable(precincts, func(a, b int) bool {
+		ka, kb := keys(precincts[a]), keys(precincts[b])
+		for i := range ka {
+			if ka[i] != kb[i] {
+				return ka[i] < kb[i]
+			}
+		}
+		return false
+	})
+
+	var packets []packet
+	switch style.progression {
+	case progressionLRCP:
+		for l := 0; l < layers; l++ {
+			for _, p := range precincts {
+				p.layer = l
+				packets = append(packets, p.packet)
+			}
+		}
+	case progressionRLCP:
+		for r := 0; r < maxResolutions; r++ {
+			for l := 0; l < layers; l++ {
+				for _, p := range precincts {
+					if p.resolution == r {
+						p.layer = l
+						packets = append(packets, p.packet)
+					}
+				}
+			}
+		}
+	default:
+		for _, p := range precincts {
+			for l := 0; l < layers; l++ {
+				p.layer = l
+				packets = append(packets, p.packet)
+			}
+		}
+	}
+	return packets
+}
+
+// ceilShift returns ceil(v / 2^n), also for negative v
+func ceilShift(v int, n int) int {
+	d := 1 << uint(n)
+	if v >= 0 {
+		return (v + d - 1) / d
+	}
+	return -((-v) / d)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
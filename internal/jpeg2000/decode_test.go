@@ -0,0 +1,191 @@
+package jpeg2000
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_mq_round_trip(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	bits := make([]uint8, 5000)
+	labels := make([]int, len(bits))
+	for i := range bits {
+		labels[i] = random.Intn(contextCount)
+		// skewed decisions, so that the probability estimation moves through the states
+		if random.Intn(10) < 1+labels[i]%5 {
+			bits[i] = 1
+		}
+	}
+
+	var contexts [contextCount]context
+	encoder := newMQEncoder()
+	for i, bit := range bits {
+		encoder.encode(&contexts[labels[i]], bit)
+	}
+	data := encoder.flush()
+
+	contexts = [contextCount]context{}
+	var decoder mqDecoder
+	decoder.init(data)
+	for i, bit := range bits {
+		require.Equal(t, bit, decoder.decode(&contexts[labels[i]]), "decision %d", i)
+	}
+}
+
+func Test_mq_reference_sequence(t *testing.T) {
+	// the test sequence of the MQ-coder in ITU-T T.88 Annex H.2, coded in a single context from state 0. The
+	// MQ-coder of JPEG2000 is the same, so the sequence checks the decoder against an encoder other than ours.
+	decisions, err := hex.DecodeString("00020051000000C00352872AAAAAAAAA82C02000FCD79EF6BF7FED904F46A3BF")
+	require.NoError(t, err)
+	coded, err := hex.DecodeString("84C73BFCE1A1430402200000410DBB86F4317FFF88FF37471ADB6ADFFFAC")
+	require.NoError(t, err)
+
+	var cx context
+	var decoder mqDecoder
+	decoder.init(coded)
+	decoded := make([]byte, len(decisions))
+	for i := range decoded {
+		for bit := 0; bit < 8; bit++ {
+			decoded[i] = decoded[i]<<1 | decoder.decode(&cx)
+		}
+	}
+	assert.Equal(t, decisions, decoded)
+}
+
+func Test_dwt_round_trip(t *testing.T) {
+	for _, start := range []int{0, 1, 2, 7} {
+		for n := 1; n < 12; n++ {
+			signal := make([]float64, n)
+			for i := range signal {
+				signal[i] = float64((i*37)%23 - 11)
+			}
+			transformed := append([]float64{}, signal...)
+			analyze(transformed, start)
+			synthesize(transformed, start, true)
+			assert.Equal(t, signal, transformed, "length %d starting at %d", n, start)
+		}
+	}
+}
+
+// testImage returns a smooth field with some noise, like a meteorological field
+func testImage(width, height, precision int, signed bool, seed int64) []int64 {
+	random := rand.New(rand.NewSource(seed))
+	low, high := 0.0, math.Ldexp(1, precision)-1
+	if signed {
+		low, high = -math.Ldexp(1, precision-1), math.Ldexp(1, precision-1)-1
+	}
+	samples := make([]int64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := (math.Sin(float64(x)/7)*math.Cos(float64(y)/5)+1)/2*(high-low) + low
+			v += (random.Float64() - 0.5) * (high - low) / 8
+			samples[y*width+x] = int64(math.Max(low, math.Min(high, math.Round(v))))
+		}
+	}
+	return samples
+}
+
+func Test_decode_lossless(t *testing.T) {
+	cases := []struct {
+		name      string
+		precision int
+		signed    bool
+		options   encodeOptions
+	}{
+		{"single block", 8, false, encodeOptions{width: 20, height: 13, levels: 2}},
+		{"no transform", 8, false, encodeOptions{width: 20, height: 13}},
+		{"odd offset", 12, false, encodeOptions{width: 37, height: 29, x0: 3, y0: 5, levels: 3, codeBlock: 3}},
+		{"signed", 16, true, encodeOptions{width: 33, height: 17, levels: 2, codeBlock: 4}},
+		{"one pixel", 8, false, encodeOptions{width: 1, height: 1, levels: 1}},
+		{"single row", 10, false, encodeOptions{width: 40, height: 1, x0: 1, levels: 3, codeBlock: 2}},
+		{"tiles", 12, false, encodeOptions{width: 50, height: 41, x0: 7, y0: 2, tileWidth: 16, tileHeight: 12, tileX0: 5, tileY0: 1, levels: 2, codeBlock: 3}},
+		{"precincts LRCP", 8, false, encodeOptions{width: 45, height: 38, levels: 3, codeBlock: 2, precincts: []int{2, 3, 3, 4}}},
+		{"precincts RLCP", 8, false, encodeOptions{width: 45, height: 38, y0: 3, levels: 3, codeBlock: 2, precincts: []int{2, 3, 3, 4}, progression: progressionRLCP}},
+		{"precincts RPCL", 8, false, encodeOptions{width: 45, height: 38, x0: 1, levels: 3, codeBlock: 2, precincts: []int{2, 3, 3, 4}, progression: progressionRPCL}},
+		{"precincts PCRL", 8, false, encodeOptions{width: 45, height: 38, levels: 3, codeBlock: 2, precincts: []int{2, 3, 3, 4}, progression: progressionPCRL}},
+		{"precincts CPRL", 8, false, encodeOptions{width: 45, height: 38, levels: 3, codeBlock: 2, precincts: []int{2, 3, 3, 4}, progression: progressionCPRL}},
+		{"layers", 12, false, encodeOptions{width: 30, height: 30, levels: 2, codeBlock: 3, layers: 3, style: styleTerminateAll}},
+		{"bypass", 16, false, encodeOptions{width: 30, height: 22, levels: 2, codeBlock: 4, style: styleBypass}},
+		{"all code-block styles", 16, false, encodeOptions{width: 30, height: 22, levels: 2, codeBlock: 4, layers: 2,
+			style: styleBypass | styleReset | styleTerminateAll | styleVerticallyCausal | styleSegmentationSymbol}},
+		{"markers and tile-parts", 8, false, encodeOptions{width: 30, height: 22, levels: 2, codeBlock: 3, sop: true, eph: true, tileParts: 3}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			samples := testImage(c.options.width, c.options.height, c.precision, c.signed, 1)
+			components := []testComponent{{precision: c.precision, signed: c.signed, dx: 1, dy: 1, samples: samples}}
+
+			img, err := Decode(encode(t, components, c.options))
+			require.NoError(t, err)
+			assert.Equal(t, c.options.width, img.Width)
+			assert.Equal(t, c.options.height, img.Height)
+			require.Len(t, img.Components, 1)
+			assert.Equal(t, c.precision, img.Components[0].Precision)
+			assert.Equal(t, c.signed, img.Components[0].Signed)
+			assert.Equal(t, samples, img.Components[0].Samples)
+		})
+	}
+}
+
+func Test_decode_components(t *testing.T) {
+	options := encodeOptions{width: 27, height: 19, x0: 1, levels: 2, codeBlock: 3, mct: true, progression: progressionCPRL}
+	var components []testComponent
+	for c := 0; c < 3; c++ {
+		components = append(components, testComponent{precision: 8, dx: 1, dy: 1, samples: testImage(27, 19, 8, false, int64(c))})
+	}
+	// a subsampled component, not part of the component transform
+	components = append(components, testComponent{precision: 8, dx: 2, dy: 3, samples: testImage(13, 7, 8, false, 4)})
+
+	img, err := Decode(encode(t, components, options))
+	require.NoError(t, err)
+	require.Len(t, img.Components, 4)
+	for c, component := range components {
+		assert.Equal(t, component.samples, img.Components[c].Samples, "component %d", c)
+	}
+	assert.Equal(t, 13, img.Components[3].Width)
+	assert.Equal(t, 7, img.Components[3].Height)
+}
+
+func Test_decode_jp2(t *testing.T) {
+	samples := testImage(10, 10, 8, false, 1)
+	codestream := encode(t, []testComponent{{precision: 8, dx: 1, dy: 1, samples: samples}}, encodeOptions{width: 10, height: 10, levels: 1})
+
+	box := func(boxType string, content []byte) []byte {
+		b := binary.BigEndian.AppendUint32(nil, uint32(8+len(content)))
+		return append(append(b, boxType...), content...)
+	}
+	var file []byte
+	file = append(file, box("jP  ", []byte{0x0D, 0x0A, 0x87, 0x0A})...)
+	file = append(file, box("ftyp", []byte("jp2 \x00\x00\x00\x00jp2 "))...)
+	file = append(file, box("jp2h", nil)...)
+	file = append(file, box("jp2c", codestream)...)
+
+	img, err := Decode(file)
+	require.NoError(t, err)
+	assert.Equal(t, samples, img.Components[0].Samples)
+}
+
+func Test_decode_corrupt(t *testing.T) {
+	samples := testImage(30, 30, 12, false, 1)
+	codestream := encode(t, []testComponent{{precision: 12, dx: 1, dy: 1, samples: samples}}, encodeOptions{width: 30, height: 30, levels: 2, codeBlock: 3})
+
+	for _, length := range []int{0, 1, 10, 50, 80, len(codestream) / 2, len(codestream) - 3} {
+		assert.NotPanics(t, func() {
+			_, err := Decode(codestream[:length])
+			assert.Error(t, err, "codestream cut at %d", length)
+		})
+	}
+
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		corrupt := append([]byte{}, codestream...)
+		corrupt[90+random.Intn(len(corrupt)-90)] ^= byte(1 + random.Intn(255))
+		assert.NotPanics(t, func() { _, _ = Decode(corrupt) })
+	}
+}
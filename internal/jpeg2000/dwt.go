@@ -0,0 +1,112 @@
+package jpeg2000
+
+import "math"
+
+// Lifting parameters of the irreversible 9-7 filter, see T.800 Table F.4
+const (
+	liftAlpha = -1.586134342059924
+	liftBeta  = -0.052980118572961
+	liftGamma = 0.882911075530934
+	liftDelta = 0.443506852043971
+	liftK     = 1.230174104914001
+)
+
+// extend returns signal surrounded by pad samples of periodic symmetric extension (T.800 F.3.7)
+func extend(signal []float64, pad int) []float64 {
+	n := len(signal)
+	extended := make([]float64, n+2*pad)
+	period := 2 * (n - 1)
+	for i := range extended {
+		j := i - pad
+		if period > 0 {
+			j %= period
+			if j < 0 {
+				j += period
+			}
+			if j >= n {
+				j = period - j
+			}
+		} else {
+			j = 0
+		}
+		extended[i] = signal[j]
+	}
+	return extended
+}
+
+// synthesize performs the one dimensional inverse transform of the interleaved signal, in place.
+// start is the coordinate of the first sample, its parity tells if it is a low or high pass sample.
+func synthesize(signal []float64, start int, reversible bool) {
+	n := len(signal)
+	if n == 0 {
+		return
+	}
+	if n == 1 {
+		if start%2 != 0 {
+			if reversible {
+				signal[0] = math.Trunc(signal[0] / 2)
+			} else {
+				signal[0] /= 2
+			}
+		}
+		return
+	}
+
+	pad := 4
+	x := extend(signal, pad)
+	// first sample of x that is low pass (even coordinate)
+	even := (start - pad) & 1
+
+	if reversible {
+		for i := 1 + (1 ^ even); i < len(x)-1; i += 2 {
+			x[i] -= math.Floor((x[i-1] + x[i+1] + 2) / 4)
+		}
+		for i := 1 + even; i < len(x)-1; i += 2 {
+			x[i] += math.Floor((x[i-1] + x[i+1]) / 2)
+		}
+	} else {
+		// even is 0 when x[0] is low pass, low pass samples are at i%2 == even
+		for i := even; i < len(x); i += 2 {
+			x[i] *= liftK
+		}
+		for i := 1 - even; i < len(x); i += 2 {
+			x[i] /= liftK
+		}
+		lift(x, even, liftDelta)
+		lift(x, 1-even, liftGamma)
+		lift(x, even, liftBeta)
+		lift(x, 1-even, liftAlpha)
+	}
+	copy(signal, x[pad:pad+n])
+}
+
+// lift subtracts factor times the sum of the neighbours from every second sample starting at first
+func lift(x []float64, first int, factor float64) {
+	if first == 0 {
+		first = 2
+	}
+	for i := first; i < len(x)-1; i += 2 {
+		x[i] -= factor * (x[i-1] + x[i+1])
+	}
+}
+
+// synthesize2D performs one level of the two dimensional inverse transform on the interleaved
+// samples of a resolution with origin (x0, y0), rows then columns (T.800 F.3.2)
+func synthesize2D(samples []float64, width, height, x0, y0 int, reversible bool) {
+	row := make([]float64, width)
+	for y := 0; y < height; y++ {
+		copy(row, samples[y*width:(y+1)*width])
+		synthesize(row, x0, reversible)
+		copy(samples[y*width:], row)
+	}
+	column := make([]float64, height)
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			column[y] = samples[y*width+x]
+		}
+		synthesize(column, y0, reversible)
+		for y := 0; y < height; y++ {
+			samples[y*width+x] = column[y]
+		}
+	}
+}
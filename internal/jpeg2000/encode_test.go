@@ -0,0 +1,862 @@
+package jpeg2000
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// This file holds a small lossless (5-3 reversible) JPEG 2000 encoder, it only exists to produce
+// codestreams for the decoder tests. It reuses the geometry of the decoder, so code-blocks,
+// precincts and the packet order are computed the same way on both sides.
+
+// mqEncoder is the arithmetic encoder of T.800 Annex C
+type mqEncoder struct {
+	out []byte // out[0] is a placeholder for the byte before the first one
+	a   uint32
+	c   uint32
+	ct  int
+}
+
+func newMQEncoder() *mqEncoder {
+	return &mqEncoder{out: []byte{0}, a: 0x8000, ct: 12}
+}
+
+func (e *mqEncoder) encode(cx *context, bit uint8) {
+	entry := &qeTable[cx.index]
+	qe := entry.qe
+	e.a -= qe
+	if bit == cx.mps {
+		if e.a&0x8000 != 0 {
+			e.c += qe
+			return
+		}
+		if e.a < qe {
+			e.a = qe
+		} else {
+			e.c += qe
+		}
+		cx.index = entry.nmps
+	} else {
+		if e.a < qe {
+			e.c += qe
+		} else {
+			e.a = qe
+		}
+		if entry.switches {
+			cx.mps = 1 - cx.mps
+		}
+		cx.index = entry.nlps
+	}
+	for {
+		e.a <<= 1
+		e.c <<= 1
+		e.ct--
+		if e.ct == 0 {
+			e.byteOut()
+		}
+		if e.a&0x8000 != 0 {
+			return
+		}
+	}
+}
+
+func (e *mqEncoder) byteOut() {
+	last := len(e.out) - 1
+	if e.out[last] == 0xFF {
+		e.out = append(e.out, byte(e.c>>20))
+		e.c &= 0xFFFFF
+		e.ct = 7
+		return
+	}
+	if e.c&0x8000000 != 0 {
+		e.out[last]++
+		if e.out[last] == 0xFF {
+			e.c &= 0x7FFFFFF
+			e.out = append(e.out, byte(e.c>>20))
+			e.c &= 0xFFFFF
+			e.ct = 7
+			return
+		}
+	}
+	e.out = append(e.out, byte(e.c>>19))
+	e.c &= 0x7FFFF
+	e.ct = 8
+}
+
+// flush terminates the codeword and returns it
+func (e *mqEncoder) flush() []byte {
+	top := e.c + e.a
+	e.c |= 0xFFFF
+	if e.c >= top {
+		e.c -= 0x8000
+	}
+	e.c <<= uint(e.ct)
+	e.byteOut()
+	e.c <<= uint(e.ct)
+	e.byteOut()
+	out := e.out[1:]
+	if out[len(out)-1] == 0xFF {
+		out = out[:len(out)-1]
+	}
+	return out
+}
+
+// rawEncoder writes the raw bits of bypassed coding passes
+type rawEncoder struct {
+	out   []byte
+	buf   byte
+	count int
+	limit int
+}
+
+func (e *rawEncoder) encode(bit uint8) {
+	if e.limit == 0 {
+		e.limit = 8
+	}
+	e.buf = e.buf<<1 | bit
+	e.count++
+	if e.count == e.limit {
+		e.out = append(e.out, e.buf)
+		e.limit = 8
+		if e.buf == 0xFF {
+			e.limit = 7
+		}
+		e.buf, e.count = 0, 0
+	}
+}
+
+func (e *rawEncoder) flush() []byte {
+	if e.count > 0 {
+		e.out = append(e.out, e.buf<<uint(e.limit-e.count))
+	}
+	// a pass may have no bits, but it still ends a segment
+	return append([]byte{}, e.out...)
+}
+
+// blockEncoder codes the coefficients of one code-block, it keeps its state in a blockDecoder
+type blockEncoder struct {
+	blockDecoder
+	mqe    *mqEncoder
+	rawe   *rawEncoder
+	signs  []bool
+	passes [][]byte
+}
+
+// encodeBlock codes a code-block and returns the number of zero bit planes and the data of
+// its coding passes. The data of a codeword segment is found at its last pass, the other
+// passes of the segment have no data.
+func encodeBlock(coefficients []int64, width, height, orientation, style, magnitudeBits int) (int, [][]byte) {
+	var largest uint64
+	magnitudes := make([]uint64, len(coefficients))
+	signs := make([]bool, len(coefficients))
+	for i, v := range coefficients {
+		if v < 0 {
+			magnitudes[i], signs[i] = uint64(-v), true
+		} else {
+			magnitudes[i] = uint64(v)
+		}
+		if magnitudes[i] > largest {
+			largest = magnitudes[i]
+		}
+	}
+	bitPlanes := 0
+	for largest>>uint(bitPlanes) != 0 {
+		bitPlanes++
+	}
+	if bitPlanes == 0 {
+		return 0, nil
+	}
+
+	e := blockEncoder{
+		blockDecoder: blockDecoder{
+			width:       width,
+			height:      height,
+			stride:      width + 2,
+			flags:       make([]uint8, (width+2)*(height+2)),
+			magnitudes:  magnitudes,
+			orientation: orientation,
+			style:       style,
+		},
+		signs: signs,
+	}
+	e.resetContexts()
+
+	if bitPlanes > magnitudeBits {
+		panic("too few guard bits")
+	}
+	passes, first := 3*bitPlanes-2, 0
+	for pass := 0; pass < passes; pass++ {
+		if pass == first {
+			e.useRaw = isRawPass(style, pass)
+			if e.useRaw {
+				e.rawe = &rawEncoder{}
+			} else {
+				e.mqe = newMQEncoder()
+			}
+		}
+		plane := bitPlanes - 1 - (pass+2)/3
+		switch passType(pass) {
+		case passSignificance:
+			e.significancePass(plane)
+		case passRefinement:
+			e.refinementPass(plane)
+		case passCleanup:
+			e.cleanupPass(plane)
+			if style&styleSegmentationSymbol != 0 {
+				for _, bit := range []uint8{1, 0, 1, 0} {
+					e.mqe.encode(&e.contexts[contextUniform], bit)
+				}
+			}
+		}
+		if style&styleReset != 0 {
+			e.resetContexts()
+		}
+		if pass-first+1 == segmentMaxPasses(style, first) || pass == passes-1 {
+			e.terminate()
+			first = pass + 1
+		} else {
+			e.passes = append(e.passes, nil)
+		}
+	}
+	return magnitudeBits - bitPlanes, e.passes
+}
+
+func (e *blockEncoder) terminate() {
+	if e.useRaw {
+		e.passes = append(e.passes, e.rawe.flush())
+	} else {
+		e.passes = append(e.passes, e.mqe.flush())
+	}
+	e.mqe, e.rawe = nil, nil
+}
+
+func (e *blockEncoder) bit(x, y, plane int) uint8 {
+	return uint8(e.magnitudes[y*e.width+x]>>uint(plane)) & 1
+}
+
+func (e *blockEncoder) encodeBit(label uint8, bit uint8) {
+	if e.useRaw {
+		e.rawe.encode(bit)
+	} else {
+		e.mqe.encode(&e.contexts[label], bit)
+	}
+}
+
+// encodeSign mirrors blockDecoder.decodeSign
+func (e *blockEncoder) encodeSign(x, y int) {
+	i := (y+1)*e.stride + x + 1
+	var negative uint8
+	if e.signs[y*e.width+x] {
+		negative = 1
+	}
+	if e.useRaw {
+		e.rawe.encode(negative)
+	} else {
+		f := e.flags
+		h := clampContribution(signContribution(f[i-1]) + signContribution(f[i+1]))
+		below := 0
+		if !e.causalBoundary(y) {
+			below = signContribution(f[i+e.stride])
+		}
+		v := clampContribution(signContribution(f[i-e.stride]) + below)
+		var label int
+		var xor uint8
+		if h < 0 {
+			h, v, xor = -h, -v, 1
+		}
+		if h == 0 {
+			label = 9 + abs(v)
+			if v < 0 {
+				xor = 1
+			}
+		} else {
+			label = 12 + v
+		}
+		e.mqe.encode(&e.contexts[label], negative^xor)
+	}
+	e.flags[i] |= flagSignificant
+	if negative != 0 {
+		e.flags[i] |= flagNegative
+	}
+}
+
+func (e *blockEncoder) significancePass(plane int) {
+	for y0 := 0; y0 < e.height; y0 += 4 {
+		for x := 0; x < e.width; x++ {
+			for y := y0; y < y0+4 && y < e.height; y++ {
+				i := (y+1)*e.stride + x + 1
+				if e.flags[i]&flagSignificant != 0 {
+					continue
+				}
+				label := e.zeroCodingContext(x, y)
+				if label == 0 {
+					continue
+				}
+				bit := e.bit(x, y, plane)
+				e.encodeBit(label, bit)
+				if bit != 0 {
+					e.encodeSign(x, y)
+				}
+				e.flags[i] |= flagVisited
+			}
+		}
+	}
+}
+
+func (e *blockEncoder) refinementPass(plane int) {
+	for y0 := 0; y0 < e.height; y0 += 4 {
+		for x := 0; x < e.width; x++ {
+			for y := y0; y < y0+4 && y < e.height; y++ {
+				i := (y+1)*e.stride + x + 1
+				if e.flags[i]&(flagSignificant|flagVisited) != flagSignificant {
+					continue
+				}
+				var label uint8 = 14
+				if e.flags[i]&flagRefined != 0 {
+					label = 16
+				} else if h, v, d := e.neighbours(x, y); h+v+d > 0 {
+					label = 15
+				}
+				e.encodeBit(label, e.bit(x, y, plane))
+				e.flags[i] |= flagRefined
+			}
+		}
+	}
+}
+
+func (e *blockEncoder) cleanupPass(plane int) {
+	for y0 := 0; y0 < e.height; y0 += 4 {
+		for x := 0; x < e.width; x++ {
+			start := y0
+			if y0+4 <= e.height && e.runLengthEligible(x, y0) {
+				r := 0
+				for r < 4 && e.bit(x, y0+r, plane) == 0 {
+					r++
+				}
+				if r == 4 {
+					e.mqe.encode(&e.contexts[contextRunLength], 0)
+					continue
+				}
+				e.mqe.encode(&e.contexts[contextRunLength], 1)
+				e.mqe.encode(&e.contexts[contextUniform], uint8(r>>1))
+				e.mqe.encode(&e.contexts[contextUniform], uint8(r&1))
+				e.encodeSign(x, y0+r)
+				start = y0 + r + 1
+			}
+			for y := start; y < y0+4 && y < e.height; y++ {
+				i := (y+1)*e.stride + x + 1
+				if e.flags[i]&(flagSignificant|flagVisited) != 0 {
+					continue
+				}
+				bit := e.bit(x, y, plane)
+				e.mqe.encode(&e.contexts[e.zeroCodingContext(x, y)], bit)
+				if bit != 0 {
+					e.encodeSign(x, y)
+				}
+			}
+			for y := y0; y < y0+4 && y < e.height; y++ {
+				e.flags[(y+1)*e.stride+x+1] &^= flagVisited
+			}
+		}
+	}
+}
+
+// analyze performs the one dimensional forward 5-3 transform, the inverse of synthesize
+func analyze(signal []float64, start int) {
+	n := len(signal)
+	if n == 0 {
+		return
+	}
+	if n == 1 {
+		if start%2 != 0 {
+			signal[0] *= 2
+		}
+		return
+	}
+	pad := 4
+	x := extend(signal, pad)
+	even := (start - pad) & 1
+	for i := 1 + even; i < len(x)-1; i += 2 {
+		x[i] -= math.Floor((x[i-1] + x[i+1]) / 2)
+	}
+	for i := 1 + (1 ^ even); i < len(x)-1; i += 2 {
+		x[i] += math.Floor((x[i-1] + x[i+1] + 2) / 4)
+	}
+	copy(signal, x[pad:pad+n])
+}
+
+// analyze2D performs one level of the forward transform, columns then rows
+func analyze2D(samples []float64, width, height, x0, y0 int) {
+	column := make([]float64, height)
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			column[y] = samples[y*width+x]
+		}
+		analyze(column, y0)
+		for y := 0; y < height; y++ {
+			samples[y*width+x] = column[y]
+		}
+	}
+	for y := 0; y < height; y++ {
+		analyze(samples[y*width:(y+1)*width], x0)
+	}
+}
+
+// tagEncoder writes the values of a tag tree
+type tagEncoder struct {
+	tree *tagTree
+	sent [][]bool
+}
+
+func newTagEncoder(width, height int, values []int) *tagEncoder {
+	e := &tagEncoder{tree: newTagTree(width, height)}
+	for l := range e.tree.levels {
+		level := &e.tree.levels[l]
+		e.sent = append(e.sent, make([]bool, len(level.nodes)))
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := values[y*width+x]
+			for l := range e.tree.levels {
+				level := &e.tree.levels[l]
+				node := &level.nodes[(y>>uint(l))*level.width+(x>>uint(l))]
+				if v < node.value {
+					node.value = v
+				}
+			}
+		}
+	}
+	return e
+}
+
+// encode writes the bits telling if the value of leaf (x, y) is below threshold
+func (e *tagEncoder) encode(w *headerWriter, x, y, threshold int) {
+	low := 0
+	for l := len(e.tree.levels) - 1; l >= 0; l-- {
+		level := &e.tree.levels[l]
+		i := (y>>uint(l))*level.width + (x >> uint(l))
+		node := &level.nodes[i]
+		if low > node.low {
+			node.low = low
+		} else {
+			low = node.low
+		}
+		for low < threshold {
+			if low >= node.value {
+				if !e.sent[l][i] {
+					w.bit(1)
+					e.sent[l][i] = true
+				}
+				break
+			}
+			w.bit(0)
+			low++
+		}
+		node.low = low
+	}
+}
+
+// headerWriter writes packet headers with bit stuffing
+type headerWriter struct {
+	out   []byte
+	buf   byte
+	count int
+	limit int
+}
+
+func (w *headerWriter) bit(b int) {
+	if w.limit == 0 {
+		w.limit = 8
+	}
+	w.buf = w.buf<<1 | byte(b)
+	w.count++
+	if w.count == w.limit {
+		w.out = append(w.out, w.buf)
+		w.limit = 8
+		if w.buf == 0xFF {
+			w.limit = 7
+		}
+		w.buf, w.count = 0, 0
+	}
+}
+
+func (w *headerWriter) bits(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.bit(v >> uint(i) & 1)
+	}
+}
+
+func (w *headerWriter) flush() []byte {
+	if w.count > 0 {
+		w.out = append(w.out, w.buf<<uint(w.limit-w.count))
+	}
+	if len(w.out) > 0 && w.out[len(w.out)-1] == 0xFF {
+		w.out = append(w.out, 0)
+	}
+	return w.out
+}
+
+// passCount writes the number of new coding passes, see T.800 Table B.4
+func (w *headerWriter) passCount(n int) {
+	switch {
+	case n == 1:
+		w.bit(0)
+	case n == 2:
+		w.bits(2, 2)
+	case n <= 5:
+		w.bits(3, 2)
+		w.bits(n-3, 2)
+	case n <= 36:
+		w.bits(15, 4)
+		w.bits(n-6, 5)
+	default:
+		w.bits(511, 9)
+		w.bits(n-37, 7)
+	}
+}
+
+// testComponent is one component of an image to encode
+type testComponent struct {
+	precision int
+	signed    bool
+	dx, dy    int
+	samples   []int64 // raster order over the component
+}
+
+// encodeOptions describes the codestream written by encode
+type encodeOptions struct {
+	width, height         int // image size, Xsiz-XOsiz and Ysiz-YOsiz
+	x0, y0                int // image offset
+	tileWidth, tileHeight int // 0 for a single tile
+	tileX0, tileY0        int
+	levels                int
+	codeBlock             int   // code-block size exponent
+	precincts             []int // precinct size exponent per resolution level, nil for the maximum
+	style                 int   // code-block style
+	progression           int
+	layers                int // more than one requires styleTerminateAll
+	mct                   bool
+	sop, eph              bool
+	tileParts             int // number of tile-parts per tile
+	guardBits             int
+}
+
+// encodedBlock is a code-block after tier-1 coding
+type encodedBlock struct {
+	zeroBitPlanes int
+	passes        [][]byte
+}
+
+// layerPasses returns the range of passes of a code-block that go into layer
+func (b *encodedBlock) layerPasses(layer, layers int) (int, int) {
+	n := len(b.passes)
+	return layer * n / layers, (layer + 1) * n / layers
+}
+
+// encode writes a lossless codestream of the components
+func encode(t *testing.T, components []testComponent, o encodeOptions) []byte {
+	t.Helper()
+	if o.tileWidth == 0 {
+		o.tileWidth, o.tileHeight, o.tileX0, o.tileY0 = o.width+o.x0, o.height+o.y0, 0, 0
+	}
+	if o.layers == 0 {
+		o.layers = 1
+	}
+	if o.tileParts == 0 {
+		o.tileParts = 1
+	}
+	if o.guardBits == 0 {
+		o.guardBits = 2
+	}
+	if o.codeBlock == 0 {
+		o.codeBlock = 6
+	}
+
+	var out []byte
+	u16 := func(v int) { out = binary.BigEndian.AppendUint16(out, uint16(v)) }
+	u32 := func(v int) { out = binary.BigEndian.AppendUint32(out, uint32(v)) }
+	segment := func(marker int, body []byte) {
+		u16(marker)
+		u16(len(body) + 2)
+		out = append(out, body...)
+	}
+
+	// main header
+	u16(markerSOC)
+	siz := []byte{0, 0}
+	for _, v := range []int{o.width + o.x0, o.height + o.y0, o.x0, o.y0, o.tileWidth, o.tileHeight, o.tileX0, o.tileY0} {
+		siz = binary.BigEndian.AppendUint32(siz, uint32(v))
+	}
+	siz = binary.BigEndian.AppendUint16(siz, uint16(len(components)))
+	for _, c := range components {
+		ssiz := byte(c.precision - 1)
+		if c.signed {
+			ssiz |= 0x80
+		}
+		siz = append(siz, ssiz, byte(c.dx), byte(c.dy))
+	}
+	segment(markerSIZ, siz)
+
+	scod := byte(0)
+	if o.precincts != nil {
+		scod |= 1
+	}
+	if o.sop {
+		scod |= 2
+	}
+	if o.eph {
+		scod |= 4
+	}
+	mct := byte(0)
+	if o.mct {
+		mct = 1
+	}
+	cod := []byte{scod, byte(o.progression), byte(o.layers >> 8), byte(o.layers), mct,
+		byte(o.levels), byte(o.codeBlock - 2), byte(o.codeBlock - 2), byte(o.style), 1}
+	for _, p := range o.precincts {
+		cod = append(cod, byte(p|p<<4))
+	}
+	segment(markerCOD, cod)
+
+	// the exponents of reversible coding are the precision plus the gain of the subband
+	precision := components[0].precision
+	if o.mct {
+		precision++
+	}
+	qcd := []byte{byte(o.guardBits << 5), byte(precision << 3)}
+	for r := 1; r <= o.levels; r++ {
+		qcd = append(qcd, byte((precision+1)<<3), byte((precision+1)<<3), byte((precision+2)<<3))
+	}
+	segment(markerQCD, qcd)
+
+	// the geometry of the tiles
+	info, err := parseSIZ(siz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := header{
+		coding:       make([]codingStyle, len(components)),
+		quantization: make([]quantization, len(components)),
+		roiShift:     make([]int, len(components)),
+	}
+	explicit := make([]bool, len(components))
+	if err := parseHeaderSegment(markerCOD, cod, &h, explicit, explicit); err != nil {
+		t.Fatal(err)
+	}
+	if err := parseHeaderSegment(markerQCD, qcd, &h, explicit, explicit); err != nil {
+		t.Fatal(err)
+	}
+
+	for index := 0; index < info.tilesAcross*info.tilesDown; index++ {
+		tl := &tile{index: index, header: h}
+		if err := tl.init(info); err != nil {
+			t.Fatal(err)
+		}
+		transformTile(tl, info, components, o)
+
+		blocks := map[*codeBlock]*encodedBlock{}
+		for c := range tl.components {
+			tc := &tl.components[c]
+			for r := range tc.resolutions {
+				for p := range tc.resolutions[r].precincts {
+					for _, pb := range tc.resolutions[r].precincts[p].bands {
+						for i := range pb.blocks {
+							blocks[&pb.blocks[i]] = encodeCodeBlock(pb.band, &pb.blocks[i], o.style)
+						}
+					}
+				}
+			}
+		}
+
+		var packets [][]byte
+		encoders := map[*precinctBand][2]*tagEncoder{}
+		for _, p := range tl.packets(info) {
+			tc := &tl.components[p.component]
+			pr := &tc.resolutions[p.resolution].precincts[p.precinct]
+			packets = append(packets, encodePacket(pr, p.layer, o, blocks, encoders, len(packets)))
+		}
+
+		// split the packets of the tile over the tile-parts
+		for part := 0; part < o.tileParts; part++ {
+			var data []byte
+			for _, p := range packets[part*len(packets)/o.tileParts : (part+1)*len(packets)/o.tileParts] {
+				data = append(data, p...)
+			}
+			u16(markerSOT)
+			u16(10)
+			u16(index)
+			u32(12 + 2 + len(data))
+			out = append(out, byte(part), byte(o.tileParts))
+			u16(markerSOD)
+			out = append(out, data...)
+		}
+	}
+	u16(markerEOC)
+	return out
+}
+
+// transformTile level shifts, transforms and quantizes the samples of a tile into the
+// coefficients of its subbands
+func transformTile(tl *tile, info imageSize, components []testComponent, o encodeOptions) {
+	samples := make([][]float64, len(tl.components))
+	for c := range tl.components {
+		tc := &tl.components[c]
+		comp := components[c]
+		width := ceilDiv(info.width, comp.dx) - ceilDiv(info.x0, comp.dx)
+		offsetX, offsetY := ceilDiv(info.x0, comp.dx), ceilDiv(info.y0, comp.dy)
+		shift := 0.0
+		if !comp.signed {
+			shift = math.Ldexp(1, comp.precision-1)
+		}
+		for y := tc.y0; y < tc.y1; y++ {
+			for x := tc.x0; x < tc.x1; x++ {
+				samples[c] = append(samples[c], float64(comp.samples[(y-offsetY)*width+x-offsetX])-shift)
+			}
+		}
+	}
+	if o.mct {
+		r, g, b := samples[0], samples[1], samples[2]
+		for i := range r {
+			r[i], g[i], b[i] = math.Floor((r[i]+2*g[i]+b[i])/4), b[i]-g[i], r[i]-g[i]
+		}
+	}
+
+	for c := range tl.components {
+		tc := &tl.components[c]
+		current := samples[c]
+		for r := len(tc.resolutions) - 1; r > 0; r-- {
+			res := &tc.resolutions[r]
+			width, height := res.x1-res.x0, res.y1-res.y0
+			if width > 0 && height > 0 {
+				analyze2D(current, width, height, res.x0, res.y0)
+			}
+			lower := &tc.resolutions[r-1]
+			low := &band{x0: lower.x0, y0: lower.y0, x1: lower.x1, y1: lower.y1}
+			low.coefficients = make([]float64, (low.x1-low.x0)*(low.y1-low.y0))
+			for _, b := range append([]*band{low}, res.bands...) {
+				xob, yob := 0, 0
+				if b.orientation == bandHL || b.orientation == bandHH {
+					xob = 1
+				}
+				if b.orientation == bandLH || b.orientation == bandHH {
+					yob = 1
+				}
+				bw := b.x1 - b.x0
+				for y := b.y0; y < b.y1; y++ {
+					for x := b.x0; x < b.x1; x++ {
+						b.coefficients[(y-b.y0)*bw+x-b.x0] = current[(2*y+yob-res.y0)*width+2*x+xob-res.x0]
+					}
+				}
+			}
+			current = low.coefficients
+		}
+		copy(tc.resolutions[0].bands[0].coefficients, current)
+	}
+}
+
+func encodeCodeBlock(b *band, block *codeBlock, style int) *encodedBlock {
+	width, height := block.x1-block.x0, block.y1-block.y0
+	coefficients := make([]int64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			coefficients[y*width+x] = int64(b.coefficients[(block.y0-b.y0+y)*(b.x1-b.x0)+block.x0-b.x0+x])
+		}
+	}
+	zero, passes := encodeBlock(coefficients, width, height, b.orientation, style, b.magnitudeBits)
+	return &encodedBlock{zeroBitPlanes: zero, passes: passes}
+}
+
+// encodePacket writes the packet of a precinct for one layer
+func encodePacket(p *precinct, layer int, o encodeOptions, blocks map[*codeBlock]*encodedBlock, encoders map[*precinctBand][2]*tagEncoder, sequence int) []byte {
+	var out []byte
+	if o.sop {
+		out = append(out, 0xFF, 0x91, 0, 4, byte(sequence>>8), byte(sequence))
+	}
+	w := &headerWriter{}
+	w.bit(1)
+	var body []byte
+	for b := range p.bands {
+		pb := &p.bands[b]
+		trees, ok := encoders[pb]
+		if !ok {
+			inclusion := make([]int, len(pb.blocks))
+			zero := make([]int, len(pb.blocks))
+			for i := range pb.blocks {
+				eb := blocks[&pb.blocks[i]]
+				inclusion[i] = o.layers
+				for l := 0; l < o.layers; l++ {
+					if first, last := eb.layerPasses(l, o.layers); last > first {
+						inclusion[i] = l
+						break
+					}
+				}
+				zero[i] = eb.zeroBitPlanes
+			}
+			trees = [2]*tagEncoder{newTagEncoder(pb.blocksWide, pb.blocksHigh, inclusion), newTagEncoder(pb.blocksWide, pb.blocksHigh, zero)}
+			encoders[pb] = trees
+		}
+
+		for j := 0; j < pb.blocksHigh; j++ {
+			for i := 0; i < pb.blocksWide; i++ {
+				block := &pb.blocks[j*pb.blocksWide+i]
+				eb := blocks[block]
+				first, last := eb.layerPasses(layer, o.layers)
+				if block.included {
+					w.bit(boolBit(last > first))
+				} else {
+					trees[0].encode(w, i, j, layer+1)
+				}
+				if last == first {
+					continue
+				}
+				if !block.included {
+					block.included = true
+					block.lblock = 3
+					trees[1].encode(w, i, j, math.MaxInt32)
+				}
+				w.passCount(last - first)
+
+				// the codeword segments of the passes, a layer must end with a complete segment
+				var pieces [][]byte
+				var counts []int
+				count := 0
+				for pass := first; pass < last; pass++ {
+					count++
+					if eb.passes[pass] != nil {
+						pieces = append(pieces, eb.passes[pass])
+						counts = append(counts, count)
+						count = 0
+					}
+				}
+				increase := 0
+				for k, piece := range pieces {
+					for len(piece) >= 1<<uint(block.lblock+increase+floorLog2(counts[k])) {
+						increase++
+					}
+				}
+				for k := 0; k < increase; k++ {
+					w.bit(1)
+				}
+				w.bit(0)
+				block.lblock += increase
+				for k, piece := range pieces {
+					w.bits(len(piece), block.lblock+floorLog2(counts[k]))
+					body = append(body, piece...)
+				}
+			}
+		}
+	}
+	out = append(out, w.flush()...)
+	if o.eph {
+		out = append(out, 0xFF, 0x92)
+	}
+	return append(out, body...)
+}
+
+func boolBit(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,204 @@
+package jpeg2000
+
+// qeEntry is one state of the MQ-coder probability estimation, see ITU-T T.800 Table C.2
+type qeEntry struct {
+	qe       uint32
+	nmps     uint8
+	nlps     uint8
+	switches bool
+}
+
+var qeTable = [47]qeEntry{
+	{0x5601, 1, 1, true},
+	{0x3401, 2, 6, false},
+	{0x1801, 3, 9, false},
+	{0x0AC1, 4, 12, false},
+	{0x0521, 5, 29, false},
+	{0x0221, 38, 33, false},
+	{0x5601, 7, 6, true},
+	{0x5401, 8, 14, false},
+	{0x4801, 9, 14, false},
+	{0x3801, 10, 14, false},
+	{0x3001, 11, 17, false},
+	{0x2401, 12, 18, false},
+	{0x1C01, 13, 20, false},
+	{0x1601, 29, 21, false},
+	{0x5601, 15, 14, true},
+	{0x5401, 16, 14, false},
+	{0x5101, 17, 15, false},
+	{0x4801, 18, 16, false},
+	{0x3801, 19, 17, false},
+	{0x3401, 20, 18, false},
+	{0x3001, 21, 19, false},
+	{0x2801, 22, 19, false},
+	{0x2401, 23, 20, false},
+	{0x2201, 24, 21, false},
+	{0x1C01, 25, 22, false},
+	{0x1801, 26, 23, false},
+	{0x1601, 27, 24, false},
+	{0x1401, 28, 25, false},
+	{0x1201, 29, 26, false},
+	{0x1101, 30, 27, false},
+	{0x0AC1, 31, 28, false},
+	{0x09C1, 32, 29, false},
+	{0x08A1, 33, 30, false},
+	{0x0521, 34, 31, false},
+	{0x0441, 35, 32, false},
+	{0x02A1, 36, 33, false},
+	{0x0221, 37, 34, false},
+	{0x0141, 38, 35, false},
+	{0x0111, 39, 36, false},
+	{0x0085, 40, 37, false},
+	{0x0049, 41, 38, false},
+	{0x0025, 42, 39, false},
+	{0x0015, 43, 40, false},
+	{0x0009, 44, 41, false},
+	{0x0005, 45, 42, false},
+	{0x0001, 45, 43, false},
+	{0x5601, 46, 46, false},
+}
+
+// context is the state of one MQ-coder context: index in qeTable and the more probable symbol
+type context struct {
+	index uint8
+	mps   uint8
+}
+
+// mqDecoder is the arithmetic decoder of T.800 Annex C
+type mqDecoder struct {
+	data []byte
+	pos  int
+	a    uint32
+	c    uint32
+	ct   int
+}
+
+func (d *mqDecoder) byteAt(pos int) uint32 {
+	if pos < len(d.data) {
+		return uint32(d.data[pos])
+	}
+	return 0xFF
+}
+
+func (d *mqDecoder) init(data []byte) {
+	d.data = data
+	d.pos = 0
+	d.c = d.byteAt(0) << 16
+	d.byteIn()
+	d.c <<= 7
+	d.ct -= 7
+	d.a = 0x8000
+}
+
+func (d *mqDecoder) byteIn() {
+	if d.byteAt(d.pos) == 0xFF {
+		if next := d.byteAt(d.pos + 1); next > 0x8F {
+			// a marker, feed ones
+			d.c += 0xFF00
+			d.ct = 8
+		} else {
+			d.pos++
+			d.c += next << 9
+			d.ct = 7
+		}
+	} else {
+		d.pos++
+		d.c += d.byteAt(d.pos) << 8
+		d.ct = 8
+	}
+}
+
+// decode returns the next decision in context cx
+func (d *mqDecoder) decode(cx *context) uint8 {
+	entry := &qeTable[cx.index]
+	qe := entry.qe
+	var bit uint8
+	d.a -= qe
+	if (d.c >> 16) < qe {
+		// LPS exchange
+		if d.a < qe {
+			bit = cx.mps
+			cx.index = entry.nmps
+		} else {
+			bit = 1 - cx.mps
+			if entry.switches {
+				cx.mps = 1 - cx.mps
+			}
+			cx.index = entry.nlps
+		}
+		d.a = qe
+		d.renormalize()
+	} else {
+		d.c -= qe << 16
+		if d.a&0x8000 != 0 {
+			return cx.mps
+		}
+		// MPS exchange
+		if d.a < qe {
+			bit = 1 - cx.mps
+			if entry.switches {
+				cx.mps = 1 - cx.mps
+			}
+			cx.index = entry.nlps
+		} else {
+			bit = cx.mps
+			cx.index = entry.nmps
+		}
+		d.renormalize()
+	}
+	return bit
+}
+
+func (d *mqDecoder) renormalize() {
+	for {
+		if d.ct == 0 {
+			d.byteIn()
+		}
+		d.a <<= 1
+		d.c <<= 1
+		d.ct--
+		if d.a&0x8000 != 0 {
+			return
+		}
+	}
+}
+
+// rawDecoder reads the raw (bypassed) bits of the selective arithmetic coding bypass mode, see T.800 D.6
+type rawDecoder struct {
+	data []byte
+	pos  int
+	c    uint8
+	ct   int
+}
+
+func (d *rawDecoder) init(data []byte) {
+	d.data = data
+	d.pos = 0
+	d.c = 0
+	d.ct = 0
+}
+
+func (d *rawDecoder) decode() uint8 {
+	if d.ct == 0 {
+		if d.c == 0xFF {
+			if d.pos < len(d.data) && d.data[d.pos] <= 0x8F {
+				d.c = d.data[d.pos]
+				d.pos++
+				d.ct = 7
+			} else {
+				d.c = 0xFF
+				d.ct = 8
+			}
+		} else {
+			if d.pos < len(d.data) {
+				d.c = d.data[d.pos]
+				d.pos++
+			} else {
+				d.c = 0xFF
+			}
+			d.ct = 8
+		}
+	}
+	d.ct--
+	return (d.c >> uint(d.ct)) & 1
+}
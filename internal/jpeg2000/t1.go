@@ -0,0 +1,424 @@
+package jpeg2000
+
+import "fmt"
+
+// Subband orientations
+const (
+	bandLL = iota
+	bandHL
+	bandLH
+	bandHH
+)
+
+// Context labels of the coefficient bit modeling, see T.800 Annex D
+const (
+	contextRunLength = 17
+	contextUniform   = 18
+	contextCount     = 19
+)
+
+// Coefficient state flags
+const (
+	flagSignificant = 1 << iota
+	flagNegative
+	flagVisited
+	flagRefined
+)
+
+// Coding passes
+const (
+	passSignificance = iota
+	passRefinement
+	passCleanup
+)
+
+// zeroCodingContexts holds the zero coding context label for each orientation, indexed by
+// the number of significant horizontal (0-2), vertical (0-2) and diagonal (0-4) neighbours.
+// See T.800 Table D.1.
+var zeroCodingContexts [4][3][3][5]uint8
+
+func init() {
+	for h := 0; h < 3; h++ {
+		for v := 0; v < 3; v++ {
+			for d := 0; d < 5; d++ {
+				zeroCodingContexts[bandLL][h][v][d] = zeroCodingLL(h, v, d)
+				zeroCodingContexts[bandLH][h][v][d] = zeroCodingLL(h, v, d)
+				zeroCodingContexts[bandHL][h][v][d] = zeroCodingLL(v, h, d)
+				zeroCodingContexts[bandHH][h][v][d] = zeroCodingHH(h+v, d)
+			}
+		}
+	}
+}
+
+func zeroCodingLL(h, v, d int) uint8 {
+	switch {
+	case h == 2:
+		return 8
+	case h == 1 && v >= 1:
+		return 7
+	case h == 1 && d >= 1:
+		return 6
+	case h == 1:
+		return 5
+	case v == 2:
+		return 4
+	case v == 1:
+		return 3
+	case d >= 2:
+		return 2
+	case d == 1:
+		return 1
+	}
+	return 0
+}
+
+func zeroCodingHH(hv, d int) uint8 {
+	switch {
+	case d >= 3:
+		return 8
+	case d == 2 && hv >= 1:
+		return 7
+	case d == 2:
+		return 6
+	case d == 1 && hv >= 2:
+		return 5
+	case d == 1 && hv == 1:
+		return 4
+	case d == 1:
+		return 3
+	case hv >= 2:
+		return 2
+	case hv == 1:
+		return 1
+	}
+	return 0
+}
+
+// segment is a terminated codeword segment of a code-block, possibly spread over several packets
+type segment struct {
+	data      []byte
+	passes    int
+	maxPasses int
+}
+
+// passType returns the type of coding pass number pass, the first pass is a cleanup pass
+func passType(pass int) int {
+	return (pass + 2) % 3
+}
+
+// segmentMaxPasses returns the number of passes in the codeword segment starting with pass
+// number pass, see T.800 Table D.8 and D.9
+func segmentMaxPasses(style int, pass int) int {
+	if style&styleTerminateAll != 0 {
+		return 1
+	}
+	if style&styleBypass != 0 {
+		if pass < 10 {
+			return 10 - pass
+		}
+		if passType(pass) == passSignificance {
+			return 2
+		}
+		return 1
+	}
+	return 1 << 30
+}
+
+// isRawPass tells if a pass is coded without the arithmetic coder in bypass mode
+func isRawPass(style int, pass int) bool {
+	return style&styleBypass != 0 && pass >= 10 && passType(pass) != passCleanup
+}
+
+// blockDecoder decodes the coefficients of one code-block (tier-1 decoding)
+type blockDecoder struct {
+	width, height int
+	stride        int
+	flags         []uint8
+	magnitudes    []uint64
+	orientation   int
+	style         int
+	contexts      [contextCount]context
+	mq            mqDecoder
+	raw           rawDecoder
+	useRaw        bool
+}
+
+func (b *blockDecoder) resetContexts() {
+	for i := range b.contexts {
+		b.contexts[i] = context{}
+	}
+	b.contexts[0].index = 4
+	b.contexts[contextRunLength].index = 3
+	b.contexts[contextUniform].index = 46
+}
+
+// decodeBlock decodes the segments of a code-block into values (width*height, raster order).
+// bitPlanes is the number of magnitude bit planes coded, the first one being bitPlanes-1.
+// Reconstructed values are set half way into the uncertainty interval of truncated coefficients,
+// which is always the case for irreversible coding.
+func decodeBlock(segments []segment, width, height, orientation, style, bitPlanes int, reversible bool, values []float64) error {
+	passes := 0
+	for _, s := range segments {
+		passes += s.passes
+	}
+	if passes == 0 {
+		return nil
+	}
+	if bitPlanes <= 0 || bitPlanes > 62 {
+		return fmt.Errorf("jpeg2000: invalid number of bit planes %d", bitPlanes)
+	}
+	if passes > 3*bitPlanes-2 {
+		return fmt.Errorf("jpeg2000: %d coding passes for %d bit planes", passes, bitPlanes)
+	}
+
+	b := blockDecoder{
+		width:       width,
+		height:      height,
+		stride:      width + 2,
+		flags:       make([]uint8, (width+2)*(height+2)),
+		magnitudes:  make([]uint64, width*height),
+		orientation: orientation,
+		style:       style,
+	}
+	b.resetContexts()
+
+	pass := 0
+	lastPlane := bitPlanes - 1
+	for _, s := range segments {
+		for i := 0; i < s.passes; i++ {
+			if i == 0 || style&styleTerminateAll != 0 {
+				b.useRaw = isRawPass(style, pass)
+				if b.useRaw {
+					b.raw.init(s.data)
+				} else {
+					b.mq.init(s.data)
+				}
+			} else if b.useRaw != isRawPass(style, pass) {
+				return fmt.Errorf("jpeg2000: coding pass %d does not fit its segment", pass)
+			}
+
+			plane := bitPlanes - 1 - (pass+2)/3
+			switch passType(pass) {
+			case passSignificance:
+				b.significancePass(plane)
+			case passRefinement:
+				b.refinementPass(plane)
+			case passCleanup:
+				b.cleanupPass(plane)
+				if style&styleSegmentationSymbol != 0 {
+					for j := 0; j < 4; j++ {
+						b.mq.decode(&b.contexts[contextUniform])
+					}
+				}
+			}
+			if style&styleReset != 0 {
+				b.resetContexts()
+			}
+			lastPlane = plane
+			pass++
+		}
+	}
+
+	var offset float64
+	if lastPlane > 0 {
+		offset = float64(uint64(1) << uint(lastPlane-1))
+	} else if !reversible {
+		offset = 0.5
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			magnitude := b.magnitudes[y*width+x]
+			if magnitude == 0 {
+				continue
+			}
+			value := float64(magnitude) + offset
+			if b.flags[(y+1)*b.stride+x+1]&flagNegative != 0 {
+				value = -value
+			}
+			values[y*width+x] = value
+		}
+	}
+	return nil
+}
+
+// neighbours returns the number of significant horizontal, vertical and diagonal neighbours of (x, y)
+func (b *blockDecoder) neighbours(x, y int) (int, int, int) {
+	i := (y+1)*b.stride + x + 1
+	f := b.flags
+	up, down := i-b.stride, i+b.stride
+	h := int(f[i-1]&flagSignificant) + int(f[i+1]&flagSignificant)
+	v := int(f[up] & flagSignificant)
+	d := int(f[up-1]&flagSignificant) + int(f[up+1]&flagSignificant)
+	if !b.causalBoundary(y) {
+		v += int(f[down] & flagSignificant)
+		d += int(f[down-1]&flagSignificant) + int(f[down+1]&flagSignificant)
+	}
+	return h, v, d
+}
+
+// causalBoundary tells if the row below y must be ignored in vertically causal mode
+func (b *blockDecoder) causalBoundary(y int) bool {
+	return b.style&styleVerticallyCausal != 0 && y%4 == 3
+}
+
+func (b *blockDecoder) zeroCodingContext(x, y int) uint8 {
+	h, v, d := b.neighbours(x, y)
+	return zeroCodingContexts[b.orientation][h][v][d]
+}
+
+// signContribution is the contribution of a neighbour to the sign context, see T.800 Table D.2
+func signContribution(flags uint8) int {
+	if flags&flagSignificant == 0 {
+		return 0
+	}
+	if flags&flagNegative != 0 {
+		return -1
+	}
+	return 1
+}
+
+func clampContribution(c int) int {
+	if c > 1 {
+		return 1
+	}
+	if c < -1 {
+		return -1
+	}
+	return c
+}
+
+// decodeSign decodes the sign of (x, y) and makes it significant with the bit of the current plane
+func (b *blockDecoder) decodeSign(x, y, plane int) {
+	i := (y+1)*b.stride + x + 1
+	var negative uint8
+	if b.useRaw {
+		negative = b.raw.decode()
+	} else {
+		f := b.flags
+		h := clampContribution(signContribution(f[i-1]) + signContribution(f[i+1]))
+		below := 0
+		if !b.causalBoundary(y) {
+			below = signContribution(f[i+b.stride])
+		}
+		v := clampContribution(signContribution(f[i-b.stride]) + below)
+		// T.800 Table D.3
+		var label int
+		var xor uint8
+		if h < 0 {
+			h, v, xor = -h, -v, 1
+		}
+		if h == 0 {
+			label = 9 + abs(v)
+			if v < 0 {
+				xor = 1
+			}
+		} else {
+			label = 12 + v
+		}
+		negative = b.mq.decode(&b.contexts[label]) ^ xor
+	}
+	b.flags[i] |= flagSignificant
+	if negative != 0 {
+		b.flags[i] |= flagNegative
+	}
+	b.magnitudes[y*b.width+x] |= 1 << uint(plane)
+}
+
+func (b *blockDecoder) decodeBit(label uint8) uint8 {
+	if b.useRaw {
+		return b.raw.decode()
+	}
+	return b.mq.decode(&b.contexts[label])
+}
+
+func (b *blockDecoder) significancePass(plane int) {
+	for y0 := 0; y0 < b.height; y0 += 4 {
+		for x := 0; x < b.width; x++ {
+			for y := y0; y < y0+4 && y < b.height; y++ {
+				i := (y+1)*b.stride + x + 1
+				if b.flags[i]&flagSignificant != 0 {
+					continue
+				}
+				label := b.zeroCodingContext(x, y)
+				if label == 0 {
+					continue
+				}
+				if b.decodeBit(label) != 0 {
+					b.decodeSign(x, y, plane)
+				}
+				b.flags[i] |= flagVisited
+			}
+		}
+	}
+}
+
+func (b *blockDecoder) refinementPass(plane int) {
+	for y0 := 0; y0 < b.height; y0 += 4 {
+		for x := 0; x < b.width; x++ {
+			for y := y0; y < y0+4 && y < b.height; y++ {
+				i := (y+1)*b.stride + x + 1
+				if b.flags[i]&(flagSignificant|flagVisited) != flagSignificant {
+					continue
+				}
+				var label uint8 = 14
+				if b.flags[i]&flagRefined != 0 {
+					label = 16
+				} else if h, v, d := b.neighbours(x, y); h+v+d > 0 {
+					label = 15
+				}
+				if b.decodeBit(label) != 0 {
+					b.magnitudes[y*b.width+x] |= 1 << uint(plane)
+				}
+				b.flags[i] |= flagRefined
+			}
+		}
+	}
+}
+
+func (b *blockDecoder) cleanupPass(plane int) {
+	for y0 := 0; y0 < b.height; y0 += 4 {
+		for x := 0; x < b.width; x++ {
+			start := y0
+			if y0+4 <= b.height && b.runLengthEligible(x, y0) {
+				if b.mq.decode(&b.contexts[contextRunLength]) == 0 {
+					continue
+				}
+				r := int(b.mq.decode(&b.contexts[contextUniform]))<<1 | int(b.mq.decode(&b.contexts[contextUniform]))
+				b.decodeSign(x, y0+r, plane)
+				start = y0 + r + 1
+			}
+			for y := start; y < y0+4 && y < b.height; y++ {
+				i := (y+1)*b.stride + x + 1
+				if b.flags[i]&(flagSignificant|flagVisited) != 0 {
+					continue
+				}
+				if b.mq.decode(&b.contexts[b.zeroCodingContext(x, y)]) != 0 {
+					b.decodeSign(x, y, plane)
+				}
+			}
+			for y := y0; y < y0+4 && y < b.height; y++ {
+				b.flags[(y+1)*b.stride+x+1] &^= flagVisited
+			}
+		}
+	}
+}
+
+// runLengthEligible tells if the four coefficients of a stripe column are coded in run-length mode
+func (b *blockDecoder) runLengthEligible(x, y0 int) bool {
+	for y := y0; y < y0+4; y++ {
+		if b.flags[(y+1)*b.stride+x+1]&(flagSignificant|flagVisited) != 0 {
+			return false
+		}
+		if h, v, d := b.neighbours(x, y); h+v+d != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
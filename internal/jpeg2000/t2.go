@@ -0,0 +1,287 @@
+package jpeg2000
+
+import (
+	"fmt"
+)
+
+// tagTree is the tag tree of T.800 B.10.2, used for code-block inclusion and zero bit planes
+type tagTree struct {
+	levels []tagLevel
+}
+
+type tagLevel struct {
+	width int
+	nodes []tagNode
+}
+
+type tagNode struct {
+	value int
+	low   int
+}
+
+const tagUnknown = 1 << 30
+
+func newTagTree(width, height int) *tagTree {
+	t := &tagTree{}
+	for {
+		level := tagLevel{width: width, nodes: make([]tagNode, width*height)}
+		for i := range level.nodes {
+			level.nodes[i].value = tagUnknown
+		}
+		t.levels = append(t.levels, level)
+		if width <= 1 && height <= 1 {
+			return t
+		}
+		width, height = (width+1)/2, (height+1)/2
+	}
+}
+
+// decode reads the bits needed to tell if the value of leaf (x, y) is below threshold
+func (t *tagTree) decode(r *headerReader, x, y, threshold int) (bool, error) {
+	low := 0
+	for l := len(t.levels) - 1; l >= 0; l-- {
+		level := &t.levels[l]
+		node := &level.nodes[(y>>uint(l))*level.width+(x>>uint(l))]
+		if low > node.low {
+			node.low = low
+		} else {
+			low = node.low
+		}
+		for low < threshold && low < node.value {
+			bit, err := r.bit()
+			if err != nil {
+				return false, err
+			}
+			if bit != 0 {
+				node.value = low
+			} else {
+				low++
+			}
+		}
+		node.low = low
+	}
+	return t.levels[0].nodes[y*t.levels[0].width+x].value < threshold, nil
+}
+
+// value decodes the complete value of leaf (x, y)
+func (t *tagTree) value(r *headerReader, x, y int) (int, error) {
+	threshold := 1
+	for {
+		known, err := t.decode(r, x, y, threshold)
+		if err != nil || known {
+			return t.levels[0].nodes[y*t.levels[0].width+x].value, err
+		}
+		threshold++
+	}
+}
+
+// headerReader reads the bits of packet headers, skipping the bit stuffed after each 0xFF byte
+type headerReader struct {
+	data []byte
+	pos  int
+	buf  byte
+	ct   int
+}
+
+func (r *headerReader) bit() (int, error) {
+	if r.ct == 0 {
+		if r.pos >= len(r.data) {
+			return 0, fmt.Errorf("jpeg2000: packet header truncated")
+		}
+		stuffed := r.buf == 0xFF
+		r.buf = r.data[r.pos]
+		r.pos++
+		r.ct = 8
+		if stuffed {
+			r.ct = 7
+		}
+	}
+	r.ct--
+	return int(r.buf>>uint(r.ct)) & 1, nil
+}
+
+func (r *headerReader) bits(n int) (int, error) {
+	v := 0
+	for i := 0; i < n; i++ {
+		b, err := r.bit()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<1 | b
+	}
+	return v, nil
+}
+
+// align skips to the end of the packet header
+func (r *headerReader) align() {
+	if r.buf == 0xFF {
+		r.pos++
+	}
+	r.ct = 0
+	r.buf = 0
+}
+
+// passCount reads the number of new coding passes, see T.800 Table B.4
+func (r *headerReader) passCount() (int, error) {
+	if b, err := r.bit(); err != nil || b == 0 {
+		return 1, err
+	}
+	if b, err := r.bit(); err != nil || b == 0 {
+		return 2, err
+	}
+	if v, err := r.bits(2); err != nil || v != 3 {
+		return 3 + v, err
+	}
+	if v, err := r.bits(5); err != nil || v != 31 {
+		return 6 + v, err
+	}
+	v, err := r.bits(7)
+	return 37 + v, err
+}
+
+// codeBlock is a code-block of a subband, in subband coordinates
+type codeBlock struct {
+	x0, y0, x1, y1 int
+	included       bool
+	zeroBitPlanes  int
+	lblock         int
+	passes         int
+	segments       []segment
+}
+
+// precinctBand holds the code-blocks of one subband inside a precinct
+type precinctBand struct {
+	band          *band
+	blocksWide    int
+	blocksHigh    int
+	blocks        []codeBlock
+	inclusion     *tagTree
+	zeroBitPlanes *tagTree
+}
+
+type precinct struct {
+	bands []precinctBand
+}
+
+// pieceOf records the new data of a code-block segment found in a packet header
+type pieceOf struct {
+	block   *codeBlock
+	segment int
+	length  int
+}
+
+// decodePacket reads one packet starting at data[pos] and returns the position after it
+func decodePacket(data []byte, pos int, p *precinct, layer int, style codingStyle) (int, error) {
+	if style.sop && pos+6 <= len(data) && data[pos] == 0xFF && data[pos+1] == byte(markerSOP&0xFF) {
+		pos += 6
+	}
+	r := &headerReader{data: data, pos: pos}
+	present, err := r.bit()
+	if err != nil {
+		return pos, err
+	}
+	var pieces []pieceOf
+	if present != 0 {
+		for b := range p.bands {
+			pb := &p.bands[b]
+			for j := 0; j < pb.blocksHigh; j++ {
+				for i := 0; i < pb.blocksWide; i++ {
+					block := &pb.blocks[j*pb.blocksWide+i]
+					newPieces, err := decodeBlockHeader(r, pb, block, i, j, layer, style)
+					if err != nil {
+						return pos, err
+					}
+					pieces = append(pieces, newPieces...)
+				}
+			}
+		}
+	}
+	r.align()
+	pos = r.pos
+	if style.eph {
+		if pos+2 > len(data) || data[pos] != 0xFF || data[pos+1] != byte(markerEPH&0xFF) {
+			return pos, fmt.Errorf("jpeg2000: missing EPH marker")
+		}
+		pos += 2
+	}
+	for _, piece := range pieces {
+		if pos+piece.length > len(data) {
+			return pos, fmt.Errorf("jpeg2000: packet data truncated")
+		}
+		s := &piece.block.segments[piece.segment]
+		s.data = append(s.data, data[pos:pos+piece.length]...)
+		pos += piece.length
+	}
+	return pos, nil
+}
+
+// decodeBlockHeader reads the part of a packet header describing one code-block
+func decodeBlockHeader(r *headerReader, pb *precinctBand, block *codeBlock, i, j, layer int, style codingStyle) ([]pieceOf, error) {
+	var included bool
+	var err error
+	if block.included {
+		var bit int
+		bit, err = r.bit()
+		included = bit != 0
+	} else {
+		included, err = pb.inclusion.decode(r, i, j, layer+1)
+	}
+	if err != nil || !included {
+		return nil, err
+	}
+
+	if !block.included {
+		block.included = true
+		block.lblock = 3
+		if block.zeroBitPlanes, err = pb.zeroBitPlanes.value(r, i, j); err != nil {
+			return nil, err
+		}
+	}
+
+	passes, err := r.passCount()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		bit, err := r.bit()
+		if err != nil {
+			return nil, err
+		}
+		if bit == 0 {
+			break
+		}
+		block.lblock++
+	}
+
+	var pieces []pieceOf
+	for passes > 0 {
+		last := len(block.segments) - 1
+		if last < 0 || block.segments[last].passes == block.segments[last].maxPasses {
+			block.segments = append(block.segments, segment{maxPasses: segmentMaxPasses(style.codeBlockStyle, block.passes)})
+			last++
+		}
+		s := &block.segments[last]
+		n := s.maxPasses - s.passes
+		if n > passes {
+			n = passes
+		}
+		length, err := r.bits(block.lblock + floorLog2(n))
+		if err != nil {
+			return nil, err
+		}
+		s.passes += n
+		block.passes += n
+		passes -= n
+		pieces = append(pieces, pieceOf{block: block, segment: last, length: length})
+	}
+	return pieces, nil
+}
+
+func floorLog2(n int) int {
+	l := 0
+	for n > 1 {
+		n >>= 1
+		l++
+	}
+	return l
+}
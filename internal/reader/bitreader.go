@@ -1,38 +1,41 @@
 package reader
 
 import (
-	//"fmt"
-
-	"bytes"
+	"encoding/binary"
+	"fmt"
 	"io"
 )
 
 //go:generate mockgen -destination=../mocks/reader.go -package=mocks io Reader
 
-// BitReader wraps an io.Reader and provides the ability to read values,
-// bit-by-bit, from it.
+// BitReader provides the ability to read values, bit-by-bit, from data read
+// from an io.Reader. Values are extracted from 64-bit words of the data rather
+// than bit per bit.
 type BitReader struct {
-	reader io.ByteReader
-	byte   byte
-	offset byte
+	data []byte
+	// pos is the position of the next bit to read, counted from the first bit of data
+	pos uint64
 }
 
-// ResetOffset reset the bit cursor to 0.
-// The bit cursor is a value between 0 and 7 that point on the current bit to be read.
+// ResetOffset moves the bit cursor to the start of the next byte, unless it is
+// at the start of a byte already. Blocks of values that start on a byte use it
+// to skip the padding bits at the end of the previous block.
 func (r *BitReader) ResetOffset() {
-	r.offset = 0
+	r.pos = (r.pos + 7) &^ 7
 }
 
 // New creates a BitReader from an io.reader.
 // It reads 'dataLength' bytes and stores them in an internal buffer.
 func New(dataReader io.Reader, dataLength int) (*BitReader, error) {
+	if dataLength < 0 {
+		return nil, fmt.Errorf("Invalid data length %d", dataLength)
+	}
 	rawData := make([]byte, dataLength)
-	_, err := dataReader.Read(rawData)
+	_, err := io.ReadFull(dataReader, rawData)
 	if err != nil {
 		return nil, err
 	}
-	buffer := bytes.NewBuffer(rawData)
-	return newReader(buffer), nil
+	return &BitReader{data: rawData}, nil
 }
 
 // ReadInt reads an integer encoded on `bits' bits.
@@ -46,185 +49,180 @@ func New(dataReader io.Reader, dataLength int) (*BitReader, error) {
 // * First bit indicates a negative number
 // * 010100011 means 163
 func (r *BitReader) ReadInt(bits int) (int64, error) {
-	var result int64
-	var negative int64 = 1
-	for i := bits - 1; i >= 0; i-- {
-		bit, err := r.readBit()
+	value, err := r.readUint(bits)
+	if err != nil {
+		return 0, err
+	}
+	return SignMagnitude(value, bits), nil
+}
 
-		if err != nil {
-			return 0, err
-		}
-		if i == (bits-1) && bit == 1 {
-			negative = -1
-			continue
-		}
-		result |= int64(bit << uint(i))
+// SignMagnitude converts value, the `bits' bits of a sign-magnitude integer, to an int64.
+// GRIB encodes signed integers with the first bit as the sign and the other bits as the magnitude,
+// rather than in two's complement: 0x8003 is -3 on 16 bits.
+func SignMagnitude(value uint64, bits int) int64 {
+	if bits <= 0 || bits > 64 {
+		return 0
+	}
+	sign := uint64(1) << (bits - 1)
+	magnitude := int64(value & (sign - 1))
+	if value&sign != 0 {
+		return -magnitude
+	}
+	return magnitude
+}
+
+// ReadIntsBlock reads a set of sign-magnitude integers encoded on `bits' bits, see ReadInt and ReadUintsBlock.
+func (r *BitReader) ReadIntsBlock(bits int, count int64, resetOffset bool) ([]int64, error) {
+	values, err := r.ReadUintsBlock(bits, count, resetOffset)
+	if values == nil {
+		return nil, err
+	}
+	result := make([]int64, len(values))
+	for i, value := range values {
+		result[i] = SignMagnitude(value, bits)
 	}
-	return negative * result, nil
+	return result, err
 }
 
 // ReadUintsBlock reads a set of unsigned integer encoded on `bits' bits.
+// If resetOffset is true, the block starts on the next byte, see ResetOffset.
+// If the data ends before count values, the values read are returned with io.ErrUnexpectedEOF.
 func (r *BitReader) ReadUintsBlock(bits int, count int64, resetOffset bool) ([]uint64, error) {
-	result := make([]uint64, count)
-
 	if resetOffset {
 		r.ResetOffset()
 	}
-
-	if bits != 0 {
-		for i := int64(0); i != count; i++ {
-			data, err := r.readUint(bits)
-			if err != nil {
-				return result, err
-			}
-			result[i] = data
-		}
+	if bits < 0 || bits > 64 {
+		return nil, fmt.Errorf("Can not read values of %d bits", bits)
 	}
-
-	return result, nil
-}
-
-func newReader(r io.ByteReader) *BitReader {
-	return &BitReader{r, 0, 0}
-}
-
-func (r *BitReader) currentBit() byte {
-	return (r.byte >> (7 - r.offset)) & 0x01
-}
-
-func (r *BitReader) readBit() (uint, error) {
-	if r.offset == 8 || r.offset == 0 {
-		r.offset = 0
-		if b, err := r.reader.ReadByte(); err == nil {
-			r.byte = b
-		} else {
-			return 0, err
-		}
+	if bits == 0 {
+		return make([]uint64, count), nil
 	}
-	bit := uint((r.byte >> (7 - r.offset)) & 0x01)
 
-	r.offset++
-	return bit, nil
-}
+	var err error
+	if available := int64(r.remaining() / uint64(bits)); count > available {
+		count, err = available, io.ErrUnexpectedEOF
+	}
+	result := make([]uint64, count)
 
-func (r *BitReader) readUint(nbits int) (uint64, error) {
-	var result uint64
-	for i := nbits - 1; i >= 0; i-- {
-		if bit, err := r.readBit(); err == nil {
-			result |= uint64(bit << uint(i))
-		} else {
-			return 0, err
+	if r.pos%8 == 0 {
+		// whole bytes, the values are read without shifting
+		data := r.data[r.pos/8:]
+		switch bits {
+		case 8:
+			for i := range result {
+				result[i] = uint64(data[i])
+			}
+			r.pos += uint64(count) * 8
+			return result, err
+		case 16:
+			for i := range result {
+				result[i] = uint64(binary.BigEndian.Uint16(data[2*i:]))
+			}
+			r.pos += uint64(count) * 16
+			return result, err
+		case 24:
+			for i := range result {
+				result[i] = uint64(data[3*i])<<16 | uint64(data[3*i+1])<<8 | uint64(data[3*i+2])
+			}
+			r.pos += uint64(count) * 24
+			return result, err
 		}
 	}
 
-	return result, nil
-}
-
-////////////////////////////////////////////////////////////////////////////////////
-
-// bitReader wraps an io.Reader and provides the ability to read values,
-// bit-by-bit, from it. Its Read* methods don't return the usual error
-// because the error handling was verbose. Instead, any error is kept and can
-// be checked afterwards.
-/*type bitReader struct {
-	r    io.ByteReader
-	n    uint64
-	bits uint
-	err  error
-}
-
-// newBitReader returns a new bitReader reading from r. If r is not
-// already an io.ByteReader, it will be converted via a bufio.Reader.
-func newBitReader(r io.Reader) bitReader {
-	byter, ok := r.(io.ByteReader)
-	if !ok {
-		byter = bufio.NewReader(r)
+	r.readBlock(result, bits)
+	return result, err
+}
+
+// readBlock reads len(result) values of `bits' bits, 0 < bits <= 64, which must be available. The bits are
+// taken from a cache refilled with a 64-bit word at a time.
+func (r *BitReader) readBlock(result []uint64, bits int) {
+	data := r.data
+	next := r.pos / 8 // the next byte to load in the cache
+	var cache uint64  // the bits to read, from the most significant bit
+	var cached uint64 // the number of bits in the cache
+	if skip := r.pos % 8; skip != 0 {
+		cache = uint64(data[next]) << (56 + skip)
+		cached = 8 - skip
+		next++
 	}
-	return bitReader{r: byter}
-}
-
-func (br *bitReader) incrByte() {
-	br.bits = 0
-}
-
-// readBits64 reads the given number of bits and returns them in the
-// least-significant part of a uint64. In the event of an error, it returns 0
-// and the error can be obtained by calling Err().
-func (br *bitReader) readBits64(bits uint) (n uint64) {
-	for bits > br.bits {
-		b, err := br.r.ReadByte()
-		if err == io.EOF {
-			err = io.ErrUnexpectedEOF
+	refill := func() {
+		if next+8 <= uint64(len(data)) {
+			cache |= binary.BigEndian.Uint64(data[next:]) >> cached
+			loaded := (64 - cached) / 8
+			next += loaded
+			cached += 8 * loaded
+			return
 		}
-		if err != nil {
-			br.err = err
-			return 0
+		for cached <= 56 && next < uint64(len(data)) {
+			cache |= uint64(data[next]) << (56 - cached)
+			next++
+			cached += 8
 		}
-		br.n <<= 8
-		br.n |= uint64(b)
-		br.bits += 8
-	}
-
-	// br.n looks like this (assuming that br.bits = 14 and bits = 6):
-	// Bit: 111111
-	//      5432109876543210
-	//
-	//         (6 bits, the desired output)
-	//        |-----|
-	//        V     V
-	//      0101101101001110
-	//        ^            ^
-	//        |------------|
-	//           br.bits (num valid bits)
-	//
-	// This the next line right shifts the desired bits into the
-	// least-significant places and masks off anything above.
-	n = (br.n >> (br.bits - bits)) & ((1 << bits) - 1)
-	br.bits -= bits
-	return
-}
-
-func (br *bitReader) readIntsBlock(bits int, count int, compensateByte bool) ([]int64, error) {
-	//log.Println("Reading", bits, "bits", count, "x")
-	data := make([]int64, count)
+	}
 
-	if bits != 0 {
-		for i := 0; i != count; i++ {
-			data[i] = int64(br.readBits64(uint(bits)))
-			//log.Println(data[i])
+	need := uint64(bits)
+	for i := range result {
+		if cached < need {
+			refill()
 		}
-
-		if compensateByte {
-			// if we are not fitting last byte seek to byte end
-			//rest := (bits * count) % 8
-			//if rest != 0 {
-			//	r.offset += byte(8 - int64(rest))
-			//}
-			br.n = 0
+		if cached >= need {
+			result[i] = cache >> (64 - need)
+			cache <<= need
+			cached -= need
+			continue
 		}
+		// wider than the cache after a refill, take its bits and refill it for the rest
+		high, rest := cache>>(64-cached), need-cached
+		cache, cached = 0, 0
+		refill()
+		result[i] = high<<rest | cache>>(64-rest)
+		cache <<= rest
+		cached -= rest
 	}
-	return data, nil
-}
-
-func (br *bitReader) readBits(bits uint) (n int) {
-	n64 := br.readBits64(bits)
-	return int(n64)
+	r.pos += uint64(len(result)) * need
 }
 
-func (br *bitReader) readBit() bool {
-	n := br.readBits(1)
-	return n != 0
+// remaining returns the number of bits left to read
+func (r *BitReader) remaining() uint64 {
+	return uint64(len(r.data))*8 - r.pos
 }
 
-func (br *bitReader) tryReadBit() (bit byte, ok bool) {
-	if br.bits > 0 {
-		br.bits--
-		return byte(br.n>>br.bits) & 1, true
+func (r *BitReader) readUint(bits int) (uint64, error) {
+	if bits < 0 || bits > 64 {
+		return 0, fmt.Errorf("Can not read values of %d bits", bits)
+	}
+	if uint64(bits) > r.remaining() {
+		return 0, io.ErrUnexpectedEOF
+	}
+	value := r.peek(bits)
+	r.pos += uint64(bits)
+	return value, nil
+}
+
+// peek returns the value of the `bits' bits at the cursor, 0 < bits <= 64, without moving the cursor.
+// The bits must be available.
+func (r *BitReader) peek(bits int) uint64 {
+	index := r.pos / 8
+	shift := r.pos % 8
+
+	// the 64-bit word starting at the byte of the cursor, padded with zeros at the end of the data
+	var word uint64
+	if index+8 <= uint64(len(r.data)) {
+		word = binary.BigEndian.Uint64(r.data[index:])
+	} else {
+		for i := uint64(0); i < 8; i++ {
+			word <<= 8
+			if index+i < uint64(len(r.data)) {
+				word |= uint64(r.data[index+i])
+			}
+		}
 	}
-	return 0, false
-}
 
-func (br *bitReader) Err() error {
-	return br.err
+	value := word << shift >> (64 - uint64(bits))
+	if shift+uint64(bits) > 64 {
+		// the last bits are in the ninth byte
+		spill := shift + uint64(bits) - 64
+		value |= uint64(r.data[index+8]) >> (8 - spill)
+	}
+	return value
 }
-*/
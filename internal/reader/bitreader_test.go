@@ -2,12 +2,15 @@ package reader_test
 
 import (
 	"bytes"
+	"fmt"
 	"io"
+	"math/rand"
 	"testing"
 
 	"github.com/golang/mock/gomock"
 	"github.com/nilsmagnus/grib/internal/mocks"
 	"github.com/nilsmagnus/grib/internal/reader"
+	"github.com/nilsmagnus/grib/internal/writer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -102,3 +105,166 @@ func TestReadUintsBlock(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func BenchmarkReadUintsBlock(b *testing.B) {
+	data := make([]byte, 1<<16)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	for _, bits := range []int{1, 7, 8, 12, 16, 24, 32} {
+		b.Run(fmt.Sprintf("%d bits", bits), func(b *testing.B) {
+			count := int64(len(data) * 8 / bits)
+			b.SetBytes(int64(len(data)))
+			for n := 0; n < b.N; n++ {
+				bitReader, err := reader.New(bytes.NewReader(data), len(data))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := bitReader.ReadUintsBlock(bits, count, false); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// referenceUint reads the value of `bits' bits at bit position pos of data, bit per bit
+func referenceUint(data []byte, pos int, bits int) uint64 {
+	var value uint64
+	for i := pos; i < pos+bits; i++ {
+		value = value<<1 | uint64(data[i/8]>>(7-i%8)&1)
+	}
+	return value
+}
+
+func TestReadUintsBlockWidths(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	data := make([]byte, 203)
+	random.Read(data)
+
+	for bits := 1; bits <= 64; bits++ {
+		for skip := 0; skip < 8; skip++ {
+			bitReader, err := reader.New(bytes.NewReader(data), len(data))
+			require.NoError(t, err)
+			if skip > 0 {
+				_, err = bitReader.ReadUintsBlock(skip, 1, false)
+				require.NoError(t, err)
+			}
+
+			count := (len(data)*8 - skip) / bits
+			values, err := bitReader.ReadUintsBlock(bits, int64(count), false)
+			require.NoError(t, err, "%d bits after %d bits", bits, skip)
+			require.Len(t, values, count)
+			for i, value := range values {
+				if expected := referenceUint(data, skip+i*bits, bits); value != expected {
+					t.Fatalf("%d bits after %d bits, value %d: got %x, expected %x", bits, skip, i, value, expected)
+				}
+			}
+
+			// the cursor is after the block
+			rest := len(data)*8 - skip - count*bits
+			if rest > 0 {
+				value, err := bitReader.ReadUintsBlock(rest, 1, false)
+				require.NoError(t, err)
+				assert.Equal(t, referenceUint(data, len(data)*8-rest, rest), value[0])
+			}
+			_, err = bitReader.ReadUintsBlock(1, 1, false)
+			assert.Equal(t, io.ErrUnexpectedEOF, err)
+		}
+	}
+}
+
+func TestResetOffset(t *testing.T) {
+	bitReader, err := reader.New(bytes.NewBuffer([]byte{0xA8, 0xE5, 0x2B, 0xf4}), 4)
+	require.NoError(t, err)
+
+	// at the start of a byte, nothing is skipped
+	data, err := bitReader.ReadUintsBlock(8, 1, true)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{0xA8}, data)
+
+	// the rest of the byte is skipped
+	data, err = bitReader.ReadUintsBlock(3, 1, false)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{0x7}, data)
+	data, err = bitReader.ReadUintsBlock(16, 1, true)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{0x2Bf4}, data)
+}
+
+func TestSignMagnitude(t *testing.T) {
+	type signMagnitudeTest struct {
+		name     string
+		raw      uint64
+		expected int64
+	}
+
+	for bits := 1; bits <= 64; bits++ {
+		sign := uint64(1) << (bits - 1)
+		largest := int64(sign - 1)
+		tests := []signMagnitudeTest{
+			{"zero", 0, 0},
+			{"negative zero", sign, 0},
+			{"largest", sign - 1, largest},
+			{"smallest", sign | (sign - 1), -largest},
+		}
+		if bits > 1 {
+			tests = append(tests, signMagnitudeTest{"one", 1, 1}, signMagnitudeTest{"minus one", sign | 1, -1})
+		}
+
+		for _, test := range tests {
+			t.Run(fmt.Sprintf("%d bits %s", bits, test.name), func(t *testing.T) {
+				assert.Equal(t, test.expected, reader.SignMagnitude(test.raw, bits))
+
+				// the same value three times after 3 bits, to read it across octets
+				w := writer.New()
+				w.WriteUint(0x5, 3)
+				for i := 0; i < 3; i++ {
+					w.WriteUint(test.raw, bits)
+				}
+				data := w.Bytes()
+
+				bitReader, err := reader.New(bytes.NewReader(data), len(data))
+				require.NoError(t, err)
+				_, err = bitReader.ReadUintsBlock(3, 1, false)
+				require.NoError(t, err)
+				value, err := bitReader.ReadInt(bits)
+				require.NoError(t, err)
+				assert.Equal(t, test.expected, value)
+
+				values, err := bitReader.ReadIntsBlock(bits, 2, false)
+				require.NoError(t, err)
+				assert.Equal(t, []int64{test.expected, test.expected}, values)
+			})
+		}
+	}
+}
+
+func TestReadIntsBlock(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		// 1010 1000 1110 0101 0010 1011 1111 0100
+		bitReader, err := reader.New(bytes.NewBuffer([]byte{0xA8, 0xE5, 0x2B, 0xf4}), 4)
+		require.NoError(t, err)
+
+		data, err := bitReader.ReadIntsBlock(4, 8, false)
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{-2, 0, -6, 5, 2, -3, -7, 4}, data)
+	})
+
+	t.Run("not enough data", func(t *testing.T) {
+		bitReader, err := reader.New(bytes.NewBuffer([]byte{0xA8, 0xE5, 0x2B, 0xf4}), 4)
+		require.NoError(t, err)
+
+		data, err := bitReader.ReadIntsBlock(12, 3, false)
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+		assert.Equal(t, []int64{-0x28E, 0x52B}, data)
+	})
+
+	t.Run("too many bits", func(t *testing.T) {
+		bitReader, err := reader.New(bytes.NewBuffer([]byte{0xA8, 0xE5, 0x2B, 0xf4}), 4)
+		require.NoError(t, err)
+
+		_, err = bitReader.ReadIntsBlock(65, 1, false)
+		assert.Error(t, err)
+	})
+}
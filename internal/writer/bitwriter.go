@@ -0,0 +1,70 @@
+package writer
+
+// BitWriter packs values of any number of bits, most significant bit first.
+// It is the counterpart of reader.BitReader.
+type BitWriter struct {
+	data   []byte
+	buffer uint64 // bits not written to data yet, right aligned
+	count  uint   // number of bits in buffer
+}
+
+// New creates an empty BitWriter
+func New() *BitWriter {
+	return &BitWriter{}
+}
+
+// WriteUint writes the lowest `bits' bits of value, bits is at most 64
+func (w *BitWriter) WriteUint(value uint64, bits int) {
+	for bits > 32 {
+		bits -= 32
+		w.WriteUint(value>>uint(bits), 32)
+	}
+	if bits <= 0 {
+		return
+	}
+	w.buffer = w.buffer<<uint(bits) | value&(1<<uint(bits)-1)
+	w.count += uint(bits)
+	for w.count >= 8 {
+		w.count -= 8
+		w.data = append(w.data, byte(w.buffer>>w.count))
+	}
+}
+
+// WriteInt writes value as a sign-magnitude integer of `bits' bits: the first bit is the sign
+// and the other bits are the magnitude, see reader.BitReader.ReadInt
+func (w *BitWriter) WriteInt(value int64, bits int) {
+	w.WriteUint(SignMagnitude(value, bits), bits)
+}
+
+// SignMagnitude converts value to a sign-magnitude integer of `bits' bits, the inverse of reader.SignMagnitude.
+// The magnitude is truncated to bits-1 bits.
+func SignMagnitude(value int64, bits int) uint64 {
+	if bits <= 0 || bits > 64 {
+		return 0
+	}
+	sign := uint64(1) << (bits - 1)
+	if value < 0 {
+		return sign | uint64(-value)&(sign-1)
+	}
+	return uint64(value) & (sign - 1)
+}
+
+// WriteUintsBlock writes every value with `bits' bits
+func (w *BitWriter) WriteUintsBlock(values []uint64, bits int) {
+	for _, value := range values {
+		w.WriteUint(value, bits)
+	}
+}
+
+// Align pads the last octet with zero bits
+func (w *BitWriter) Align() {
+	if w.count > 0 {
+		w.WriteUint(0, int(8-w.count))
+	}
+}
+
+// Bytes returns the written data, the last octet is padded with zero bits
+func (w *BitWriter) Bytes() []byte {
+	w.Align()
+	return w.data
+}
@@ -0,0 +1,72 @@
+package writer_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/nilsmagnus/grib/internal/reader"
+	"github.com/nilsmagnus/grib/internal/writer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteUint(t *testing.T) {
+	w := writer.New()
+	w.WriteUint(0x5, 3)
+	w.WriteUint(0x1, 1)
+	w.WriteUint(0xABC, 12)
+	w.WriteUint(0x1, 2)
+
+	assert.Equal(t, []byte{0xBA, 0xBC, 0x40}, w.Bytes())
+}
+
+func TestWriteInt(t *testing.T) {
+	w := writer.New()
+	w.WriteInt(-163, 10)
+	w.WriteInt(163, 10)
+
+	r, err := reader.New(bytes.NewReader(w.Bytes()), 3)
+	require.NoError(t, err)
+
+	negative, err := r.ReadInt(10)
+	require.NoError(t, err)
+	positive, err := r.ReadInt(10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-163), negative)
+	assert.Equal(t, int64(163), positive)
+}
+
+func TestWriteUintsBlock(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for bits := 1; bits <= 64; bits++ {
+		values := make([]uint64, 17)
+		for i := range values {
+			values[i] = random.Uint64() >> uint(64-bits)
+		}
+		w := writer.New()
+		w.WriteUintsBlock(values, bits)
+		data := w.Bytes()
+		require.Len(t, data, (17*bits+7)/8)
+
+		r, err := reader.New(bytes.NewReader(data), len(data))
+		require.NoError(t, err)
+		read, err := r.ReadUintsBlock(bits, int64(len(values)), false)
+
+		require.NoError(t, err)
+		assert.Equal(t, values, read, "%d bits", bits)
+	}
+}
+
+func TestSignMagnitude(t *testing.T) {
+	assert.Equal(t, uint64(0x8003), writer.SignMagnitude(-3, 16))
+	assert.Equal(t, uint64(0x0003), writer.SignMagnitude(3, 16))
+
+	random := rand.New(rand.NewSource(1))
+	for bits := 1; bits <= 64; bits++ {
+		magnitude := int64(random.Uint64() >> uint(65-bits))
+		for _, value := range []int64{magnitude, -magnitude} {
+			assert.Equal(t, value, reader.SignMagnitude(writer.SignMagnitude(value, bits), bits), "%d bits", bits)
+		}
+	}
+}
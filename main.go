@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"log"
+	"log/slog"
 	"math"
 	"os"
 
@@ -10,15 +11,20 @@ import (
 	"io"
 )
 
-func optionsFromFlag() griblib.Options {
+// optionsFromFlag returns the filter and export options and the read options given by the flags
+func optionsFromFlag() (griblib.Options, griblib.ReadOptions) {
 	filename := flag.String("file", "", "Grib filepath")
 	reducedFile := flag.String("reducefile", "reduced.grib2", "Destination for reduced file.")
-	operation := flag.String("operation", "parse", "Operation. Valid values: 'parse', 'reduce'.")
+	operation := flag.String("operation", "parse", "Operation. Valid values: 'parse', 'reduce', 'index'.")
 	exportType := flag.Int("export", griblib.ExportNone, "Export format. Valid types are 0 (none) 1(print discipline names) 2(print categories) 3(json) 4(png - experimental) ")
 	maxNum := flag.Int("maxmsg", math.MaxInt32, "Maximum number of messages to parse. Does not work in combination with filters.")
 	discipline := flag.Int("discipline", -1, "Filters on Discipline. -1 means all disciplines")
 	category := flag.Int("category", -1, "Filters on Category within discipline. -1 means all categories")
+	parameter := flag.Int("parameter", -1, "Filters on Parameter number within category. -1 means all parameters")
+	forecastTime := flag.Int("forecastTime", -1, "Filters on Forecast time, in the unit of the product. -1 means all forecast times")
 	dataExport := flag.Bool("dataExport", true, "Export data values.")
+	tolerant := flag.Bool("tolerant", false, "Skip junk and corrupt messages instead of stopping at them.")
+	regularize := flag.Bool("regularize", false, "Interpolate quasi-regular (reduced) grids onto regular grids.")
 	surface := flag.Int("surfacetype", 255, "Surface type (1== ground/sea level)")
 	latMin := flag.Int("latMin", griblib.LatitudeSouth, "Minimum latitude multiplied with 100000.")
 	latMax := flag.Int("latMax", griblib.LatitudeNorth, "Maximum latitude multiplied with 100000.")
@@ -27,6 +33,21 @@ func optionsFromFlag() griblib.Options {
 
 	flag.Parse()
 
+	var parameters, forecastTimes []int
+	if *parameter != -1 {
+		parameters = []int{*parameter}
+	}
+	if *forecastTime != -1 {
+		forecastTimes = []int{*forecastTime}
+	}
+
+	// the data is only decoded for the messages passing the filters
+	readOptions := griblib.DefaultReadOptions()
+	readOptions.HeadersOnly = true
+	readOptions.Tolerant = *tolerant
+	readOptions.Regularize = *regularize
+	readOptions.Logger = slog.Default()
+
 	return griblib.Options{
 		Operation:               *operation,
 		Filepath:                *filename,
@@ -35,6 +56,8 @@ func optionsFromFlag() griblib.Options {
 		MaximumNumberOfMessages: *maxNum,
 		Discipline:              *discipline,
 		Category:                *category,
+		Parameters:              parameters,
+		ForecastTimes:           forecastTimes,
 		DataExport:              *dataExport,
 		Surface: griblib.Surface{
 			Type: uint8(*surface),
@@ -45,11 +68,11 @@ func optionsFromFlag() griblib.Options {
 			MinLong: int32(*longMin),
 			MaxLong: int32(*longMax),
 		},
-	}
+	}, readOptions
 }
 
 func main() {
-	options := optionsFromFlag()
+	options, readOptions := optionsFromFlag()
 
 	log.Printf("Input parameters : %#v \n", options)
 
@@ -69,11 +92,13 @@ func main() {
 
 	switch options.Operation {
 	case "parse":
-		parse(gribFile, options)
+		parse(gribFile, options, readOptions)
 	case "reduce":
 		reduceToFile(gribFile, options)
+	case "index":
+		printIndex(gribFile)
 	default:
-		log.Printf("Operation '%s' not supported. Valid values are 'parse' and 'reduce'.", options.Operation)
+		log.Printf("Operation '%s' not supported. Valid values are 'parse', 'reduce' and 'index'.", options.Operation)
 		os.Exit(1)
 	}
 }
@@ -93,32 +118,30 @@ func reduceToFile(gribFile io.Reader, options griblib.Options) {
 
 	defer reduceFile.Close()
 
-	end := make(chan bool)
-	content := make(chan []byte)
-
-	go griblib.Reduce(gribFile, options, content, end)
-
-	for {
-		select {
-		case <-end:
-			log.Printf("reduce done to file '%s'. \n", options.ReduceFilePath)
-			return
-		case bytesRead := <-content:
-			reduceFile.Write(bytesRead)
-		}
+	if err := griblib.Reduce(gribFile, reduceFile, options); err != nil {
+		log.Printf("Error reducing file: %s", err.Error())
+		os.Exit(1)
 	}
+	log.Printf("reduce done to file '%s'. \n", options.ReduceFilePath)
+}
 
+// printIndex prints the inventory of gribFile in the format of NOAA .idx files
+func printIndex(gribFile io.Reader) {
+	index, err := griblib.BuildIndex(gribFile)
+	if err == nil {
+		err = griblib.WriteIdx(os.Stdout, index)
+	}
+	if err != nil {
+		log.Printf("Error indexing gribfile: %s", err.Error())
+		os.Exit(1)
+	}
 }
 
-func parse(gribFile io.Reader, options griblib.Options) {
-	messages, err := griblib.ReadMessages(gribFile)
+func parse(gribFile io.Reader, options griblib.Options, readOptions griblib.ReadOptions) {
+	err := griblib.ExportScanner(griblib.NewScannerWithOptions(gribFile, readOptions), options)
 
 	if err != nil {
 		log.Printf("Error reading all messages in gribfile: %s", err.Error())
 		os.Exit(1)
 	}
-
-	filteredMessages := griblib.Filter(messages, options)
-
-	griblib.Export(filteredMessages, options)
 }